@@ -9,6 +9,9 @@ import (
 
 type Node interface {
 	TokenLiteral() string
+	// Pos is the position of the node's token, which for infix, call and
+	// index expressions is the operator rather than the left operand.
+	Pos() token.Position
 	String() string
 }
 
@@ -25,26 +28,40 @@ type Expression interface {
 type StringLiteral struct {
     Token token.Token
     Value string
+    // Object is the value of the literal, built once by the evaluator in
+    // its own copy of the program before running it. Modify does not copy
+    // it.
+    Object interface{}
 }
 
 func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// HashPair is a key and value of a HashLiteral.
+type HashPair struct {
+    Key Expression
+    Value Expression
+}
+
+// HashLiteral keeps its pairs in source order, which is the order they are
+// evaluated and inserted in.
 type HashLiteral struct {
     Token token.Token
-    Pairs map[Expression]Expression
+    Pairs []HashPair
 }
 
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 
     var out bytes.Buffer
 
     pairs := []string{}
-    for key, value := range hl.Pairs {
-        pairs = append(pairs, key.String()+":"+value.String())
+    for _, pair := range hl.Pairs {
+        pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
     }
     out.WriteString("{")
     out.WriteString(strings.Join(pairs,","))
@@ -53,6 +70,29 @@ func (hl *HashLiteral) String() string {
 
 }
 
+// SetLiteral is a brace literal without colons, such as {1, 2, 3}. The
+// empty braces {} are always a HashLiteral.
+type SetLiteral struct {
+    Token token.Token
+    Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode() {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *SetLiteral) String() string {
+    var out bytes.Buffer
+
+    elements := []string{}
+    for _, el := range sl.Elements {
+        elements = append(elements, el.String())
+    }
+    out.WriteString("{")
+    out.WriteString(strings.Join(elements, ", "))
+    out.WriteString("}")
+    return out.String()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -65,6 +105,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -83,6 +130,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -96,13 +144,34 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Identifier names a value. Binding, Depth and Slot are set by package
+// resolver and tell the evaluator where to find the value without looking
+// the name up.
 type Identifier struct {
-	Token token.Token
-	Value string
-}
+	Token   token.Token
+	Value   string
+	Binding Binding
+	Depth   int
+	Slot    int
+}
+
+// Binding is how an identifier is looked up.
+type Binding int
+
+const (
+	// Dynamic identifiers are looked up by name in every enclosing scope,
+	// and then among the builtins.
+	Dynamic Binding = iota
+	// Local identifiers are in slot Slot of the frame of the function
+	// Depth functions out from the one they appear in.
+	Local
+	// Global identifiers are declared by the program, or are builtins.
+	Global
+)
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type ReturnStatement struct {
@@ -112,6 +181,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -132,6 +202,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -142,10 +213,15 @@ func (es *ExpressionStatement) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	// Object is the value of the literal, built once by the evaluator in
+	// its own copy of the program before running it. Modify does not copy
+	// it.
+	Object interface{}
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type PrefixExpression struct {
@@ -156,6 +232,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -176,6 +253,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -195,6 +273,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
@@ -206,6 +285,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -222,13 +302,41 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ForExpression runs Body once for every element of Iterable, binding the
+// element to Variable.
+type ForExpression struct {
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fe *ForExpression) expressionNode()      {}
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) Pos() token.Position { return fe.Token.Pos }
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for(")
+	out.WriteString(fe.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	// Rbrace is the position of the closing brace.
+	Rbrace token.Position
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -238,14 +346,23 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+// FunctionLiteral is a generator when its body, not counting nested
+// function literals, contains a yield. Name is the name it is bound to
+// when it is the value of a let statement.
 type FunctionLiteral struct {
-	Token      token.Token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Token       token.Token
+	Parameters  []*Identifier
+	Body        *BlockStatement
+	IsGenerator bool
+	Name        string
+	// Locals names the slots of the frame of a call, starting with the
+	// parameters. It is set by package resolver.
+	Locals []string
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -263,6 +380,69 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// MacroLiteral defines a macro. Calling it passes the arguments unevaluated,
+// as quotes, and the call is replaced by the quote the body returns.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+	// Locals names the slots of the frame of an expansion, starting with
+	// the parameters. It is set by package resolver.
+	Locals []string
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position { return ml.Token.Pos }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// YieldExpression hands Value to whoever consumes the generator it runs
+// in. Value is nil for a bare yield.
+type YieldExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) Pos() token.Position { return ye.Token.Pos }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return ye.TokenLiteral()
+	}
+	return ye.TokenLiteral() + " " + ye.Value.String()
+}
+
+// SpawnExpression runs Call on a new task. Call is either a call, whose
+// function and arguments are evaluated before the task starts, or an
+// expression evaluating to a function that takes no arguments.
+type SpawnExpression struct {
+	Token token.Token
+	Call  Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) Pos() token.Position { return se.Token.Pos }
+func (se *SpawnExpression) String() string {
+	return se.TokenLiteral() + " " + se.Call.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -271,6 +451,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -284,6 +465,13 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// Calls reports whether the call is to the identifier name, as in a call
+// to quote.
+func (ce *CallExpression) Calls(name string) bool {
+	ident, ok := ce.Function.(*Identifier)
+	return ok && ident.Value == name
+}
+
 type ArrayLiteral struct {
     Token token.Token
     Elements []Expression
@@ -291,6 +479,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string {return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
     var out bytes.Buffer
 
@@ -315,6 +504,7 @@ type IndexExpression struct {
 
 func (ui *IndexExpression) expressionNode() {}
 func (ui *IndexExpression) TokenLiteral() string { return ui.Token.Literal }
+func (ui *IndexExpression) Pos() token.Position { return ui.Token.Pos }
 func (ui *IndexExpression) String() string {
     var out bytes.Buffer
     out.WriteString("(")
@@ -326,3 +516,61 @@ func (ui *IndexExpression) String() string {
     return out.String()
 }
 
+// SliceExpression is Left[Start:End:Step]. Omitted parts are nil.
+type SliceExpression struct {
+    Token token.Token
+    Left Expression
+    Start Expression
+    End Expression
+    Step Expression
+}
+
+func (se *SliceExpression) expressionNode() {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position { return se.Token.Pos }
+func (se *SliceExpression) String() string {
+    var out bytes.Buffer
+    out.WriteString("(")
+    out.WriteString(se.Left.String())
+    out.WriteString("[")
+    if se.Start != nil {
+        out.WriteString(se.Start.String())
+    }
+    out.WriteString(":")
+    if se.End != nil {
+        out.WriteString(se.End.String())
+    }
+    if se.Step != nil {
+        out.WriteString(":")
+        out.WriteString(se.Step.String())
+    }
+    out.WriteString("])")
+
+    return out.String()
+}
+
+type ImportExpression struct {
+    Token token.Token
+    Path Expression
+}
+
+func (ie *ImportExpression) expressionNode() {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) Pos() token.Position { return ie.Token.Pos }
+func (ie *ImportExpression) String() string {
+    return ie.TokenLiteral() + " " + ie.Path.String()
+}
+
+// ExportStatement marks the binding of a top-level let statement as part
+// of the module's public namespace.
+type ExportStatement struct {
+    Token token.Token
+    Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) Pos() token.Position { return es.Token.Pos }
+func (es *ExportStatement) String() string {
+    return es.TokenLiteral() + " " + es.Statement.String()
+}
@@ -0,0 +1,224 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the node that replaces node. It may return node
+// itself, changed or not.
+type ModifierFunc func(node Node) Node
+
+// Modify rebuilds node bottom-up: it copies node, replaces every child of
+// the copy with the result of modifying it, and returns modifier(copy).
+// The tree passed in is left unchanged, and the copies keep the tokens,
+// and so the positions, of the nodes they copy.
+//
+// A statement the modifier replaces with nil is removed from its block or
+// program. Any other child must be replaced by a node that fits where it
+// is, an expression for an expression and so on, or Modify panics.
+func Modify(node Node, modifier ModifierFunc) Node {
+    switch n := node.(type) {
+    case *Program:
+        c := *n
+        c.Statements = modifyStatements(n.Statements, modifier)
+        node = &c
+    case *BlockStatement:
+        c := *n
+        c.Statements = modifyStatements(n.Statements, modifier)
+        node = &c
+    case *LetStatement:
+        c := *n
+        c.Name = modifyIdentifier(n.Name, modifier)
+        c.Value = modifyExpression(n.Value, modifier)
+        node = &c
+    case *ReturnStatement:
+        c := *n
+        c.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+        node = &c
+    case *ExpressionStatement:
+        c := *n
+        c.Expression = modifyExpression(n.Expression, modifier)
+        node = &c
+    case *ExportStatement:
+        c := *n
+        if n.Statement != nil {
+            let, ok := Modify(n.Statement, modifier).(*LetStatement)
+            if !ok {
+                panic("ast.Modify: export statement must export a let statement")
+            }
+            c.Statement = let
+        }
+        node = &c
+
+    case *Identifier:
+        c := *n
+        node = &c
+    case *IntegerLiteral:
+        c := *n
+        c.Object = nil
+        node = &c
+    case *StringLiteral:
+        c := *n
+        c.Object = nil
+        node = &c
+    case *Boolean:
+        c := *n
+        node = &c
+
+    case *PrefixExpression:
+        c := *n
+        c.Right = modifyExpression(n.Right, modifier)
+        node = &c
+    case *InfixExpression:
+        c := *n
+        c.Left = modifyExpression(n.Left, modifier)
+        c.Right = modifyExpression(n.Right, modifier)
+        node = &c
+    case *IfExpression:
+        c := *n
+        c.Condition = modifyExpression(n.Condition, modifier)
+        c.Consequence = modifyBlock(n.Consequence, modifier)
+        c.Alternative = modifyBlock(n.Alternative, modifier)
+        node = &c
+    case *ForExpression:
+        c := *n
+        c.Variable = modifyIdentifier(n.Variable, modifier)
+        c.Iterable = modifyExpression(n.Iterable, modifier)
+        c.Body = modifyBlock(n.Body, modifier)
+        node = &c
+    case *FunctionLiteral:
+        c := *n
+        c.Parameters = make([]*Identifier, len(n.Parameters))
+        for i, param := range n.Parameters {
+            c.Parameters[i] = modifyIdentifier(param, modifier)
+        }
+        c.Body = modifyBlock(n.Body, modifier)
+        node = &c
+    case *MacroLiteral:
+        c := *n
+        c.Parameters = make([]*Identifier, len(n.Parameters))
+        for i, param := range n.Parameters {
+            c.Parameters[i] = modifyIdentifier(param, modifier)
+        }
+        c.Body = modifyBlock(n.Body, modifier)
+        node = &c
+    case *CallExpression:
+        c := *n
+        c.Function = modifyExpression(n.Function, modifier)
+        c.Arguments = modifyExpressions(n.Arguments, modifier)
+        node = &c
+    case *ArrayLiteral:
+        c := *n
+        c.Elements = modifyExpressions(n.Elements, modifier)
+        node = &c
+    case *SetLiteral:
+        c := *n
+        c.Elements = modifyExpressions(n.Elements, modifier)
+        node = &c
+    case *HashLiteral:
+        c := *n
+        c.Pairs = make([]HashPair, len(n.Pairs))
+        for i, pair := range n.Pairs {
+            c.Pairs[i] = HashPair{
+                Key: modifyExpression(pair.Key, modifier),
+                Value: modifyExpression(pair.Value, modifier),
+            }
+        }
+        node = &c
+    case *IndexExpression:
+        c := *n
+        c.Left = modifyExpression(n.Left, modifier)
+        c.Index = modifyExpression(n.Index, modifier)
+        node = &c
+    case *SliceExpression:
+        c := *n
+        c.Left = modifyExpression(n.Left, modifier)
+        c.Start = modifyExpression(n.Start, modifier)
+        c.End = modifyExpression(n.End, modifier)
+        c.Step = modifyExpression(n.Step, modifier)
+        node = &c
+    case *YieldExpression:
+        c := *n
+        c.Value = modifyExpression(n.Value, modifier)
+        node = &c
+    case *SpawnExpression:
+        c := *n
+        c.Call = modifyExpression(n.Call, modifier)
+        node = &c
+    case *ImportExpression:
+        c := *n
+        c.Path = modifyExpression(n.Path, modifier)
+        node = &c
+    }
+
+    return modifier(node)
+}
+
+// Copy returns a deep copy of node.
+func Copy(node Node) Node {
+    return Modify(node, func(node Node) Node { return node })
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+    modified := make([]Statement, 0, len(statements))
+    for _, s := range statements {
+        if s == nil {
+            continue
+        }
+        node := Modify(s, modifier)
+        if node == nil {
+            continue
+        }
+        statement, ok := node.(Statement)
+        if !ok {
+            panic(fmt.Sprintf("ast.Modify: cannot replace a statement with %T", node))
+        }
+        modified = append(modified, statement)
+    }
+    return modified
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) []Expression {
+    if expressions == nil {
+        return nil
+    }
+    modified := make([]Expression, len(expressions))
+    for i, e := range expressions {
+        modified[i] = modifyExpression(e, modifier)
+    }
+    return modified
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+    if e == nil {
+        return nil
+    }
+    node := Modify(e, modifier)
+    expression, ok := node.(Expression)
+    if !ok {
+        panic(fmt.Sprintf("ast.Modify: cannot replace an expression with %T", node))
+    }
+    return expression
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+    if block == nil {
+        return nil
+    }
+    node := Modify(block, modifier)
+    modified, ok := node.(*BlockStatement)
+    if !ok {
+        panic(fmt.Sprintf("ast.Modify: cannot replace a block with %T", node))
+    }
+    return modified
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+    if ident == nil {
+        return nil
+    }
+    node := Modify(ident, modifier)
+    modified, ok := node.(*Identifier)
+    if !ok {
+        panic(fmt.Sprintf("ast.Modify: cannot replace an identifier with %T", node))
+    }
+    return modified
+}
@@ -0,0 +1,161 @@
+package ast_test
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/internal/monkeytest"
+    "necronet.info/interpreter/token"
+)
+
+func turnOneIntoTwo(node ast.Node) ast.Node {
+    integer, ok := node.(*ast.IntegerLiteral)
+    if !ok || integer.Value != 1 {
+        return node
+    }
+    integer.Value = 2
+    integer.Token.Literal = "2"
+    return integer
+}
+
+func TestModify(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {`1`, `2`},
+        {`1 + 1`, `(2 + 2)`},
+        {`-1`, `(-2)`},
+        {`let a = 1;`, `let a = 2`},
+        {`return 1;`, `return 2;`},
+        {`export let a = 1;`, `export let a = 2`},
+        {`if (1) { 1 } else { 1 }`, `if2 2else 2`},
+        {`for (x in [1]) { 1 }`, `for(x in [2]) 2`},
+        {`fn(x) { 1 }`, `fn(x) 2`},
+        {`f(1, 1)`, `f(2, 2)`},
+        {`[1, 1]`, `[2,2]`},
+        {`{1, 1}`, `{2, 2}`},
+        {`{1: 1}`, `{2:2}`},
+        {`a[1]`, `(a[2])`},
+        {`a[1:1:1]`, `(a[2:2:2])`},
+        {`spawn f(1)`, `spawn f(2)`},
+        {`import 1`, `import 2`},
+        {`fn() { yield 1 }`, `fn() yield 2`},
+    }
+
+    for _, tt := range tests {
+        program := monkeytest.MustParse(t, tt.input)
+        modified := ast.Modify(program, turnOneIntoTwo)
+        if got := modified.String(); got != tt.expected {
+            t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+        }
+    }
+}
+
+func TestModifyVisitsEveryNodeType(t *testing.T) {
+    seen := map[string]bool{}
+    ast.Modify(monkeytest.MustParse(t, allNodes), func(node ast.Node) ast.Node {
+        seen[fmt.Sprintf("%T", node)] = true
+        return node
+    })
+    for _, typ := range nodeTypes(t) {
+        if !seen[typ] {
+            t.Errorf("%s not modified", typ)
+        }
+    }
+}
+
+// nodes lists the nodes of a tree with their positions.
+func nodes(node ast.Node) (list []ast.Node, positions []token.Position) {
+    ast.Inspect(node, func(node ast.Node) bool {
+        if node != nil {
+            list = append(list, node)
+            positions = append(positions, node.Pos())
+        }
+        return true
+    })
+    return list, positions
+}
+
+func TestModifyCopies(t *testing.T) {
+    program := monkeytest.MustParse(t, allNodes)
+    before := program.String()
+    original, originalPositions := nodes(program)
+
+    modified := ast.Modify(program, func(node ast.Node) ast.Node { return node })
+    copied, copiedPositions := nodes(modified)
+
+    if program.String() != before || modified.String() != before {
+        t.Fatalf("tree changed:\n%s\n%s", program.String(), modified.String())
+    }
+    if len(copied) != len(original) {
+        t.Fatalf("copied %d nodes out of %d", len(copied), len(original))
+    }
+    for i := range original {
+        if original[i] == copied[i] {
+            t.Errorf("%T %q was not copied", original[i], original[i].String())
+        }
+    }
+    if !reflect.DeepEqual(copiedPositions, originalPositions) {
+        t.Errorf("positions changed.\n got %v\nwant %v", copiedPositions, originalPositions)
+    }
+}
+
+func TestModifyDropsLiteralObjects(t *testing.T) {
+    program := monkeytest.MustParse(t, `let a = 1; "s"`)
+    ast.Inspect(program, func(node ast.Node) bool {
+        switch node := node.(type) {
+        case *ast.IntegerLiteral:
+            node.Object = "stale"
+        case *ast.StringLiteral:
+            node.Object = "stale"
+        }
+        return true
+    })
+
+    ast.Inspect(ast.Copy(program), func(node ast.Node) bool {
+        switch node := node.(type) {
+        case *ast.IntegerLiteral:
+            if node.Object != nil {
+                t.Errorf("Object of %s copied", node)
+            }
+        case *ast.StringLiteral:
+            if node.Object != nil {
+                t.Errorf("Object of %s copied", node)
+            }
+        }
+        return true
+    })
+}
+
+func TestModifyRemovesStatements(t *testing.T) {
+    program := monkeytest.MustParse(t, `let a = 1; puts(a); fn() { puts(a); a }`)
+    modified := ast.Modify(program, func(node ast.Node) ast.Node {
+        if es, ok := node.(*ast.ExpressionStatement); ok {
+            if call, ok := es.Expression.(*ast.CallExpression); ok && call.Function.String() == "puts" {
+                return nil
+            }
+        }
+        return node
+    })
+
+    if got, expected := modified.String(), "let a = 1fn() a"; got != expected {
+        t.Errorf("expected %q, got %q", expected, got)
+    }
+}
+
+func TestModifyPanicsOnMisfits(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Errorf("replacing an expression with a statement did not panic")
+        }
+    }()
+    ast.Modify(monkeytest.MustParse(t, `1 + 2`), func(node ast.Node) ast.Node {
+        if _, ok := node.(*ast.IntegerLiteral); ok {
+            return &ast.ReturnStatement{}
+        }
+        return node
+    })
+}
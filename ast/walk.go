@@ -0,0 +1,137 @@
+package ast
+
+// A Visitor's Visit method is called by Walk for every node. When it
+// returns a non-nil visitor w, Walk visits the children of node with w,
+// and then calls w.Visit(nil).
+type Visitor interface {
+    Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, in the order the nodes
+// appear in the source. It starts by calling v.Visit(node). Absent
+// optional children, like a missing else branch or slice bound, are not
+// visited.
+func Walk(v Visitor, node Node) {
+    if v = v.Visit(node); v == nil {
+        return
+    }
+
+    switch n := node.(type) {
+    case *Program:
+        walkStatements(v, n.Statements)
+    case *BlockStatement:
+        walkStatements(v, n.Statements)
+    case *LetStatement:
+        if n.Name != nil {
+            Walk(v, n.Name)
+        }
+        walkExpression(v, n.Value)
+    case *ReturnStatement:
+        walkExpression(v, n.ReturnValue)
+    case *ExpressionStatement:
+        walkExpression(v, n.Expression)
+    case *ExportStatement:
+        if n.Statement != nil {
+            Walk(v, n.Statement)
+        }
+
+    case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean:
+        // nothing to do
+
+    case *PrefixExpression:
+        walkExpression(v, n.Right)
+    case *InfixExpression:
+        walkExpression(v, n.Left)
+        walkExpression(v, n.Right)
+    case *IfExpression:
+        walkExpression(v, n.Condition)
+        walkBlock(v, n.Consequence)
+        walkBlock(v, n.Alternative)
+    case *ForExpression:
+        if n.Variable != nil {
+            Walk(v, n.Variable)
+        }
+        walkExpression(v, n.Iterable)
+        walkBlock(v, n.Body)
+    case *FunctionLiteral:
+        for _, param := range n.Parameters {
+            Walk(v, param)
+        }
+        walkBlock(v, n.Body)
+    case *MacroLiteral:
+        for _, param := range n.Parameters {
+            Walk(v, param)
+        }
+        walkBlock(v, n.Body)
+    case *CallExpression:
+        walkExpression(v, n.Function)
+        walkExpressions(v, n.Arguments)
+    case *ArrayLiteral:
+        walkExpressions(v, n.Elements)
+    case *SetLiteral:
+        walkExpressions(v, n.Elements)
+    case *HashLiteral:
+        for _, pair := range n.Pairs {
+            walkExpression(v, pair.Key)
+            walkExpression(v, pair.Value)
+        }
+    case *IndexExpression:
+        walkExpression(v, n.Left)
+        walkExpression(v, n.Index)
+    case *SliceExpression:
+        walkExpression(v, n.Left)
+        walkExpression(v, n.Start)
+        walkExpression(v, n.End)
+        walkExpression(v, n.Step)
+    case *YieldExpression:
+        walkExpression(v, n.Value)
+    case *SpawnExpression:
+        walkExpression(v, n.Call)
+    case *ImportExpression:
+        walkExpression(v, n.Path)
+    }
+
+    v.Visit(nil)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+    for _, s := range statements {
+        if s != nil {
+            Walk(v, s)
+        }
+    }
+}
+
+func walkExpressions(v Visitor, expressions []Expression) {
+    for _, e := range expressions {
+        walkExpression(v, e)
+    }
+}
+
+func walkExpression(v Visitor, e Expression) {
+    if e != nil {
+        Walk(v, e)
+    }
+}
+
+func walkBlock(v Visitor, block *BlockStatement) {
+    if block != nil {
+        Walk(v, block)
+    }
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+    if f(node) {
+        return f
+    }
+    return nil
+}
+
+// Inspect traverses an AST in depth-first order like Walk. It calls
+// f(node) for every node, and visits the children of node only when f
+// returns true. After the children, f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+    Walk(inspector(f), node)
+}
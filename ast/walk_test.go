@@ -0,0 +1,147 @@
+package ast_test
+
+import (
+    "fmt"
+    goast "go/ast"
+    goparser "go/parser"
+    gotoken "go/token"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/internal/monkeytest"
+)
+
+// allNodes uses every kind of node.
+const allNodes = `
+let a = -1 + 2;
+export let b = "s";
+let f = fn(x, y) { return x[0]; };
+if (true) { a } else { b };
+let g = fn() { for (i in [1, 2]) { yield i } };
+let h = {"k": {1, 2}};
+h[1:2:1];
+spawn f(1, 2);
+import "m";
+let m = macro(x) { quote(unquote(x)) };
+`
+
+// nodeTypes lists the types of package ast that implement Node, read from
+// its source so that new node types cannot be forgotten.
+func nodeTypes(t *testing.T) []string {
+    fset := gotoken.NewFileSet()
+    f, err := goparser.ParseFile(fset, "ast.go", nil, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var types []string
+    for _, decl := range f.Decls {
+        fn, ok := decl.(*goast.FuncDecl)
+        if !ok || fn.Recv == nil || fn.Name.Name != "Pos" {
+            continue
+        }
+        star := fn.Recv.List[0].Type.(*goast.StarExpr)
+        types = append(types, "*ast."+star.X.(*goast.Ident).Name)
+    }
+    sort.Strings(types)
+    return types
+}
+
+func TestInspectVisitsEveryNodeType(t *testing.T) {
+    seen := map[string]bool{}
+    ast.Inspect(monkeytest.MustParse(t, allNodes), func(node ast.Node) bool {
+        if node != nil {
+            seen[fmt.Sprintf("%T", node)] = true
+        }
+        return true
+    })
+
+    expected := nodeTypes(t)
+    if len(expected) < 20 {
+        t.Fatalf("found only %d node types: %v", len(expected), expected)
+    }
+    for _, typ := range expected {
+        if !seen[typ] {
+            t.Errorf("%s not visited", typ)
+        }
+    }
+}
+
+func TestInspectOrder(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {`let a = 1 + b;`, "let a = (1 + b) a (1 + b) 1 b"},
+        {`fn(x, y) { x }`, "fn(x, y) x x y x x"},
+        {`{"a": 1, "b": 2}`, `{a:1,b:2} a 1 b 2`},
+        {`if (c) { 1 } else { 2 }`, "ifc 1else 2 c 1 1 2 2"},
+        {`if (c) { 1 }`, "ifc 1 c 1 1"},
+        {`for (i in xs) { i }`, "for(i in xs) i i xs i i"},
+        {`s[1:]`, "(s[1:]) s 1"},
+        {`return x;`, "return x; x"},
+    }
+
+    for _, tt := range tests {
+        program := monkeytest.MustParse(t, tt.input)
+        var visited []string
+        ast.Inspect(program.Statements[0], func(node ast.Node) bool {
+            // An expression statement prints as its expression.
+            if _, ok := node.(*ast.ExpressionStatement); !ok && node != nil {
+                visited = append(visited, node.String())
+            }
+            return true
+        })
+        if got := strings.Join(visited, " "); got != tt.expected {
+            t.Errorf("%q:\n got %q\nwant %q", tt.input, got, tt.expected)
+        }
+    }
+}
+
+func TestInspectPrunes(t *testing.T) {
+    var visited []string
+    ast.Inspect(monkeytest.MustParse(t, `f(fn(x) { x + 1 }, 2)`), func(node ast.Node) bool {
+        if node == nil {
+            return true
+        }
+        visited = append(visited, fmt.Sprintf("%T", node))
+        _, isFunction := node.(*ast.FunctionLiteral)
+        return !isFunction
+    })
+
+    expected := []string{
+        "*ast.Program", "*ast.ExpressionStatement", "*ast.CallExpression",
+        "*ast.Identifier", "*ast.FunctionLiteral", "*ast.IntegerLiteral",
+    }
+    if !reflect.DeepEqual(visited, expected) {
+        t.Errorf("wrong nodes visited.\n got %v\nwant %v", visited, expected)
+    }
+}
+
+// depthVisitor records the depth of every node, which it tracks through
+// the nil visits that end each node.
+type depthVisitor struct {
+    depth  int
+    depths *[]int
+}
+
+func (v *depthVisitor) Visit(node ast.Node) ast.Visitor {
+    if node == nil {
+        return nil
+    }
+    *v.depths = append(*v.depths, v.depth)
+    return &depthVisitor{depth: v.depth + 1, depths: v.depths}
+}
+
+func TestWalk(t *testing.T) {
+    var depths []int
+    ast.Walk(&depthVisitor{depths: &depths}, monkeytest.MustParse(t, `-a + f(b)`))
+
+    // Program, statement, infix, prefix, a, call, f, b.
+    expected := []int{0, 1, 2, 3, 4, 3, 4, 4}
+    if !reflect.DeepEqual(depths, expected) {
+        t.Errorf("wrong depths. got=%v, want=%v", depths, expected)
+    }
+}
@@ -0,0 +1,263 @@
+package code
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+)
+
+// Instructions is a sequence of encoded instructions: an opcode byte
+// followed by its operands in big endian.
+type Instructions []byte
+
+func (ins Instructions) String() string {
+    var out bytes.Buffer
+
+    i := 0
+    for i < len(ins) {
+        def, err := Lookup(ins[i])
+        if err != nil {
+            fmt.Fprintf(&out, "ERROR: %s\n", err)
+            i++
+            continue
+        }
+
+        operands, read := ReadOperands(def, ins[i+1:])
+        fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+        i += 1 + read
+    }
+
+    return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+    operandCount := len(def.OperandWidths)
+
+    if len(operands) != operandCount {
+        return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+    }
+
+    switch operandCount {
+    case 0:
+        return def.Name
+    case 1:
+        return fmt.Sprintf("%s %d", def.Name, operands[0])
+    case 2:
+        return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+    }
+
+    return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+    OpConstant Opcode = iota
+    OpPop
+    OpTrue
+    OpFalse
+    OpNull
+
+    OpAdd
+    OpSub
+    OpMul
+    OpDiv
+    OpEqual
+    OpNotEqual
+    OpGreaterThan
+    OpLessThan
+    OpUnion
+    OpIntersection
+    OpRange
+    OpRangeInclusive
+
+    OpMinus
+    OpBang
+
+    OpJumpNotTruthy
+    OpJump
+
+    OpGetGlobal
+    OpSetGlobal
+    OpGetLocal
+    OpSetLocal
+    OpGetFree
+    OpCurrentClosure
+
+    OpArray
+    OpHash
+    OpSet
+    OpIndex
+    OpSlice
+
+    OpIter
+    OpIterNext
+
+    OpCall
+    OpReturnValue
+    OpClosure
+
+    OpGetLocalCell
+    OpGetFreeCell
+    OpGetLocalElse
+    OpGetFreeElse
+)
+
+// Slice flags, the operand of OpSlice, tell which bounds are on the stack.
+const (
+    SliceStart = 1 << iota
+    SliceEnd
+    SliceStep
+)
+
+type Definition struct {
+    Name string
+    OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+    OpConstant: {"OpConstant", []int{2}},
+    OpPop: {"OpPop", []int{}},
+    OpTrue: {"OpTrue", []int{}},
+    OpFalse: {"OpFalse", []int{}},
+    OpNull: {"OpNull", []int{}},
+
+    OpAdd: {"OpAdd", []int{}},
+    OpSub: {"OpSub", []int{}},
+    OpMul: {"OpMul", []int{}},
+    OpDiv: {"OpDiv", []int{}},
+    OpEqual: {"OpEqual", []int{}},
+    OpNotEqual: {"OpNotEqual", []int{}},
+    OpGreaterThan: {"OpGreaterThan", []int{}},
+    OpLessThan: {"OpLessThan", []int{}},
+    OpUnion: {"OpUnion", []int{}},
+    OpIntersection: {"OpIntersection", []int{}},
+    OpRange: {"OpRange", []int{}},
+    OpRangeInclusive: {"OpRangeInclusive", []int{}},
+
+    OpMinus: {"OpMinus", []int{}},
+    OpBang: {"OpBang", []int{}},
+
+    // Jump operands are absolute offsets into the instructions.
+    OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+    OpJump: {"OpJump", []int{2}},
+
+    OpGetGlobal: {"OpGetGlobal", []int{2}},
+    OpSetGlobal: {"OpSetGlobal", []int{2}},
+    OpGetLocal: {"OpGetLocal", []int{1}},
+    OpSetLocal: {"OpSetLocal", []int{1}},
+    OpGetFree: {"OpGetFree", []int{1}},
+    OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+    // OpArray, OpHash and OpSet take the number of stack values to collect,
+    // which for hashes is twice the number of pairs.
+    OpArray: {"OpArray", []int{2}},
+    OpHash: {"OpHash", []int{2}},
+    OpSet: {"OpSet", []int{2}},
+    OpIndex: {"OpIndex", []int{}},
+    OpSlice: {"OpSlice", []int{1}},
+
+    // OpIterNext pushes the next element of the iterator on top of the
+    // stack, or pops the iterator and jumps to its operand when it is done.
+    OpIter: {"OpIter", []int{}},
+    OpIterNext: {"OpIterNext", []int{2}},
+
+    OpCall: {"OpCall", []int{1}},
+    OpReturnValue: {"OpReturnValue", []int{}},
+    // OpClosure takes the constant index of the function and the number of
+    // free variables on the stack.
+    OpClosure: {"OpClosure", []int{2, 1}},
+
+    // Variables captured by closures live in cells shared with the function
+    // declaring them. OpGetLocalCell moves a local into a cell if it is not
+    // in one yet, and pushes the cell for OpClosure to capture, like
+    // OpGetFreeCell does for a free variable.
+    OpGetLocalCell: {"OpGetLocalCell", []int{1}},
+    OpGetFreeCell: {"OpGetFreeCell", []int{1}},
+    // OpGetLocalElse and OpGetFreeElse push a variable and jump to their
+    // second operand when it is set. Otherwise they go on with the next
+    // instruction, which loads the variable of the same name further out.
+    OpGetLocalElse: {"OpGetLocalElse", []int{1, 2}},
+    OpGetFreeElse: {"OpGetFreeElse", []int{1, 2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+    def, ok := definitions[Opcode(op)]
+    if !ok {
+        return nil, fmt.Errorf("opcode %d undefined", op)
+    }
+
+    return def, nil
+}
+
+// Make encodes an instruction, or returns an empty one for unknown opcodes.
+func Make(op Opcode, operands ...int) []byte {
+    def, ok := definitions[op]
+    if !ok {
+        return []byte{}
+    }
+
+    instructionLen := 1
+    for _, w := range def.OperandWidths {
+        instructionLen += w
+    }
+
+    instruction := make([]byte, instructionLen)
+    instruction[0] = byte(op)
+
+    offset := 1
+    for i, o := range operands {
+        width := def.OperandWidths[i]
+        switch width {
+        case 2:
+            binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+        case 1:
+            instruction[offset] = byte(o)
+        }
+        offset += width
+    }
+
+    return instruction
+}
+
+// CheckOperands returns an error if an operand of the instruction does not
+// fit in its width, which Make would silently truncate.
+func CheckOperands(op Opcode, operands ...int) error {
+    def, err := Lookup(byte(op))
+    if err != nil {
+        return err
+    }
+    for i, o := range operands {
+        max := 1<<(8*def.OperandWidths[i]) - 1
+        if o < 0 || o > max {
+            return fmt.Errorf("operand %d of %s out of range: %d, the maximum is %d", i, def.Name, o, max)
+        }
+    }
+    return nil
+}
+
+// ReadOperands decodes the operands of an instruction and returns them
+// with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+    operands := make([]int, len(def.OperandWidths))
+    offset := 0
+
+    for i, width := range def.OperandWidths {
+        switch width {
+        case 2:
+            operands[i] = int(ReadUint16(ins[offset:]))
+        case 1:
+            operands[i] = int(ReadUint8(ins[offset:]))
+        }
+        offset += width
+    }
+
+    return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+    return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
@@ -0,0 +1,119 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+    tests := []struct {
+        op Opcode
+        operands []int
+        expected []byte
+    }{
+        {OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+        {OpAdd, []int{}, []byte{byte(OpAdd)}},
+        {OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+        {OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+    }
+
+    for _, tt := range tests {
+        instruction := Make(tt.op, tt.operands...)
+
+        if len(instruction) != len(tt.expected) {
+            t.Errorf("instruction has wrong length. want=%d, got=%d",
+                len(tt.expected), len(instruction))
+            continue
+        }
+
+        for i, b := range tt.expected {
+            if instruction[i] != tt.expected[i] {
+                t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+                    i, b, instruction[i])
+            }
+        }
+    }
+}
+
+func TestInstructionsString(t *testing.T) {
+    instructions := []Instructions{
+        Make(OpAdd),
+        Make(OpGetLocal, 1),
+        Make(OpConstant, 2),
+        Make(OpConstant, 65535),
+        Make(OpClosure, 65535, 255),
+    }
+
+    expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+    concatted := Instructions{}
+    for _, ins := range instructions {
+        concatted = append(concatted, ins...)
+    }
+
+    if concatted.String() != expected {
+        t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+            expected, concatted.String())
+    }
+}
+
+func TestCheckOperands(t *testing.T) {
+    tests := []struct {
+        op Opcode
+        operands []int
+        expected string
+    }{
+        {OpConstant, []int{65535}, ""},
+        {OpConstant, []int{65536}, "operand 0 of OpConstant out of range: 65536, the maximum is 65535"},
+        {OpGetLocal, []int{256}, "operand 0 of OpGetLocal out of range: 256, the maximum is 255"},
+        {OpClosure, []int{1, 256}, "operand 1 of OpClosure out of range: 256, the maximum is 255"},
+        {OpJump, []int{-1}, "operand 0 of OpJump out of range: -1, the maximum is 65535"},
+    }
+
+    for _, tt := range tests {
+        err := CheckOperands(tt.op, tt.operands...)
+        if tt.expected == "" {
+            if err != nil {
+                t.Errorf("%v: unexpected error %s", tt.operands, err)
+            }
+            continue
+        }
+        if err == nil || err.Error() != tt.expected {
+            t.Errorf("%v: expected error %q, got %v", tt.operands, tt.expected, err)
+        }
+    }
+}
+
+func TestReadOperands(t *testing.T) {
+    tests := []struct {
+        op Opcode
+        operands []int
+        bytesRead int
+    }{
+        {OpConstant, []int{65535}, 2},
+        {OpGetLocal, []int{255}, 1},
+        {OpClosure, []int{65535, 255}, 3},
+    }
+
+    for _, tt := range tests {
+        instruction := Make(tt.op, tt.operands...)
+
+        def, err := Lookup(byte(tt.op))
+        if err != nil {
+            t.Fatalf("definition not found: %q\n", err)
+        }
+
+        operandsRead, n := ReadOperands(def, instruction[1:])
+        if n != tt.bytesRead {
+            t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+        }
+
+        for i, want := range tt.operands {
+            if operandsRead[i] != want {
+                t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+            }
+        }
+    }
+}
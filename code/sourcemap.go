@@ -0,0 +1,37 @@
+package code
+
+import "sort"
+
+// SourceLine says that the instructions from Offset on, up to the next
+// entry, were compiled from source line Line.
+type SourceLine struct {
+    Offset int
+    Line int
+}
+
+// SourceMap maps instruction offsets back to source lines. Its entries
+// are sorted by offset.
+type SourceMap []SourceLine
+
+// Add records that the instruction at offset comes from line. Offsets
+// must be added in increasing order; unknown lines (0) are ignored.
+func (m SourceMap) Add(offset, line int) SourceMap {
+    if line == 0 || (len(m) > 0 && m[len(m)-1].Line == line) {
+        return m
+    }
+    if len(m) > 0 && m[len(m)-1].Offset == offset {
+        m[len(m)-1].Line = line
+        return m
+    }
+    return append(m, SourceLine{Offset: offset, Line: line})
+}
+
+// Line returns the source line of the instruction at offset, or 0 if it
+// is not known.
+func (m SourceMap) Line(offset int) int {
+    i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+    if i == 0 {
+        return 0
+    }
+    return m[i-1].Line
+}
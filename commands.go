@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"necronet.info/interpreter/ast"
+	"necronet.info/interpreter/compiler"
+	"necronet.info/interpreter/evaluator"
+	"necronet.info/interpreter/format"
+	"necronet.info/interpreter/lexer"
+	"necronet.info/interpreter/lint"
+	"necronet.info/interpreter/object"
+	"necronet.info/interpreter/optimizer"
+	"necronet.info/interpreter/parser"
+	"necronet.info/interpreter/resolver"
+	"necronet.info/interpreter/vm"
+)
+
+// compileCommand compiles a script to a bytecode file.
+func compileCommand(args []string) error {
+	fs := flag.NewFlagSet("compile", flag.ContinueOnError)
+	out := fs.String("o", "", "output `file`")
+	optimize := fs.Bool("O", false, "optimize the script before compiling it")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("compile takes exactly one file\n%s", usage)
+	}
+	file := files[0]
+	if *out == "" {
+		*out = strings.TrimSuffix(file, filepath.Ext(file)) + ".mkc"
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if compiler.IsBytecode(source) {
+		return fmt.Errorf("%s: already compiled", file)
+	}
+	bytecode, err := loadBytecode(file, source, *optimize)
+	if err != nil {
+		return err
+	}
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return os.WriteFile(*out, data, 0644)
+}
+
+// runFileCommand runs a compiled file on the VM, or evaluates a script.
+// With -trace a script is compiled and run on the VM too, and every
+// instruction is logged to stderr. With -O a script is optimized first.
+func runFileCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	trace := fs.Bool("trace", false, "log every instruction the VM runs to stderr")
+	optimize := fs.Bool("O", false, "optimize the script before running it")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("run takes exactly one file\n%s", usage)
+	}
+	file := files[0]
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	interpreter := newInterpreter()
+
+	if !compiler.IsBytecode(data) && !*trace {
+		program, err := parseSource(file, string(data), *optimize)
+		if err != nil {
+			return err
+		}
+		result := interpreter.Eval(program, object.NewEnvironment())
+		if err, ok := result.(*object.Error); ok {
+			return fmt.Errorf("%s: %s", file, err.Message)
+		}
+		return nil
+	}
+
+	bytecode, err := loadBytecode(file, data, *optimize)
+	if err != nil {
+		return err
+	}
+	machine := vm.NewWithInterpreter(bytecode, interpreter)
+	if *trace {
+		machine.SetTrace(os.Stderr)
+	}
+	if err := machine.Run(); err != nil {
+		var runtimeErr *vm.RuntimeError
+		if errors.As(err, &runtimeErr) && runtimeErr.Line != 0 {
+			return fmt.Errorf("%s:%d: %s", file, runtimeErr.Line, err)
+		}
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return nil
+}
+
+// disasmCommand prints the bytecode listing of a script or compiled file.
+func disasmCommand(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	optimize := fs.Bool("O", false, "optimize the script before compiling it")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("disasm takes exactly one file\n%s", usage)
+	}
+	file := files[0]
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	bytecode, err := loadBytecode(file, data, *optimize)
+	if err != nil {
+		return err
+	}
+	return bytecode.Disassemble(os.Stdout)
+}
+
+// fmtCommand formats scripts and prints them. With -w the files that are
+// not formatted are rewritten instead, and with --check they are only
+// listed, which fails if there are any.
+func fmtCommand(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := fs.Bool("w", false, "write the result to the files instead of printing it")
+	check := fs.Bool("check", false, "list the files that are not formatted and fail if there are any")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("fmt takes at least one file\n%s", usage)
+	}
+
+	unformatted := 0
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		formatted, err := format.Source(source)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		changed := !bytes.Equal(source, formatted)
+
+		switch {
+		case *check:
+			if changed {
+				fmt.Println(file)
+				unformatted++
+			}
+		case *write:
+			if changed {
+				info, err := os.Stat(file)
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(file, formatted, info.Mode().Perm()); err != nil {
+					return err
+				}
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	if unformatted != 0 {
+		return fmt.Errorf("%d of %d files are not formatted", unformatted, len(files))
+	}
+	return nil
+}
+
+// lintCommand prints the problems the linter finds in scripts, and fails
+// if there are any. -enable runs only the listed rules, and -disable skips
+// the listed ones.
+func lintCommand(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	enable := fs.String("enable", "", "run only the rules of this comma-separated `list`")
+	disable := fs.String("disable", "", "skip the rules of this comma-separated `list`")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("lint takes at least one file\n%s", usage)
+	}
+
+	linter := lint.New()
+	if *enable != "" {
+		for _, rule := range lint.Rules {
+			linter.Disable(rule.ID)
+		}
+		for _, id := range strings.Split(*enable, ",") {
+			if err := linter.Enable(strings.TrimSpace(id)); err != nil {
+				return err
+			}
+		}
+	}
+	if *disable != "" {
+		for _, id := range strings.Split(*disable, ",") {
+			if err := linter.Disable(strings.TrimSpace(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	failed := 0
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return fmt.Errorf("%s: parser errors:\n\t%s", file, strings.Join(p.Errors(), "\n\t"))
+		}
+		diagnostics := linter.Lint(program)
+		for _, d := range diagnostics {
+			fmt.Printf("%s:%s\n", file, d)
+		}
+		if len(diagnostics) != 0 {
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d files have problems", failed, len(files))
+	}
+	return nil
+}
+
+// loadBytecode decodes a compiled file, or compiles a script, optimizing
+// it first if asked to.
+func loadBytecode(file string, data []byte, optimize bool) (*compiler.Bytecode, error) {
+	if compiler.IsBytecode(data) {
+		bytecode := &compiler.Bytecode{}
+		if err := bytecode.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		return bytecode, nil
+	}
+
+	program, err := parseSource(file, string(data), optimize)
+	if err != nil {
+		return nil, err
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// newInterpreter returns an interpreter configured from the environment,
+// like the one of the REPL.
+func newInterpreter() *evaluator.Interpreter {
+	interpreter := evaluator.New()
+	interpreter.SetSearchPath(filepath.SplitList(os.Getenv("MONKEYPATH")))
+	interpreter.SetStrict(os.Getenv("MONKEYSTRICT") != "")
+	return interpreter
+}
+
+// parseSource parses a script, expands its macros and checks that every
+// name it uses is declared, so that a misspelled name is reported before
+// anything runs.
+func parseSource(file, source string, optimize bool) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: parser errors:\n\t%s", file, strings.Join(p.Errors(), "\n\t"))
+	}
+	standard := evaluator.New()
+	program, err := standard.ExpandMacros(program, object.NewEnvironment())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	errs := resolver.Resolve(program, func(name string) bool {
+		_, ok := standard.Builtin(name)
+		return ok
+	})
+	if len(errs) != 0 {
+		messages := []string{}
+		for _, err := range errs {
+			messages = append(messages, fmt.Sprintf("%s:%s", file, err))
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+	if optimize {
+		program = optimizer.Optimize(program)
+	}
+	return program, nil
+}
+
+// parseArgs parses flags that may come before or after the positional
+// arguments, which it returns.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
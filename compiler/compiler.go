@@ -0,0 +1,556 @@
+package compiler
+
+import (
+    "fmt"
+    "math"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/object"
+)
+
+// Bytecode is a compiled program. The main program ends with
+// OpReturnValue, like a function body.
+type Bytecode struct {
+    Instructions code.Instructions
+    Constants []object.Object
+    // Globals names the global slots, so the VM can bind builtins to them
+    // and report globals read before they are set.
+    Globals []string
+    SourceMap code.SourceMap
+}
+
+type CompilationScope struct {
+    instructions code.Instructions
+    sourceMap code.SourceMap
+}
+
+// Compiler lowers an AST to bytecode. Programs compiled one after another
+// with the same compiler, as in the REPL, share their globals.
+type Compiler struct {
+    constants []object.Object
+
+    symbolTable *SymbolTable
+
+    scopes []CompilationScope
+    scopeIndex int
+
+    // line is the source line of the node being compiled.
+    line int
+
+    // err is the first operand that did not fit in its instruction.
+    err error
+}
+
+var infixOperators = map[string]code.Opcode{
+    "+": code.OpAdd,
+    "-": code.OpSub,
+    "*": code.OpMul,
+    "/": code.OpDiv,
+    "==": code.OpEqual,
+    "!=": code.OpNotEqual,
+    ">": code.OpGreaterThan,
+    "<": code.OpLessThan,
+    "|": code.OpUnion,
+    "&": code.OpIntersection,
+    "..": code.OpRange,
+    "..=": code.OpRangeInclusive,
+}
+
+func New() *Compiler {
+    mainScope := CompilationScope{instructions: code.Instructions{}}
+
+    return &Compiler{
+        constants: []object.Object{},
+        symbolTable: NewSymbolTable(),
+        scopes: []CompilationScope{mainScope},
+        scopeIndex: 0,
+    }
+}
+
+// NewWithState returns a compiler that continues from the globals and
+// constants of earlier compilations.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+    compiler := New()
+    compiler.symbolTable = s
+    compiler.constants = constants
+    return compiler
+}
+
+// SymbolTable returns the table of global names.
+func (c *Compiler) SymbolTable() *SymbolTable {
+    return c.symbolTable
+}
+
+// Compile compiles node, failing if the program is too large for the
+// operands of an instruction, like a constant index above 65535.
+func (c *Compiler) Compile(node ast.Node) error {
+    if c.err != nil {
+        return c.err
+    }
+    if err := c.compile(node); err != nil {
+        return err
+    }
+    return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+    if node == nil {
+        return fmt.Errorf("cannot compile a missing node")
+    }
+    if line := node.Pos().Line; line != 0 {
+        defer func(line int) { c.line = line }(c.line)
+        c.line = line
+    }
+
+    switch node := node.(type) {
+    case *ast.Program:
+        c.scopes[c.scopeIndex].instructions = code.Instructions{}
+        c.scopes[c.scopeIndex].sourceMap = nil
+        c.declare(node)
+        if err := c.compileBlock(node.Statements); err != nil {
+            return err
+        }
+        c.emit(code.OpReturnValue)
+
+    case *ast.BlockStatement:
+        return c.compileBlock(node.Statements)
+
+    case *ast.ExpressionStatement:
+        if err := c.Compile(node.Expression); err != nil {
+            return err
+        }
+        c.emit(code.OpPop)
+
+    case *ast.LetStatement:
+        if err := c.Compile(node.Value); err != nil {
+            return err
+        }
+        symbol := c.symbolTable.Define(node.Name.Value)
+        return c.storeSymbol(symbol)
+
+    case *ast.ReturnStatement:
+        if err := c.Compile(node.ReturnValue); err != nil {
+            return err
+        }
+        c.emit(code.OpReturnValue)
+
+    case *ast.IntegerLiteral:
+        integer := &object.Integer{Value: node.Value}
+        c.emit(code.OpConstant, c.addConstant(integer))
+
+    case *ast.StringLiteral:
+        str := &object.String{Value: node.Value}
+        c.emit(code.OpConstant, c.addConstant(str))
+
+    case *ast.Boolean:
+        if node.Value {
+            c.emit(code.OpTrue)
+        } else {
+            c.emit(code.OpFalse)
+        }
+
+    case *ast.PrefixExpression:
+        if err := c.Compile(node.Right); err != nil {
+            return err
+        }
+        switch node.Operator {
+        case "!":
+            c.emit(code.OpBang)
+        case "-":
+            c.emit(code.OpMinus)
+        default:
+            return fmt.Errorf("unknown operator %s", node.Operator)
+        }
+
+    case *ast.InfixExpression:
+        op, ok := infixOperators[node.Operator]
+        if !ok {
+            return fmt.Errorf("unknown operator %s", node.Operator)
+        }
+        if err := c.Compile(node.Left); err != nil {
+            return err
+        }
+        if err := c.Compile(node.Right); err != nil {
+            return err
+        }
+        c.emit(op)
+
+    case *ast.IfExpression:
+        if err := c.Compile(node.Condition); err != nil {
+            return err
+        }
+        jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+        if err := c.Compile(node.Consequence); err != nil {
+            return err
+        }
+        jumpPos := c.emit(code.OpJump, 9999)
+        c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+        if node.Alternative == nil {
+            c.emit(code.OpNull)
+        } else if err := c.Compile(node.Alternative); err != nil {
+            return err
+        }
+        c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+    case *ast.ForExpression:
+        return c.compileForExpression(node)
+
+    case *ast.Identifier:
+        c.loadIdentifier(node.Value)
+
+    case *ast.ArrayLiteral:
+        for _, el := range node.Elements {
+            if err := c.Compile(el); err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpArray, len(node.Elements))
+
+    case *ast.HashLiteral:
+        for _, pair := range node.Pairs {
+            if err := c.Compile(pair.Key); err != nil {
+                return err
+            }
+            if err := c.Compile(pair.Value); err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpHash, len(node.Pairs)*2)
+
+    case *ast.SetLiteral:
+        for _, el := range node.Elements {
+            if err := c.Compile(el); err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpSet, len(node.Elements))
+
+    case *ast.IndexExpression:
+        if err := c.Compile(node.Left); err != nil {
+            return err
+        }
+        if err := c.Compile(node.Index); err != nil {
+            return err
+        }
+        c.emit(code.OpIndex)
+
+    case *ast.SliceExpression:
+        if err := c.Compile(node.Left); err != nil {
+            return err
+        }
+        flags := 0
+        for i, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+            if bound == nil {
+                continue
+            }
+            if err := c.Compile(bound); err != nil {
+                return err
+            }
+            flags |= 1 << i
+        }
+        c.emit(code.OpSlice, flags)
+
+    case *ast.FunctionLiteral:
+        return c.compileFunctionLiteral(node)
+
+    case *ast.CallExpression:
+        if node.Calls("quote") {
+            return fmt.Errorf("quote is not supported by the compiler")
+        }
+        if len(node.Arguments) > math.MaxUint8 {
+            return fmt.Errorf("too many arguments: %d", len(node.Arguments))
+        }
+        if err := c.Compile(node.Function); err != nil {
+            return err
+        }
+        for _, a := range node.Arguments {
+            if err := c.Compile(a); err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpCall, len(node.Arguments))
+
+    case *ast.ImportExpression, *ast.ExportStatement:
+        return fmt.Errorf("modules are not supported by the compiler")
+    case *ast.YieldExpression:
+        return fmt.Errorf("generators are not supported by the compiler")
+    case *ast.SpawnExpression:
+        return fmt.Errorf("spawn is not supported by the compiler")
+    case *ast.MacroLiteral:
+        return fmt.Errorf("macros can only be defined by a top-level let")
+
+    default:
+        return fmt.Errorf("cannot compile %T", node)
+    }
+
+    return nil
+}
+
+// compileBlock leaves exactly one value on the stack: the value of the
+// last statement if it is an expression, NULL otherwise.
+func (c *Compiler) compileBlock(statements []ast.Statement) error {
+    if len(statements) == 0 {
+        c.emit(code.OpNull)
+        return nil
+    }
+    for i, s := range statements {
+        last := i == len(statements)-1
+        if es, ok := s.(*ast.ExpressionStatement); ok && last {
+            return c.Compile(es.Expression)
+        }
+        if err := c.Compile(s); err != nil {
+            return err
+        }
+        if last {
+            c.emit(code.OpNull)
+        }
+    }
+    return nil
+}
+
+// compileForExpression keeps the iterator on the stack while the loop
+// runs. Like in the evaluator, the loop variable lives in the enclosing
+// scope and the loop evaluates to NULL.
+func (c *Compiler) compileForExpression(node *ast.ForExpression) error {
+    if err := c.Compile(node.Iterable); err != nil {
+        return err
+    }
+    c.emit(code.OpIter)
+
+    loopStart := len(c.currentInstructions())
+    iterNextPos := c.emit(code.OpIterNext, 9999)
+    symbol := c.symbolTable.Define(node.Variable.Value)
+    if err := c.storeSymbol(symbol); err != nil {
+        return err
+    }
+    if err := c.Compile(node.Body); err != nil {
+        return err
+    }
+    c.emit(code.OpPop)
+    c.emit(code.OpJump, loopStart)
+    c.changeOperand(iterNextPos, len(c.currentInstructions()))
+
+    c.emit(code.OpNull)
+    return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+    if node.IsGenerator {
+        return fmt.Errorf("generators are not supported by the compiler")
+    }
+
+    c.enterScope()
+
+    if node.Name != "" {
+        c.symbolTable.DefineFunctionName(node.Name)
+    }
+    for _, p := range node.Parameters {
+        c.symbolTable.DefineParameter(p.Value)
+    }
+    c.declare(node.Body)
+
+    if err := c.compileBlock(node.Body.Statements); err != nil {
+        return err
+    }
+    c.emit(code.OpReturnValue)
+
+    freeSymbols := c.symbolTable.FreeSymbols
+    numLocals := c.symbolTable.numDefinitions
+    localNames := c.symbolTable.Names()
+    sourceMap := c.scopes[c.scopeIndex].sourceMap
+    instructions := c.leaveScope()
+
+    if numLocals > math.MaxUint8 {
+        return fmt.Errorf("too many local variables in function: %d", numLocals)
+    }
+    if len(freeSymbols) > math.MaxUint8 {
+        return fmt.Errorf("too many free variables in function: %d", len(freeSymbols))
+    }
+
+    for _, s := range freeSymbols {
+        c.loadCell(s)
+    }
+
+    compiledFn := &object.CompiledFunction{
+        Instructions: instructions,
+        NumLocals: numLocals,
+        NumParameters: len(node.Parameters),
+        Name: node.Name,
+        LocalNames: localNames,
+        SourceMap: sourceMap,
+    }
+
+    fnIndex := c.addConstant(compiledFn)
+    c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+    return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+    return &Bytecode{
+        Instructions: c.currentInstructions(),
+        Constants: c.constants,
+        Globals: c.symbolTable.Globals().Names(),
+        SourceMap: c.scopes[c.scopeIndex].sourceMap,
+    }
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+    c.constants = append(c.constants, obj)
+    return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+    ins := c.make(op, operands...)
+    return c.addInstruction(ins)
+}
+
+// make encodes an instruction, recording an operand that does not fit as
+// the error of the compilation.
+func (c *Compiler) make(op code.Opcode, operands ...int) []byte {
+    if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+        c.err = err
+    }
+    return code.Make(op, operands...)
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+    posNewInstruction := len(c.currentInstructions())
+    updatedInstructions := append(c.currentInstructions(), ins...)
+
+    scope := &c.scopes[c.scopeIndex]
+    scope.instructions = updatedInstructions
+    scope.sourceMap = scope.sourceMap.Add(posNewInstruction, c.line)
+
+    return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+    return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+    ins := c.currentInstructions()
+
+    for i := 0; i < len(newInstruction); i++ {
+        ins[pos+i] = newInstruction[i]
+    }
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+    op := code.Opcode(c.currentInstructions()[opPos])
+    newInstruction := c.make(op, operand)
+
+    c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+    scope := CompilationScope{instructions: code.Instructions{}}
+    c.scopes = append(c.scopes, scope)
+    c.scopeIndex++
+
+    c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+    instructions := c.currentInstructions()
+
+    c.scopes = c.scopes[:len(c.scopes)-1]
+    c.scopeIndex--
+
+    c.symbolTable = c.symbolTable.Outer
+
+    return instructions
+}
+
+// loadIdentifier loads the variable name refers to. When it may be read
+// before it is set, the variables of the same name further out are loaded
+// in turn until one is set, as the evaluator looks the name up when a
+// local is not set yet. Names declared nowhere are left to be bound to a
+// builtin by the VM, which fails like the evaluator otherwise.
+func (c *Compiler) loadIdentifier(name string) {
+    symbols, ok := c.symbolTable.Lookup(name)
+    if !ok {
+        symbols = []Symbol{c.symbolTable.Globals().Define(name)}
+    }
+
+    var fallbacks []int
+    for _, s := range symbols[:len(symbols)-1] {
+        switch s.Scope {
+        case LocalScope:
+            fallbacks = append(fallbacks, c.emit(code.OpGetLocalElse, s.Index, 9999))
+        case FreeScope:
+            fallbacks = append(fallbacks, c.emit(code.OpGetFreeElse, s.Index, 9999))
+        }
+    }
+    c.loadSymbol(symbols[len(symbols)-1])
+
+    end := len(c.currentInstructions())
+    for i, pos := range fallbacks {
+        op := code.Opcode(c.currentInstructions()[pos])
+        c.replaceInstruction(pos, c.make(op, symbols[i].Index, end))
+    }
+}
+
+// declare defines the variables declared by the lets and for loops of a
+// function body, or of the program, before compiling it. Like in the
+// evaluator, they are variables of the whole function, which closures
+// created before the let can see.
+func (c *Compiler) declare(node ast.Node) {
+    ast.Inspect(node, func(n ast.Node) bool {
+        switch n := n.(type) {
+        case *ast.FunctionLiteral, *ast.MacroLiteral:
+            return false
+        case *ast.LetStatement:
+            if n.Name != nil {
+                c.symbolTable.Define(n.Name.Value)
+            }
+        case *ast.ForExpression:
+            if n.Variable != nil {
+                c.symbolTable.Define(n.Variable.Value)
+            }
+        }
+        return true
+    })
+}
+
+// loadCell loads a variable for a closure to capture: the cell holding it,
+// or the current closure, which never changes.
+func (c *Compiler) loadCell(s Symbol) {
+    switch s.Scope {
+    case LocalScope:
+        c.emit(code.OpGetLocalCell, s.Index)
+    case FreeScope:
+        c.emit(code.OpGetFreeCell, s.Index)
+    case FunctionScope:
+        c.emit(code.OpCurrentClosure)
+    }
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+    switch s.Scope {
+    case GlobalScope:
+        c.emit(code.OpGetGlobal, s.Index)
+    case LocalScope:
+        c.emit(code.OpGetLocal, s.Index)
+    case FreeScope:
+        c.emit(code.OpGetFree, s.Index)
+    case FunctionScope:
+        c.emit(code.OpCurrentClosure)
+    }
+}
+
+func (c *Compiler) storeSymbol(s Symbol) error {
+    switch s.Scope {
+    case GlobalScope:
+        if s.Index > math.MaxUint16 {
+            return fmt.Errorf("too many global variables")
+        }
+        c.emit(code.OpSetGlobal, s.Index)
+    default:
+        c.emit(code.OpSetLocal, s.Index)
+    }
+    return nil
+}
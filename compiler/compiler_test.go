@@ -0,0 +1,431 @@
+package compiler
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/parser"
+)
+
+type compilerTestCase struct {
+    input string
+    expectedConstants []interface{}
+    expectedInstructions []code.Instructions
+}
+
+func TestCompiler(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input: "1 + 2",
+            expectedConstants: []interface{}{1, 2},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpAdd),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "1; 2",
+            expectedConstants: []interface{}{1, 2},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpPop),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "let x = 1;",
+            expectedConstants: []interface{}{1},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpSetGlobal, 0),
+                code.Make(code.OpNull),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "if (true) { 10 }; 3333;",
+            expectedConstants: []interface{}{10, 3333},
+            expectedInstructions: []code.Instructions{
+                // 0000
+                code.Make(code.OpTrue),
+                // 0001
+                code.Make(code.OpJumpNotTruthy, 10),
+                // 0004
+                code.Make(code.OpConstant, 0),
+                // 0007
+                code.Make(code.OpJump, 11),
+                // 0010
+                code.Make(code.OpNull),
+                // 0011
+                code.Make(code.OpPop),
+                // 0012
+                code.Make(code.OpConstant, 1),
+                // 0015
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "[1, 2][1:]",
+            expectedConstants: []interface{}{1, 2, 1},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpArray, 2),
+                code.Make(code.OpConstant, 2),
+                code.Make(code.OpSlice, code.SliceStart),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "for (x in xs) { x }",
+            expectedConstants: []interface{}{},
+            expectedInstructions: []code.Instructions{
+                // 0000
+                code.Make(code.OpGetGlobal, 1),
+                // 0003
+                code.Make(code.OpIter),
+                // 0004
+                code.Make(code.OpIterNext, 17),
+                // 0007
+                code.Make(code.OpSetGlobal, 0),
+                // 0010
+                code.Make(code.OpGetGlobal, 0),
+                // 0013
+                code.Make(code.OpPop),
+                // 0014
+                code.Make(code.OpJump, 4),
+                // 0017
+                code.Make(code.OpNull),
+                // 0018
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "fn(a) { fn(b) { a + b } }",
+            expectedConstants: []interface{}{
+                []code.Instructions{
+                    code.Make(code.OpGetFree, 0),
+                    code.Make(code.OpGetLocal, 0),
+                    code.Make(code.OpAdd),
+                    code.Make(code.OpReturnValue),
+                },
+                []code.Instructions{
+                    code.Make(code.OpGetLocalCell, 0),
+                    code.Make(code.OpClosure, 0, 1),
+                    code.Make(code.OpReturnValue),
+                },
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpClosure, 1, 0),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            // The local may be read before it is set, falling back to
+            // the global.
+            input: "let n = 1; fn() { let n = n }",
+            expectedConstants: []interface{}{
+                1,
+                []code.Instructions{
+                    // 0000
+                    code.Make(code.OpGetLocalElse, 0, 7),
+                    // 0004
+                    code.Make(code.OpGetGlobal, 0),
+                    // 0007
+                    code.Make(code.OpSetLocal, 0),
+                    code.Make(code.OpNull),
+                    code.Make(code.OpReturnValue),
+                },
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpSetGlobal, 0),
+                code.Make(code.OpClosure, 1, 0),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            // y is a local of the whole function, which the closure
+            // captures before the let.
+            input: "fn() { let f = fn() { y }; let y = 5 }",
+            expectedConstants: []interface{}{
+                []code.Instructions{
+                    code.Make(code.OpGetFree, 0),
+                    code.Make(code.OpReturnValue),
+                },
+                5,
+                []code.Instructions{
+                    code.Make(code.OpGetLocalCell, 1),
+                    code.Make(code.OpClosure, 0, 1),
+                    code.Make(code.OpSetLocal, 0),
+                    code.Make(code.OpConstant, 1),
+                    code.Make(code.OpSetLocal, 1),
+                    code.Make(code.OpNull),
+                    code.Make(code.OpReturnValue),
+                },
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpClosure, 2, 0),
+                code.Make(code.OpReturnValue),
+            },
+        },
+        {
+            input: "let countDown = fn(x) { countDown(x - 1) };",
+            expectedConstants: []interface{}{
+                1,
+                []code.Instructions{
+                    code.Make(code.OpCurrentClosure),
+                    code.Make(code.OpGetLocal, 0),
+                    code.Make(code.OpConstant, 0),
+                    code.Make(code.OpSub),
+                    code.Make(code.OpCall, 1),
+                    code.Make(code.OpReturnValue),
+                },
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpClosure, 1, 0),
+                code.Make(code.OpSetGlobal, 0),
+                code.Make(code.OpNull),
+                code.Make(code.OpReturnValue),
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        program := parse(tt.input)
+
+        compiler := New()
+        if err := compiler.Compile(program); err != nil {
+            t.Fatalf("compiler error: %s", err)
+        }
+
+        bytecode := compiler.Bytecode()
+        testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Instructions)
+        testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+    }
+}
+
+func TestCompilerGlobalNames(t *testing.T) {
+    compiler := New()
+    if err := compiler.Compile(parse("let a = 1; let b = len; a")); err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+
+    names := compiler.Bytecode().Globals
+    expected := []string{"a", "b", "len"}
+    if len(names) != len(expected) {
+        t.Fatalf("wrong globals. want=%v, got=%v", expected, names)
+    }
+    for i, name := range expected {
+        if names[i] != name {
+            t.Errorf("wrong global %d. want=%q, got=%q", i, name, names[i])
+        }
+    }
+}
+
+func TestResolveFree(t *testing.T) {
+    global := NewSymbolTable()
+    global.Define("a")
+
+    firstLocal := NewEnclosedSymbolTable(global)
+    firstLocal.Define("c")
+
+    secondLocal := NewEnclosedSymbolTable(firstLocal)
+    secondLocal.Define("e")
+
+    expected := []Symbol{
+        {Name: "a", Scope: GlobalScope, Index: 0},
+        {Name: "c", Scope: FreeScope, Index: 0},
+        {Name: "e", Scope: LocalScope, Index: 0},
+    }
+    for _, sym := range expected {
+        result, ok := secondLocal.Resolve(sym.Name)
+        if !ok {
+            t.Errorf("name %s not resolvable", sym.Name)
+            continue
+        }
+        if result != sym {
+            t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+        }
+    }
+
+    if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0] != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+        t.Errorf("wrong free symbols: %+v", secondLocal.FreeSymbols)
+    }
+}
+
+func TestDefineReusesSlot(t *testing.T) {
+    global := NewSymbolTable()
+    a := global.Define("a")
+    global.Define("b")
+
+    if again := global.Define("a"); again != a {
+        t.Errorf("expected redefinition to reuse %+v, got=%+v", a, again)
+    }
+
+    local := NewEnclosedSymbolTable(global)
+    if shadow := local.Define("a"); shadow.Scope != LocalScope || shadow.Index != 0 {
+        t.Errorf("expected a local to shadow the global, got=%+v", shadow)
+    }
+}
+
+func TestUnsupportedNodes(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`import "x"`, "modules are not supported by the compiler"},
+        {`fn() { yield 1 }`, "generators are not supported by the compiler"},
+        {`spawn f()`, "spawn is not supported by the compiler"},
+        {`quote(1 + 2)`, "quote is not supported by the compiler"},
+        {`fn() { macro() { quote(1) } }`, "macros can only be defined by a top-level let"},
+    }
+
+    for _, tt := range tests {
+        err := New().Compile(parse(tt.input))
+        if err == nil || err.Error() != tt.expected {
+            t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+        }
+    }
+}
+
+func parse(input string) *ast.Program {
+    l := lexer.New(input)
+    p := parser.New(l)
+    return p.ParseProgram()
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+    t.Helper()
+    concatted := code.Instructions{}
+    for _, ins := range expected {
+        concatted = append(concatted, ins...)
+    }
+
+    if concatted.String() != actual.String() {
+        t.Errorf("%q: wrong instructions.\nwant=\n%s\ngot=\n%s", input, concatted, actual)
+    }
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+    t.Helper()
+    if len(expected) != len(actual) {
+        t.Errorf("%q: wrong number of constants. want=%d, got=%d", input, len(expected), len(actual))
+        return
+    }
+
+    for i, constant := range expected {
+        switch constant := constant.(type) {
+        case int:
+            integer, ok := actual[i].(*object.Integer)
+            if !ok || integer.Value != int64(constant) {
+                t.Errorf("%q: constant %d - expected %d, got %s", input, i, constant, actual[i].Inspect())
+            }
+        case []code.Instructions:
+            fn, ok := actual[i].(*object.CompiledFunction)
+            if !ok {
+                t.Errorf("%q: constant %d - not a function: %T", input, i, actual[i])
+                continue
+            }
+            testInstructions(t, input, constant, fn.Instructions)
+        }
+    }
+}
+
+func TestLookup(t *testing.T) {
+    global := NewSymbolTable()
+    global.Define("x")
+
+    outer := NewEnclosedSymbolTable(global)
+    outer.DefineParameter("p")
+    outer.Define("x")
+    outer.Define("q")
+
+    inner := NewEnclosedSymbolTable(outer)
+    inner.Define("x")
+    inner.Define("p")
+    inner.Define("q")
+
+    tests := []struct {
+        name string
+        expected []Symbol
+    }{
+        {"x", []Symbol{
+            {Name: "x", Scope: LocalScope, Index: 0},
+            {Name: "x", Scope: FreeScope, Index: 0},
+            {Name: "x", Scope: GlobalScope, Index: 0},
+        }},
+        // A parameter is always set, so nothing further out is needed.
+        {"p", []Symbol{
+            {Name: "p", Scope: LocalScope, Index: 1},
+            {Name: "p", Scope: FreeScope, Index: 1},
+        }},
+        {"q", []Symbol{
+            {Name: "q", Scope: LocalScope, Index: 2},
+            {Name: "q", Scope: FreeScope, Index: 2},
+        }},
+    }
+    for _, tt := range tests {
+        symbols, ok := inner.Lookup(tt.name)
+        if !ok || len(symbols) != len(tt.expected) {
+            t.Errorf("%s: expected %+v, got=%+v", tt.name, tt.expected, symbols)
+            continue
+        }
+        for i, sym := range tt.expected {
+            if symbols[i] != sym {
+                t.Errorf("%s: expected %+v, got=%+v", tt.name, tt.expected, symbols)
+                break
+            }
+        }
+    }
+
+    if _, ok := inner.Lookup("y"); ok {
+        t.Errorf("y found")
+    }
+}
+
+// name returns a distinct identifier for each i, as identifiers cannot
+// hold digits.
+func name(i int) string {
+    n := "v"
+    for {
+        n += string(rune('a' + i%26))
+        i /= 26
+        if i == 0 {
+            return n
+        }
+    }
+}
+
+func TestOperandsOutOfRange(t *testing.T) {
+    var lets, statements strings.Builder
+    for i := 0; i < 70000; i++ {
+        fmt.Fprintf(&lets, "let %s = %d; ", name(i), i)
+        statements.WriteString("true; ")
+    }
+    elements := strings.Repeat("true, ", 69999) + "true"
+
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {lets.String(), "operand 0 of OpConstant out of range: 65536, the maximum is 65535"},
+        {"[" + elements + "]", "operand 0 of OpArray out of range: 70000, the maximum is 65535"},
+        {"if (true) { " + statements.String() + "}", "operand 0 of OpJumpNotTruthy out of range"},
+    }
+
+    for _, tt := range tests {
+        err := New().Compile(parse(tt.input))
+        if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+            t.Errorf("%.20q...: expected error %q, got %v", tt.input, tt.expected, err)
+        }
+    }
+}
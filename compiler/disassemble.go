@@ -0,0 +1,135 @@
+package compiler
+
+import (
+    "fmt"
+    "io"
+    "strings"
+
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/object"
+)
+
+// MainFunction returns the main program as a function named main, so that
+// it can be run and listed like the functions in the constants pool.
+func (b *Bytecode) MainFunction() *object.CompiledFunction {
+    return &object.CompiledFunction{Name: "main", Instructions: b.Instructions, SourceMap: b.SourceMap}
+}
+
+// Disassemble writes a listing of the main program followed by every
+// compiled function in the constants pool. Each instruction shows its
+// offset, its source line ("|" when unchanged) and its operands, resolved
+// to the constants, globals and locals they refer to.
+func (b *Bytecode) Disassemble(w io.Writer) error {
+    if err := b.disassembleFunction(w, "main program", b.MainFunction()); err != nil {
+        return err
+    }
+    for i, constant := range b.Constants {
+        fn, ok := constant.(*object.CompiledFunction)
+        if !ok {
+            continue
+        }
+        title := fmt.Sprintf("fn %s/%d (constant %d)", functionName(fn), fn.NumParameters, i)
+        if _, err := io.WriteString(w, "\n"); err != nil {
+            return err
+        }
+        if err := b.disassembleFunction(w, title, fn); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (b *Bytecode) disassembleFunction(w io.Writer, title string, fn *object.CompiledFunction) error {
+    var out strings.Builder
+    fmt.Fprintf(&out, "== %s ==\n", title)
+
+    lastLine := -1
+    for offset := 0; offset < len(fn.Instructions); {
+        text, width := b.FormatInstruction(fn, offset)
+
+        line := "   |"
+        if l := fn.SourceMap.Line(offset); l != lastLine {
+            line = fmt.Sprintf("%4d", l)
+            lastLine = l
+        }
+        fmt.Fprintf(&out, "%04d %s %s\n", offset, line, text)
+
+        offset += width
+    }
+
+    _, err := io.WriteString(w, out.String())
+    return err
+}
+
+// FormatInstruction formats the instruction of fn at offset, and returns
+// it with the number of bytes it takes.
+func (b *Bytecode) FormatInstruction(fn *object.CompiledFunction, offset int) (string, int) {
+    ins := fn.Instructions
+    def, err := code.Lookup(ins[offset])
+    if err != nil {
+        return fmt.Sprintf("ERROR: %s", err), 1
+    }
+    width := 1
+    for _, w := range def.OperandWidths {
+        width += w
+    }
+    if offset+width > len(ins) {
+        return fmt.Sprintf("ERROR: truncated %s", def.Name), len(ins) - offset
+    }
+
+    operands, _ := code.ReadOperands(def, ins[offset+1:])
+    text := def.Name
+    for _, operand := range operands {
+        text += fmt.Sprintf(" %d", operand)
+    }
+    if comment := b.operandComment(fn, code.Opcode(ins[offset]), operands); comment != "" {
+        text += " (" + comment + ")"
+    }
+    return text, width
+}
+
+func (b *Bytecode) operandComment(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+    switch op {
+    case code.OpConstant:
+        if operands[0] < len(b.Constants) {
+            return formatConstant(b.Constants[operands[0]])
+        }
+    case code.OpClosure:
+        if operands[0] < len(b.Constants) {
+            if closure, ok := b.Constants[operands[0]].(*object.CompiledFunction); ok {
+                return fmt.Sprintf("fn %s/%d", functionName(closure), closure.NumParameters)
+            }
+        }
+    case code.OpGetGlobal, code.OpSetGlobal:
+        if operands[0] < len(b.Globals) {
+            return b.Globals[operands[0]]
+        }
+    case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalCell, code.OpGetLocalElse:
+        if operands[0] < len(fn.LocalNames) {
+            return fn.LocalNames[operands[0]]
+        }
+    case code.OpSlice:
+        bounds := []string{}
+        for i, name := range []string{"start", "end", "step"} {
+            if operands[0]&(1<<i) != 0 {
+                bounds = append(bounds, name)
+            }
+        }
+        return strings.Join(bounds, ", ")
+    }
+    return ""
+}
+
+func formatConstant(constant object.Object) string {
+    if str, ok := constant.(*object.String); ok {
+        return fmt.Sprintf("%q", str.Value)
+    }
+    return constant.Inspect()
+}
+
+func functionName(fn *object.CompiledFunction) string {
+    if fn.Name == "" {
+        return "anonymous"
+    }
+    return fn.Name
+}
@@ -0,0 +1,45 @@
+package compiler
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDisassemble(t *testing.T) {
+    bytecode := compileForTest(t, `let s = "hi";
+let add = fn(a, b) {
+    a + b
+};
+add(1, len(s))[0:1]`)
+
+    expected := `== main program ==
+0000    1 OpConstant 0 ("hi")
+0003    | OpSetGlobal 0 (s)
+0006    2 OpClosure 1 0 (fn add/2)
+0010    | OpSetGlobal 1 (add)
+0013    5 OpGetGlobal 1 (add)
+0016    | OpConstant 2 (1)
+0019    | OpGetGlobal 2 (len)
+0022    | OpGetGlobal 0 (s)
+0025    | OpCall 1
+0027    | OpCall 2
+0029    | OpConstant 3 (0)
+0032    | OpConstant 4 (1)
+0035    | OpSlice 3 (start, end)
+0037    1 OpReturnValue
+
+== fn add/2 (constant 1) ==
+0000    3 OpGetLocal 0 (a)
+0002    | OpGetLocal 1 (b)
+0004    | OpAdd
+0005    2 OpReturnValue
+`
+
+    var out strings.Builder
+    if err := bytecode.Disassemble(&out); err != nil {
+        t.Fatal(err)
+    }
+    if out.String() != expected {
+        t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+    }
+}
@@ -0,0 +1,472 @@
+package compiler
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash/crc32"
+
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/object"
+)
+
+// The binary format of a Bytecode is:
+//
+//     magic    "MKC\x00"
+//     version  uint16, big endian
+//     program  instructions, source map, global names, constants
+//     checksum uint32, big endian: CRC-32 (IEEE) of everything before it
+//
+// Counts, lengths and integers are varints. Each constant starts with a
+// tag byte; compiled functions hold their own instructions and source map.
+const (
+    Magic = "MKC\x00"
+    Version = 1
+)
+
+const (
+    constantInteger byte = 'i'
+    constantString byte = 's'
+    constantFunction byte = 'f'
+)
+
+// ErrInvalidBytecode is wrapped by the errors UnmarshalBinary returns for
+// data that is not a valid compiled program.
+var ErrInvalidBytecode = errors.New("invalid bytecode")
+
+// IsBytecode reports whether data starts like a compiled program.
+func IsBytecode(data []byte) bool {
+    return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// MarshalBinary encodes the bytecode in the format described above.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+    e := &encoder{}
+    e.buf.WriteString(Magic)
+    e.buf.Write([]byte{Version >> 8, Version & 0xff})
+
+    e.instructions(b.Instructions)
+    e.sourceMap(b.SourceMap)
+    e.strings(b.Globals)
+
+    e.uvarint(uint64(len(b.Constants)))
+    for _, constant := range b.Constants {
+        switch constant := constant.(type) {
+        case *object.Integer:
+            e.buf.WriteByte(constantInteger)
+            e.varint(constant.Value)
+        case *object.String:
+            e.buf.WriteByte(constantString)
+            e.string(constant.Value)
+        case *object.CompiledFunction:
+            e.buf.WriteByte(constantFunction)
+            e.string(constant.Name)
+            e.uvarint(uint64(constant.NumLocals))
+            e.uvarint(uint64(constant.NumParameters))
+            e.strings(constant.LocalNames)
+            e.instructions(constant.Instructions)
+            e.sourceMap(constant.SourceMap)
+        default:
+            return nil, fmt.Errorf("cannot serialize constant of type %s", constant.Type())
+        }
+    }
+
+    checksum := crc32.ChecksumIEEE(e.buf.Bytes())
+    binary.Write(&e.buf, binary.BigEndian, checksum)
+    return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes bytecode written by MarshalBinary. It checks
+// the header and checksum, and that every instruction is well formed, so
+// that a corrupted file is reported instead of crashing the VM.
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+    if !IsBytecode(data) {
+        return fmt.Errorf("%w: bad header", ErrInvalidBytecode)
+    }
+    if len(data) < len(Magic)+2+4 {
+        return fmt.Errorf("%w: truncated", ErrInvalidBytecode)
+    }
+    version := binary.BigEndian.Uint16(data[len(Magic):])
+    if version != Version {
+        return fmt.Errorf("%w: unsupported version %d, want %d", ErrInvalidBytecode, version, Version)
+    }
+    body, trailer := data[:len(data)-4], data[len(data)-4:]
+    if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(trailer) {
+        return fmt.Errorf("%w: checksum mismatch", ErrInvalidBytecode)
+    }
+
+    d := &decoder{data: body[len(Magic)+2:]}
+    decoded := &Bytecode{
+        Instructions: d.instructions(),
+        SourceMap: d.sourceMap(),
+        Globals: d.strings(),
+    }
+
+    numConstants := d.count()
+    decoded.Constants = make([]object.Object, 0, numConstants)
+    for i := 0; i < numConstants && d.err == nil; i++ {
+        switch tag := d.byte(); tag {
+        case constantInteger:
+            decoded.Constants = append(decoded.Constants, object.NewInteger(d.varint()))
+        case constantString:
+            decoded.Constants = append(decoded.Constants, &object.String{Value: d.string()})
+        case constantFunction:
+            fn := &object.CompiledFunction{Name: d.string()}
+            fn.NumLocals = d.count()
+            fn.NumParameters = d.count()
+            fn.LocalNames = d.strings()
+            fn.Instructions = d.instructions()
+            fn.SourceMap = d.sourceMap()
+            decoded.Constants = append(decoded.Constants, fn)
+        default:
+            d.fail("unknown constant tag %d", tag)
+        }
+    }
+    if d.err == nil && len(d.data) != 0 {
+        d.fail("%d trailing bytes", len(d.data))
+    }
+    if d.err != nil {
+        return d.err
+    }
+
+    if err := decoded.validate(); err != nil {
+        return err
+    }
+    *b = *decoded
+    return nil
+}
+
+// validate checks that the instructions only refer to constants, globals,
+// locals and free variables that exist, only jump to the start of an
+// instruction and never pop more values than they pushed.
+func (b *Bytecode) validate() error {
+    // closures maps the functions to the fewest free variables an
+    // OpClosure creates them with.
+    closures := make(map[int]int)
+    numFree, err := b.validateInstructions("main program", b.Instructions, 0, closures)
+    if err != nil {
+        return err
+    }
+    if numFree != 0 {
+        return fmt.Errorf("%w: main program: free variable %d out of range", ErrInvalidBytecode, numFree-1)
+    }
+    // The free variables a function reads are only checked once every
+    // OpClosure has been seen, as it may be created after its constant;
+    // a function no OpClosure creates has none.
+    reads := make(map[int]int)
+    for i, constant := range b.Constants {
+        fn, ok := constant.(*object.CompiledFunction)
+        if !ok {
+            continue
+        }
+        if fn.NumParameters > fn.NumLocals || len(fn.LocalNames) != fn.NumLocals {
+            return fmt.Errorf("%w: constant %d: inconsistent locals", ErrInvalidBytecode, i)
+        }
+        numFree, err := b.validateInstructions(fmt.Sprintf("constant %d", i), fn.Instructions, fn.NumLocals, closures)
+        if err != nil {
+            return err
+        }
+        reads[i] = numFree
+    }
+    for i := range b.Constants {
+        if numFree, created := reads[i], closures[i]; numFree > created {
+            return fmt.Errorf("%w: constant %d: free variable %d out of range, created with %d",
+                ErrInvalidBytecode, i, numFree-1, created)
+        }
+    }
+    return nil
+}
+
+// validateInstructions checks the instructions of one function and
+// returns how many free variables they read.
+func (b *Bytecode) validateInstructions(where string, ins code.Instructions, numLocals int, closures map[int]int) (int, error) {
+    fail := func(offset int, format string, a ...interface{}) (int, error) {
+        return 0, fmt.Errorf("%w: %s at %04d: %s", ErrInvalidBytecode, where, offset, fmt.Sprintf(format, a...))
+    }
+
+    // next maps the start of each instruction to the start of the one
+    // after it.
+    decoded := make(map[int][]int)
+    next := make(map[int]int)
+    numFree := 0
+    for i := 0; i < len(ins); {
+        def, err := code.Lookup(ins[i])
+        if err != nil {
+            return fail(i, "%s", err)
+        }
+        width := 0
+        for _, w := range def.OperandWidths {
+            width += w
+        }
+        if i+1+width > len(ins) {
+            return fail(i, "truncated %s", def.Name)
+        }
+        operands, _ := code.ReadOperands(def, ins[i+1:])
+
+        switch code.Opcode(ins[i]) {
+        case code.OpConstant:
+            if operands[0] >= len(b.Constants) {
+                return fail(i, "constant %d out of range", operands[0])
+            }
+        case code.OpClosure:
+            if operands[0] >= len(b.Constants) {
+                return fail(i, "constant %d out of range", operands[0])
+            }
+            if _, ok := b.Constants[operands[0]].(*object.CompiledFunction); !ok {
+                return fail(i, "constant %d is not a function", operands[0])
+            }
+            if created, ok := closures[operands[0]]; !ok || operands[1] < created {
+                closures[operands[0]] = operands[1]
+            }
+        case code.OpGetGlobal, code.OpSetGlobal:
+            if operands[0] >= len(b.Globals) {
+                return fail(i, "global %d out of range", operands[0])
+            }
+        case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalCell, code.OpGetLocalElse:
+            if operands[0] >= numLocals {
+                return fail(i, "local %d out of range", operands[0])
+            }
+        case code.OpGetFree, code.OpGetFreeCell, code.OpGetFreeElse:
+            if operands[0] >= numFree {
+                numFree = operands[0] + 1
+            }
+        }
+
+        decoded[i] = operands
+        next[i] = i + 1 + width
+        i += 1 + width
+    }
+    if len(ins) == 0 || code.Opcode(ins[len(ins)-1]) != code.OpReturnValue {
+        return fail(len(ins), "missing OpReturnValue at the end")
+    }
+
+    // Follow every path through the instructions, tracking how many values
+    // the function has on the stack before each of them. Paths that meet
+    // must agree on it, as the compiler never leaves values behind.
+    depths := map[int]int{0: 0}
+    work := []int{0}
+    reach := func(offset, depth int) error {
+        if _, ok := decoded[offset]; !ok {
+            _, err := fail(offset, "jump into the middle of an instruction")
+            return err
+        }
+        if known, ok := depths[offset]; ok {
+            if known != depth {
+                _, err := fail(offset, "stack depth %d on one path and %d on another", known, depth)
+                return err
+            }
+            return nil
+        }
+        depths[offset] = depth
+        work = append(work, offset)
+        return nil
+    }
+    for len(work) != 0 {
+        i := work[len(work)-1]
+        work = work[:len(work)-1]
+        op := code.Opcode(ins[i])
+        operands := decoded[i]
+        depth := depths[i]
+
+        pops, pushes := stackEffect(op, operands)
+        if depth < pops {
+            def, _ := code.Lookup(ins[i])
+            return fail(i, "%s pops %d, the stack holds %d", def.Name, pops, depth)
+        }
+        depth += pushes - pops
+
+        var err error
+        switch op {
+        case code.OpReturnValue:
+            continue
+        case code.OpJump:
+            err = reach(operands[0], depth)
+        case code.OpJumpNotTruthy:
+            err = reach(operands[0], depth)
+        case code.OpIterNext:
+            // Only the path going on with the next element keeps the
+            // iterator, with the element on top of it.
+            err = reach(operands[0], depth-2)
+        case code.OpGetLocalElse, code.OpGetFreeElse:
+            err = reach(operands[1], depth+1)
+        }
+        if err == nil && op != code.OpJump && next[i] < len(ins) {
+            err = reach(next[i], depth)
+        }
+        if err != nil {
+            return 0, err
+        }
+    }
+    return numFree, nil
+}
+
+// stackEffect returns how many values an instruction pops and pushes when
+// it goes on with the next instruction.
+func stackEffect(op code.Opcode, operands []int) (int, int) {
+    switch op {
+    case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpReturnValue:
+        return 1, 0
+    case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+        code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+        code.OpUnion, code.OpIntersection, code.OpRange, code.OpRangeInclusive,
+        code.OpIndex:
+        return 2, 1
+    case code.OpMinus, code.OpBang, code.OpIter:
+        return 1, 1
+    case code.OpArray, code.OpHash, code.OpSet:
+        return operands[0], 1
+    case code.OpSlice:
+        pops := 1
+        for flags := operands[0] & (code.SliceStart | code.SliceEnd | code.SliceStep); flags != 0; flags >>= 1 {
+            pops += flags & 1
+        }
+        return pops, 1
+    case code.OpIterNext:
+        return 1, 2
+    case code.OpCall:
+        return operands[0] + 1, 1
+    case code.OpClosure:
+        return operands[1], 1
+    case code.OpJump, code.OpGetLocalElse, code.OpGetFreeElse:
+        return 0, 0
+    default:
+        return 0, 1
+    }
+}
+
+type encoder struct {
+    buf bytes.Buffer
+}
+
+func (e *encoder) uvarint(x uint64) {
+    var b [binary.MaxVarintLen64]byte
+    e.buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func (e *encoder) varint(x int64) {
+    var b [binary.MaxVarintLen64]byte
+    e.buf.Write(b[:binary.PutVarint(b[:], x)])
+}
+
+func (e *encoder) string(s string) {
+    e.uvarint(uint64(len(s)))
+    e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(ss []string) {
+    e.uvarint(uint64(len(ss)))
+    for _, s := range ss {
+        e.string(s)
+    }
+}
+
+func (e *encoder) instructions(ins code.Instructions) {
+    e.uvarint(uint64(len(ins)))
+    e.buf.Write(ins)
+}
+
+func (e *encoder) sourceMap(m code.SourceMap) {
+    e.uvarint(uint64(len(m)))
+    for _, entry := range m {
+        e.uvarint(uint64(entry.Offset))
+        e.uvarint(uint64(entry.Line))
+    }
+}
+
+// decoder reads what encoder wrote. After the first failure it only
+// returns zero values, so callers can check err once at the end.
+type decoder struct {
+    data []byte
+    err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+    if d.err == nil {
+        d.err = fmt.Errorf("%w: %s", ErrInvalidBytecode, fmt.Sprintf(format, a...))
+    }
+    d.data = nil
+}
+
+func (d *decoder) uvarint() uint64 {
+    if d.err != nil {
+        return 0
+    }
+    x, n := binary.Uvarint(d.data)
+    if n <= 0 {
+        d.fail("malformed number")
+        return 0
+    }
+    d.data = d.data[n:]
+    return x
+}
+
+func (d *decoder) varint() int64 {
+    if d.err != nil {
+        return 0
+    }
+    x, n := binary.Varint(d.data)
+    if n <= 0 {
+        d.fail("malformed number")
+        return 0
+    }
+    d.data = d.data[n:]
+    return x
+}
+
+// count reads a length, which can never exceed the bytes left since every
+// counted item takes at least one byte.
+func (d *decoder) count() int {
+    n := d.uvarint()
+    if n > uint64(len(d.data)) {
+        d.fail("length %d exceeds the data left", n)
+        return 0
+    }
+    return int(n)
+}
+
+func (d *decoder) byte() byte {
+    if d.err != nil {
+        return 0
+    }
+    if len(d.data) == 0 {
+        d.fail("truncated")
+        return 0
+    }
+    b := d.data[0]
+    d.data = d.data[1:]
+    return b
+}
+
+func (d *decoder) bytes() []byte {
+    n := d.count()
+    b := d.data[:n:n]
+    d.data = d.data[n:]
+    return b
+}
+
+func (d *decoder) string() string {
+    return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+    n := d.count()
+    ss := make([]string, 0, n)
+    for i := 0; i < n && d.err == nil; i++ {
+        ss = append(ss, d.string())
+    }
+    return ss
+}
+
+func (d *decoder) instructions() code.Instructions {
+    return append(code.Instructions{}, d.bytes()...)
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+    n := d.count()
+    var m code.SourceMap
+    for i := 0; i < n && d.err == nil; i++ {
+        m = append(m, code.SourceLine{Offset: int(d.uvarint()), Line: int(d.uvarint())})
+    }
+    return m
+}
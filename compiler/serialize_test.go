@@ -0,0 +1,321 @@
+package compiler
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "hash/crc32"
+    "strings"
+    "testing"
+
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/object"
+)
+
+const serializeInput = `let greeting = "hello";
+let add = fn(a, b) {
+    let sum = a + b;
+    sum
+};
+let adder = fn(x) { fn(y) { add(x, y) } };
+adder(-1)(len(greeting))
+`
+
+func compileForTest(t *testing.T, input string) *Bytecode {
+    t.Helper()
+    compiler := New()
+    if err := compiler.Compile(parse(input)); err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+    return compiler.Bytecode()
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+    original := compileForTest(t, serializeInput)
+
+    data, err := original.MarshalBinary()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IsBytecode(data) {
+        t.Fatalf("serialized bytecode does not start with the magic header")
+    }
+
+    decoded := &Bytecode{}
+    if err := decoded.UnmarshalBinary(data); err != nil {
+        t.Fatal(err)
+    }
+
+    if !bytes.Equal(decoded.Instructions, original.Instructions) {
+        t.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", original.Instructions, decoded.Instructions)
+    }
+    testSourceMap(t, "main program", original.SourceMap, decoded.SourceMap)
+    if len(decoded.Globals) != len(original.Globals) {
+        t.Fatalf("wrong globals. want=%v, got=%v", original.Globals, decoded.Globals)
+    }
+    for i := range original.Globals {
+        if decoded.Globals[i] != original.Globals[i] {
+            t.Errorf("wrong global %d. want=%q, got=%q", i, original.Globals[i], decoded.Globals[i])
+        }
+    }
+
+    if len(decoded.Constants) != len(original.Constants) {
+        t.Fatalf("wrong number of constants. want=%d, got=%d", len(original.Constants), len(decoded.Constants))
+    }
+    for i, constant := range original.Constants {
+        fn, ok := constant.(*object.CompiledFunction)
+        if !ok {
+            if !object.Equals(constant, decoded.Constants[i]) {
+                t.Errorf("constant %d: want=%s, got=%s", i, constant.Inspect(), decoded.Constants[i].Inspect())
+            }
+            continue
+        }
+        decodedFn, ok := decoded.Constants[i].(*object.CompiledFunction)
+        if !ok {
+            t.Errorf("constant %d: not a function: %T", i, decoded.Constants[i])
+            continue
+        }
+        if decodedFn.Inspect() != fn.Inspect() || decodedFn.NumLocals != fn.NumLocals ||
+            len(decodedFn.LocalNames) != len(fn.LocalNames) {
+            t.Errorf("constant %d: want=%+v, got=%+v", i, fn, decodedFn)
+        }
+        if !bytes.Equal(decodedFn.Instructions, fn.Instructions) {
+            t.Errorf("constant %d: wrong instructions.\nwant=\n%s\ngot=\n%s", i, fn.Instructions, decodedFn.Instructions)
+        }
+        testSourceMap(t, fn.Inspect(), fn.SourceMap, decodedFn.SourceMap)
+    }
+}
+
+func TestSourceMapLines(t *testing.T) {
+    bytecode := compileForTest(t, serializeInput)
+
+    var add *object.CompiledFunction
+    for _, constant := range bytecode.Constants {
+        if fn, ok := constant.(*object.CompiledFunction); ok && fn.Name == "add" {
+            add = fn
+        }
+    }
+    if add == nil {
+        t.Fatalf("function add not found")
+    }
+
+    // The body of add starts with the OpGetLocal of a on line 3 and ends
+    // with the OpGetLocal of sum on line 4, followed by the implicit
+    // OpReturnValue of the function on line 2.
+    end := len(add.Instructions) - 1
+    expected := map[int]int{0: 3, end - 2: 4, end: 2}
+    for offset, line := range expected {
+        if actual := add.SourceMap.Line(offset); actual != line {
+            t.Errorf("expected instruction %04d of add on line %d, got %d", offset, line, actual)
+        }
+    }
+
+    // The last call of the program is on line 7.
+    if line := bytecode.SourceMap.Line(len(bytecode.Instructions) - 3); line != 7 {
+        t.Errorf("expected last call on line 7, got %d", line)
+    }
+}
+
+func TestUnmarshalRejectsCorruptedData(t *testing.T) {
+    data, err := compileForTest(t, serializeInput).MarshalBinary()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    wrongVersion := append([]byte{}, data...)
+    wrongVersion[len(Magic)+1]++
+
+    tests := []struct {
+        name string
+        data []byte
+    }{
+        {"empty", []byte{}},
+        {"not bytecode", []byte("let x = 1;")},
+        {"header only", []byte(Magic)},
+        {"wrong version", wrongVersion},
+        {"truncated", data[:len(data)/2]},
+    }
+    for _, tt := range tests {
+        err := (&Bytecode{}).UnmarshalBinary(tt.data)
+        if !errors.Is(err, ErrInvalidBytecode) {
+            t.Errorf("%s: expected ErrInvalidBytecode, got %v", tt.name, err)
+        }
+    }
+
+    for i := range data {
+        corrupted := append([]byte{}, data...)
+        corrupted[i] ^= 0x41
+        if err := (&Bytecode{}).UnmarshalBinary(corrupted); err == nil {
+            t.Errorf("flipping bits of byte %d went unnoticed", i)
+        }
+    }
+}
+
+// TestUnmarshalRejectsRaisedFreeVariable raises the free variable the
+// inner function of adder reads, which the compiler adds as a constant
+// before the function creating it, and fixes the checksum.
+func TestUnmarshalRejectsRaisedFreeVariable(t *testing.T) {
+    bytecode := compileForTest(t, serializeInput)
+    data, err := bytecode.MarshalBinary()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    at := -1
+    for _, constant := range bytecode.Constants {
+        fn, ok := constant.(*object.CompiledFunction)
+        if !ok {
+            continue
+        }
+        for i := 0; i < len(fn.Instructions); {
+            def, err := code.Lookup(fn.Instructions[i])
+            if err != nil {
+                t.Fatal(err)
+            }
+            if code.Opcode(fn.Instructions[i]) == code.OpGetFree {
+                at = bytes.Index(data, fn.Instructions) + i + 1
+            }
+            _, read := code.ReadOperands(def, fn.Instructions[i+1:])
+            i += 1 + read
+        }
+    }
+    if at < 0 {
+        t.Fatalf("no OpGetFree found")
+    }
+
+    data[at] = 22
+    body := data[:len(data)-4]
+    binary.BigEndian.PutUint32(data[len(body):], crc32.ChecksumIEEE(body))
+    err = (&Bytecode{}).UnmarshalBinary(data)
+    if err == nil || !strings.Contains(err.Error(), "free variable 22 out of range, created with 1") {
+        t.Errorf("expected the free variable to be out of range, got %v", err)
+    }
+}
+
+func TestUnmarshalValidatesInstructions(t *testing.T) {
+    tests := []struct {
+        name string
+        bytecode *Bytecode
+    }{
+        {"unknown opcode", &Bytecode{Instructions: code.Instructions{255}}},
+        {"truncated operand", &Bytecode{Instructions: code.Instructions{byte(code.OpConstant), 0}}},
+        {"constant out of range", &Bytecode{Instructions: concat(
+            code.Make(code.OpConstant, 1), code.Make(code.OpReturnValue))}},
+        {"global out of range", &Bytecode{Instructions: concat(
+            code.Make(code.OpGetGlobal, 0), code.Make(code.OpReturnValue))}},
+        {"jump into an operand", &Bytecode{Instructions: concat(
+            code.Make(code.OpJump, 1), code.Make(code.OpReturnValue))}},
+        {"closure over an integer", &Bytecode{
+            Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpReturnValue)),
+            Constants: []object.Object{&object.Integer{Value: 1}},
+        }},
+        {"local out of range", &Bytecode{
+            Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpReturnValue)),
+            Constants: []object.Object{&object.CompiledFunction{
+                Instructions: concat(code.Make(code.OpGetLocal, 0), code.Make(code.OpReturnValue)),
+            }},
+        }},
+        {"no return", &Bytecode{Instructions: code.Make(code.OpNull)}},
+    }
+
+    for _, tt := range tests {
+        data, err := tt.bytecode.MarshalBinary()
+        if err != nil {
+            t.Fatalf("%s: %s", tt.name, err)
+        }
+        err = (&Bytecode{}).UnmarshalBinary(data)
+        if !errors.Is(err, ErrInvalidBytecode) {
+            t.Errorf("%s: expected ErrInvalidBytecode, got %v", tt.name, err)
+        }
+    }
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+    out := code.Instructions{}
+    for _, ins := range instructions {
+        out = append(out, ins...)
+    }
+    return out
+}
+
+func testSourceMap(t *testing.T, where string, expected, actual code.SourceMap) {
+    t.Helper()
+    if len(expected) != len(actual) {
+        t.Errorf("%s: wrong source map. want=%v, got=%v", where, expected, actual)
+        return
+    }
+    for i := range expected {
+        if expected[i] != actual[i] {
+            t.Errorf("%s: wrong source map. want=%v, got=%v", where, expected, actual)
+            return
+        }
+    }
+}
+
+func TestUnmarshalRejectsCraftedBytecode(t *testing.T) {
+    instructions := func(ins ...[]byte) code.Instructions {
+        return code.Instructions(bytes.Join(ins, nil))
+    }
+    function := &object.CompiledFunction{
+        Name: "f",
+        Instructions: instructions(code.Make(code.OpGetFree, 3), code.Make(code.OpReturnValue)),
+    }
+
+    tests := []struct {
+        name string
+        bytecode *Bytecode
+        expected string
+    }{
+        {
+            "popping an empty stack",
+            &Bytecode{Instructions: instructions(
+                code.Make(code.OpPop), code.Make(code.OpPop), code.Make(code.OpPop),
+                code.Make(code.OpNull), code.Make(code.OpReturnValue),
+            )},
+            "invalid bytecode: main program at 0000: OpPop pops 1, the stack holds 0",
+        },
+        {
+            "popping past a branch",
+            &Bytecode{Instructions: instructions(
+                code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5),
+                code.Make(code.OpNull), code.Make(code.OpNull), code.Make(code.OpReturnValue),
+            )},
+            "invalid bytecode: main program at 0005: stack depth 0 on one path and 1 on another",
+        },
+        {
+            "free variable in the main program",
+            &Bytecode{Instructions: instructions(code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue))},
+            "invalid bytecode: main program: free variable 0 out of range",
+        },
+        {
+            "free variable out of range",
+            &Bytecode{
+                Instructions: instructions(
+                    code.Make(code.OpNull), code.Make(code.OpClosure, 0, 1),
+                    code.Make(code.OpCall, 0), code.Make(code.OpReturnValue),
+                ),
+                Constants: []object.Object{function},
+            },
+            "invalid bytecode: constant 0: free variable 3 out of range, created with 1",
+        },
+        {
+            "free variable of a function never created",
+            &Bytecode{
+                Instructions: instructions(code.Make(code.OpNull), code.Make(code.OpReturnValue)),
+                Constants: []object.Object{function},
+            },
+            "invalid bytecode: constant 0: free variable 3 out of range, created with 0",
+        },
+    }
+
+    for _, tt := range tests {
+        data, err := tt.bytecode.MarshalBinary()
+        if err != nil {
+            t.Fatal(err)
+        }
+        err = (&Bytecode{}).UnmarshalBinary(data)
+        if err == nil || err.Error() != tt.expected {
+            t.Errorf("%s: expected error %q, got %v", tt.name, tt.expected, err)
+        }
+    }
+}
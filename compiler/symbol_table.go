@@ -0,0 +1,154 @@
+package compiler
+
+type SymbolScope string
+
+const (
+    GlobalScope SymbolScope = "GLOBAL"
+    LocalScope SymbolScope = "LOCAL"
+    FreeScope SymbolScope = "FREE"
+    FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+    Name string
+    Scope SymbolScope
+    Index int
+}
+
+// SymbolTable maps the names visible in one function, or at the top level
+// for the outermost table, to where their values live at run time.
+type SymbolTable struct {
+    Outer *SymbolTable
+
+    store map[string]Symbol
+    numDefinitions int
+    // numParameters counts the first slots, which hold the parameters and
+    // are always set.
+    numParameters int
+
+    FreeSymbols []Symbol
+    // captured maps the variables of enclosing functions this function
+    // captures to their free symbol.
+    captured map[capture]Symbol
+}
+
+type capture struct {
+    table *SymbolTable
+    name string
+}
+
+func NewSymbolTable() *SymbolTable {
+    s := make(map[string]Symbol)
+    free := []Symbol{}
+    return &SymbolTable{store: s, FreeSymbols: free, captured: map[capture]Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+    s := NewSymbolTable()
+    s.Outer = outer
+    return s
+}
+
+// Define binds name in this table. Like let in the evaluator, defining a
+// name again in the same table reuses its slot.
+func (s *SymbolTable) Define(name string) Symbol {
+    if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+        return symbol
+    }
+
+    symbol := Symbol{Name: name, Index: s.numDefinitions}
+    if s.Outer == nil {
+        symbol.Scope = GlobalScope
+    } else {
+        symbol.Scope = LocalScope
+    }
+
+    s.store[name] = symbol
+    s.numDefinitions++
+    return symbol
+}
+
+// DefineParameter binds the name of a parameter, which is always set when
+// the function runs.
+func (s *SymbolTable) DefineParameter(name string) Symbol {
+    symbol := s.Define(name)
+    s.numParameters = s.numDefinitions
+    return symbol
+}
+
+// DefineFunctionName binds the name of the function being compiled to the
+// closure currently running.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+    symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+    s.store[name] = symbol
+    return symbol
+}
+
+// Resolve looks name up in this table and its outer tables. Locals of
+// enclosing functions are turned into free variables on the way.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+    for t := s; t != nil; t = t.Outer {
+        if symbol, ok := t.store[name]; ok {
+            return s.capture(t, symbol), true
+        }
+    }
+    return Symbol{}, false
+}
+
+// Lookup returns the variables called name visible from this table,
+// innermost first, and whether it found any. Like in the evaluator, reading
+// one of them before it is set falls back to the next, so the list ends
+// with the first that is always set: a parameter, a global or the function
+// itself.
+func (s *SymbolTable) Lookup(name string) ([]Symbol, bool) {
+    var symbols []Symbol
+    for t := s; t != nil; t = t.Outer {
+        symbol, ok := t.store[name]
+        if !ok {
+            continue
+        }
+        symbols = append(symbols, s.capture(t, symbol))
+        if symbol.Scope != LocalScope || symbol.Index < t.numParameters {
+            break
+        }
+    }
+    return symbols, len(symbols) != 0
+}
+
+// capture returns symbol, a variable of table, as seen from this table:
+// locals of enclosing functions become free variables of this function
+// and of those in between.
+func (s *SymbolTable) capture(table *SymbolTable, symbol Symbol) Symbol {
+    if s == table || symbol.Scope == GlobalScope {
+        return symbol
+    }
+    key := capture{table: table, name: symbol.Name}
+    if free, ok := s.captured[key]; ok {
+        return free
+    }
+
+    s.FreeSymbols = append(s.FreeSymbols, s.Outer.capture(table, symbol))
+    free := Symbol{Name: symbol.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+    s.captured[key] = free
+    return free
+}
+
+// Globals returns the outermost table.
+func (s *SymbolTable) Globals() *SymbolTable {
+    for s.Outer != nil {
+        s = s.Outer
+    }
+    return s
+}
+
+// Names returns the names of the symbols defined in the table, indexed by
+// their slot.
+func (s *SymbolTable) Names() []string {
+    names := make([]string, s.numDefinitions)
+    for name, symbol := range s.store {
+        if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+            names[symbol.Index] = name
+        }
+    }
+    return names
+}
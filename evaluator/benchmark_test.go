@@ -0,0 +1,66 @@
+package evaluator
+
+import (
+    "testing"
+
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/parser"
+)
+
+// benchmarks are typical Monkey programs. Run them with
+//
+//	go test ./evaluator -run - -bench .
+//
+// and compare allocs/op between changes to the evaluator.
+var benchmarks = []struct {
+    name string
+    input string
+}{
+    {"Fib", `
+        let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+        fib(20)`},
+    {"Loop", `
+        let sum = fn(n) { let total = 0; for (i in 0..n) { let total = total + i * 2 }; total };
+        sum(10000)`},
+    {"Closures", `
+        let adder = fn(a) { fn(b) { a + b } };
+        let total = 0;
+        for (i in 0..1000) { let total = adder(i)(total) };
+        total`},
+    {"Arrays", `
+        let xs = map(range(1000), fn(x) { x * 3 });
+        let evens = filter(xs, fn(x) { x / 2 * 2 == x });
+        reduce(evens, fn(acc, x) { acc + x }, 0)`},
+    {"Hashes", `
+        let h = {};
+        for (i in 0..500) { let h = merge(h, {i: i * i}) };
+        let total = 0;
+        for (k in keys(h)) { let total = total + h[k] };
+        total`},
+    {"Strings", `
+        let s = "";
+        for (i in 0..500) { let s = s + "ab" };
+        len(s)`},
+}
+
+func BenchmarkPrograms(b *testing.B) {
+    for _, bm := range benchmarks {
+        p := parser.New(lexer.New(bm.input))
+        program := p.ParseProgram()
+        if len(p.Errors()) != 0 {
+            b.Fatalf("%s: parser errors: %v", bm.name, p.Errors())
+        }
+        in := New()
+        if result := in.Eval(program, object.NewEnvironment()); isError(result) {
+            b.Fatalf("%s: %s", bm.name, result.Inspect())
+        }
+
+        b.Run(bm.name, func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                in.Eval(program, object.NewEnvironment())
+            }
+        })
+    }
+}
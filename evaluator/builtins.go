@@ -3,6 +3,7 @@ package evaluator
 import (
     "necronet.info/interpreter/object"
     "fmt"
+    "strings"
 )
 
 var builtins = map[string]*object.Builtin{
@@ -17,9 +18,15 @@ var builtins = map[string]*object.Builtin{
             switch arg := args[0].(type) {
 
             case *object.String:
-                return &object.Integer{Value: int64(len(arg.Value))}
+                return object.NewInteger(int64(len(arg.Value)))
             case *object.Array:
-                return &object.Integer{Value: int64(len(arg.Elements))}
+                return object.NewInteger(int64(len(arg.Elements)))
+            case *object.Hash:
+                return object.NewInteger(int64(arg.Len()))
+            case *object.Set:
+                return object.NewInteger(int64(arg.Len()))
+            case *object.Range:
+                return object.NewInteger(arg.Len())
             default:
                 return newError("argument to `len` not supported, got %s", args[0].Type())
             }
@@ -98,6 +105,82 @@ var builtins = map[string]*object.Builtin{
             return &object.Array{Elements: newElements }
         },
     },
+    "contains": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+
+            switch arg := args[0].(type) {
+            case *object.String:
+                substr, ok := args[1].(*object.String)
+                if !ok {
+                    return newError("argument 2 to `contains` must be STRING, got %s", args[1].Type())
+                }
+                return nativeBoolToBooleanObject(strings.Contains(arg.Value, substr.Value))
+            case *object.Array:
+                return nativeBoolToBooleanObject(indexOf(arg.Elements, args[1]) >= 0)
+            default:
+                return newError("argument to `contains` not supported, got %s", args[0].Type())
+            }
+        },
+    },
+    // Strings are indexed by byte, as by len, str[i] and str[a:b], so
+    // index_of returns a byte offset and slice takes byte offsets, which
+    // may fall inside a multi-byte UTF-8 character.
+    "index_of": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+
+            switch arg := args[0].(type) {
+            case *object.String:
+                substr, ok := args[1].(*object.String)
+                if !ok {
+                    return newError("argument 2 to `index_of` must be STRING, got %s", args[1].Type())
+                }
+                return object.NewInteger(int64(strings.Index(arg.Value, substr.Value)))
+            case *object.Array:
+                return object.NewInteger(int64(indexOf(arg.Elements, args[1])))
+            default:
+                return newError("argument to `index_of` not supported, got %s", args[0].Type())
+            }
+        },
+    },
+    "slice": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) < 2 || len(args) > 3 {
+                return newError("wrong number of arguments. got=%d, want=2..3", len(args))
+            }
+            for i, arg := range args[1:] {
+                if arg.Type() != object.INTEGER_OBJ {
+                    return newError("argument %d to `slice` must be INTEGER, got %s", i+2, arg.Type())
+                }
+            }
+
+            switch arg := args[0].(type) {
+            case *object.String:
+                start, end := sliceBounds(args[1:], len(arg.Value))
+                return &object.String{Value: arg.Value[start:end]}
+            case *object.Array:
+                start, end := sliceBounds(args[1:], len(arg.Elements))
+                newElements := make([]object.Object, end-start)
+                copy(newElements, arg.Elements[start:end])
+                return &object.Array{Elements: newElements}
+            default:
+                return newError("argument to `slice` not supported, got %s", args[0].Type())
+            }
+        },
+    },
+    "freeze": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) != 1 {
+                return newError("wrong number of arguments. got=%d, want=1", len(args))
+            }
+            return freeze(args[0])
+        },
+    },
     "puts": &object.Builtin{
         Fn: func(args ...object.Object) object.Object {
             for _, arg := range args {
@@ -107,3 +190,85 @@ var builtins = map[string]*object.Builtin{
         },
     },
 }
+
+// indexOf returns the position of the first element equal to obj, or -1.
+func indexOf(elements []object.Object, obj object.Object) int {
+    for i, el := range elements {
+        if object.Equals(el, obj) {
+            return i
+        }
+    }
+    return -1
+}
+
+// checkArgs verifies that a builtin got between min and max arguments and
+// that each of them has the type at the same position in types.
+func checkArgs(name string, args []object.Object, min, max int, types ...object.ObjectType) *object.Error {
+    if len(args) < min || len(args) > max {
+        if min == max {
+            return newError("wrong number of arguments. got=%d, want=%d", len(args), min)
+        }
+        return newError("wrong number of arguments. got=%d, want=%d..%d", len(args), min, max)
+    }
+    for i, arg := range args {
+        if i < len(types) && arg.Type() != types[i] {
+            return newError("argument %d to `%s` must be %s, got %s", i+1, name, types[i], arg.Type())
+        }
+    }
+    return nil
+}
+
+// sliceBounds turns optional start and end INTEGER arguments into bounds
+// within [0, length]. Negative values count back from length.
+func sliceBounds(args []object.Object, length int) (int, int) {
+    bound := func(obj object.Object) int {
+        idx := obj.(*object.Integer).Value
+        if idx < 0 {
+            idx += int64(length)
+        }
+        if idx < 0 {
+            return 0
+        }
+        if idx > int64(length) {
+            return length
+        }
+        return int(idx)
+    }
+
+    start, end := 0, length
+    if len(args) > 0 {
+        start = bound(args[0])
+    }
+    if len(args) > 1 {
+        end = bound(args[1])
+    }
+    if end < start {
+        end = start
+    }
+    return start, end
+}
+
+// freeze returns an immutable copy of obj in which every nested hash is
+// frozen, making it usable as a hash key.
+func freeze(obj object.Object) object.Object {
+    switch obj := obj.(type) {
+    case *object.Array:
+        elements := make([]object.Object, len(obj.Elements))
+        for i, el := range obj.Elements {
+            elements[i] = freeze(el)
+        }
+        return &object.Array{Elements: elements}
+    case *object.Hash:
+        if obj.Frozen() {
+            return obj
+        }
+        frozen := object.NewHash()
+        for _, pair := range obj.Pairs() {
+            frozen.Set(pair.Key.(object.Hashable), freeze(pair.Value))
+        }
+        frozen.Freeze()
+        return frozen
+    default:
+        return obj
+    }
+}
@@ -0,0 +1,349 @@
+package evaluator
+
+import (
+    "sort"
+
+    "necronet.info/interpreter/object"
+)
+
+var arrayBuiltins = map[string]*object.Builtin{
+    "map": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkCallbackArgs("map", args, 2); err != nil {
+                return err
+            }
+            it, _ := iterate(args[0])
+            result := []object.Object{}
+            for el, ok := it.Next(); ok; el, ok = it.Next() {
+                if isError(el) {
+                    return el
+                }
+                mapped := call.Apply(args[1], el)
+                if isError(mapped) {
+                    return mapped
+                }
+                result = append(result, mapped)
+            }
+            return &object.Array{Elements: result}
+        },
+    },
+    "filter": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkCallbackArgs("filter", args, 2); err != nil {
+                return err
+            }
+            it, _ := iterate(args[0])
+            result := []object.Object{}
+            for el, ok := it.Next(); ok; el, ok = it.Next() {
+                if isError(el) {
+                    return el
+                }
+                keep := call.Apply(args[1], el)
+                if isError(keep) {
+                    return keep
+                }
+                if isTruth(keep) {
+                    result = append(result, el)
+                }
+            }
+            return &object.Array{Elements: result}
+        },
+    },
+    "reduce": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if len(args) != 2 && len(args) != 3 {
+                return newError("wrong number of arguments. got=%d, want=2..3", len(args))
+            }
+            if err := checkCallbackArgs("reduce", args[:2], 2); err != nil {
+                return err
+            }
+            it, _ := iterate(args[0])
+            var acc object.Object
+            if len(args) == 3 {
+                acc = args[2]
+            } else if first, ok := it.Next(); ok {
+                acc = first
+            } else {
+                return NULL
+            }
+            if isError(acc) {
+                return acc
+            }
+            for el, ok := it.Next(); ok; el, ok = it.Next() {
+                if isError(el) {
+                    return el
+                }
+                acc = call.Apply(args[1], acc, el)
+                if isError(acc) {
+                    return acc
+                }
+            }
+            return acc
+        },
+    },
+    "sort": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if len(args) != 1 && len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=1..2", len(args))
+            }
+            elements, ok := iterableElements(args[0])
+            if !ok {
+                return newError("argument 1 to `sort` must be iterable, got %s", args[0].Type())
+            }
+            if len(elements) == 1 && isError(elements[0]) {
+                return elements[0]
+            }
+            if len(args) == 2 && !isCallable(args[1]) {
+                return newError("argument 2 to `sort` must be FUNCTION, got %s", args[1].Type())
+            }
+
+            sorted := make([]object.Object, len(elements))
+            copy(sorted, elements)
+
+            var failed object.Object
+            less := func(a, b object.Object) bool {
+                if failed != nil {
+                    return false
+                }
+                var result bool
+                if len(args) == 2 {
+                    result, failed = compareWith(call, args[1], a, b)
+                } else {
+                    result, failed = compareNatural(a, b)
+                }
+                return result
+            }
+            sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+            if failed != nil {
+                return failed
+            }
+            return &object.Array{Elements: sorted}
+        },
+    },
+    "reverse": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("reverse", args, 1, 1, object.ARRAY_OBJ); err != nil {
+                return err
+            }
+            elements := args[0].(*object.Array).Elements
+            reversed := make([]object.Object, len(elements))
+            for i, el := range elements {
+                reversed[len(elements)-1-i] = el
+            }
+            return &object.Array{Elements: reversed}
+        },
+    },
+    "concat": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            result := []object.Object{}
+            for i, arg := range args {
+                array, ok := arg.(*object.Array)
+                if !ok {
+                    return newError("argument %d to `concat` must be ARRAY, got %s", i+1, arg.Type())
+                }
+                result = append(result, array.Elements...)
+            }
+            return &object.Array{Elements: result}
+        },
+    },
+    "range": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("range", args, 1, 3, object.INTEGER_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+                return err
+            }
+            var start, end, step int64 = 0, 0, 1
+            switch len(args) {
+            case 1:
+                end = args[0].(*object.Integer).Value
+            case 2:
+                start, end = args[0].(*object.Integer).Value, args[1].(*object.Integer).Value
+            case 3:
+                start, end = args[0].(*object.Integer).Value, args[1].(*object.Integer).Value
+                step = args[2].(*object.Integer).Value
+            }
+            if step == 0 {
+                return newError("step to `range` must not be zero")
+            }
+            result := []object.Object{}
+            for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+                result = append(result, object.NewInteger(i))
+            }
+            return &object.Array{Elements: result}
+        },
+    },
+    "zip": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) == 0 {
+                return newError("wrong number of arguments. got=0, want at least 1")
+            }
+            length := -1
+            for i, arg := range args {
+                array, ok := arg.(*object.Array)
+                if !ok {
+                    return newError("argument %d to `zip` must be ARRAY, got %s", i+1, arg.Type())
+                }
+                if length < 0 || len(array.Elements) < length {
+                    length = len(array.Elements)
+                }
+            }
+            result := make([]object.Object, length)
+            for i := range result {
+                tuple := make([]object.Object, len(args))
+                for j, arg := range args {
+                    tuple[j] = arg.(*object.Array).Elements[i]
+                }
+                result[i] = &object.Array{Elements: tuple}
+            }
+            return &object.Array{Elements: result}
+        },
+    },
+    "any": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkCallbackArgs("any", args, 2); err != nil {
+                return err
+            }
+            _, found, err := findElement(call, args[0], args[1])
+            if err != nil {
+                return err
+            }
+            return nativeBoolToBooleanObject(found)
+        },
+    },
+    "all": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkCallbackArgs("all", args, 2); err != nil {
+                return err
+            }
+            it, _ := iterate(args[0])
+            for el, ok := it.Next(); ok; el, ok = it.Next() {
+                if isError(el) {
+                    return el
+                }
+                result := call.Apply(args[1], el)
+                if isError(result) {
+                    return result
+                }
+                if !isTruth(result) {
+                    return FALSE
+                }
+            }
+            return TRUE
+        },
+    },
+    "find": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkCallbackArgs("find", args, 2); err != nil {
+                return err
+            }
+            el, _, err := findElement(call, args[0], args[1])
+            if err != nil {
+                return err
+            }
+            return el
+        },
+    },
+}
+
+// findElement returns the first element of iterable for which predicate is
+// truthy, or NULL when there is none. A non-nil error is the error object
+// the predicate failed with.
+func findElement(call *object.CallContext, iterable, predicate object.Object) (object.Object, bool, object.Object) {
+    it, _ := iterate(iterable)
+    for el, more := it.Next(); more; el, more = it.Next() {
+        if isError(el) {
+            return NULL, false, el
+        }
+        ok := call.Apply(predicate, el)
+        if isError(ok) {
+            return NULL, false, ok
+        }
+        if isTruth(ok) {
+            return el, true, nil
+        }
+    }
+    return NULL, false, nil
+}
+
+// checkCallbackArgs checks the arguments of builtins called as
+// name(iterable, fn).
+func checkCallbackArgs(name string, args []object.Object, want int) *object.Error {
+    if len(args) != want {
+        return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+    }
+    if _, ok := args[0].(object.Iterable); !ok {
+        return newError("argument 1 to `%s` must be iterable, got %s", name, args[0].Type())
+    }
+    if !isCallable(args[1]) {
+        return newError("argument 2 to `%s` must be FUNCTION, got %s", name, args[1].Type())
+    }
+    return nil
+}
+
+// iterate returns an iterator over obj if it is iterable.
+func iterate(obj object.Object) (object.Iterator, bool) {
+    iterable, ok := obj.(object.Iterable)
+    if !ok {
+        return nil, false
+    }
+    return iterable.Iterate(), true
+}
+
+// iterableElements returns all the elements of an iterable in iteration
+// order. If the iterable fails, the error is the only element returned.
+func iterableElements(obj object.Object) ([]object.Object, bool) {
+    if array, ok := obj.(*object.Array); ok {
+        return array.Elements, true
+    }
+    it, ok := iterate(obj)
+    if !ok {
+        return nil, false
+    }
+    elements := []object.Object{}
+    for el, ok := it.Next(); ok; el, ok = it.Next() {
+        if isError(el) {
+            return []object.Object{el}, true
+        }
+        elements = append(elements, el)
+    }
+    return elements, true
+}
+
+func isCallable(obj object.Object) bool {
+    switch obj.(type) {
+    case *object.Function, *object.Closure, *object.Builtin:
+        return true
+    }
+    return false
+}
+
+// compareWith orders a and b with a comparator which either returns a
+// BOOLEAN telling whether a goes before b, or an INTEGER that is negative
+// when it does.
+func compareWith(call *object.CallContext, comparator, a, b object.Object) (bool, object.Object) {
+    result := call.Apply(comparator, a, b)
+    switch result := result.(type) {
+    case *object.Error:
+        return false, result
+    case *object.Boolean:
+        return result.Value, nil
+    case *object.Integer:
+        return result.Value < 0, nil
+    default:
+        return false, newError("comparator to `sort` must return BOOLEAN or INTEGER, got %s", result.Type())
+    }
+}
+
+// compareNatural orders integers numerically and strings lexically.
+func compareNatural(a, b object.Object) (bool, object.Object) {
+    switch a := a.(type) {
+    case *object.Integer:
+        if b, ok := b.(*object.Integer); ok {
+            return a.Value < b.Value, nil
+        }
+    case *object.String:
+        if b, ok := b.(*object.String); ok {
+            return a.Value < b.Value, nil
+        }
+    }
+    return false, newError("cannot compare %s and %s, pass a comparator to `sort`", a.Type(), b.Type())
+}
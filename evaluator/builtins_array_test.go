@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestArrayBuiltins(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+        {`map([], fn(x) { x })`, []int{}},
+        {`map([1, "a"], len)`, errors.New("argument to `len` not supported, got INTEGER")},
+        {`map([1], fn(x, y) { x })`, errors.New("wrong number of arguments. got=1, want=2")},
+        {`map([1], 1)`, errors.New("argument 2 to `map` must be FUNCTION, got INTEGER")},
+        {`map(1, fn(x) { x })`, errors.New("argument 1 to `map` must be iterable, got INTEGER")},
+        {`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+        {`filter([1, 2], fn(x) { false })`, []int{}},
+        {`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, 10},
+        {`reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)`, 16},
+        {`reduce([], fn(acc, x) { acc + x })`, nil},
+        {`reduce([], fn(acc, x) { acc + x }, 0)`, 0},
+        {`reduce(["a", "b"], fn(acc, x) { acc + x }, "")`, "ab"},
+        {`sort([3, 1, 2])`, []int{1, 2, 3}},
+        {`sort(["b", "c", "a"])`, []string{"a", "b", "c"}},
+        {`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+        {`sort([3, 1, 2], fn(a, b) { b - a })`, []int{3, 2, 1}},
+        {`sort([1, "a"])`, errors.New("cannot compare STRING and INTEGER, pass a comparator to `sort`")},
+        {`sort([1, 2], fn(a, b) { "x" })`, errors.New("comparator to `sort` must return BOOLEAN or INTEGER, got STRING")},
+        {`let a = [3, 1, 2]; sort(a); a`, []int{3, 1, 2}},
+        {`reverse([1, 2, 3])`, []int{3, 2, 1}},
+        {`reverse([])`, []int{}},
+        {`slice([1, 2, 3, 4], 1, 3)`, []int{2, 3}},
+        {`slice([1, 2, 3, 4], -2)`, []int{3, 4}},
+        {`slice([1, 2, 3, 4], 3, 1)`, []int{}},
+        {`slice([1, 2], "a")`, errors.New("argument 2 to `slice` must be INTEGER, got STRING")},
+        {`slice(1, 0)`, errors.New("argument to `slice` not supported, got INTEGER")},
+        {`concat([1], [2, 3], [])`, []int{1, 2, 3}},
+        {`concat()`, []int{}},
+        {`concat([1], 2)`, errors.New("argument 2 to `concat` must be ARRAY, got INTEGER")},
+        {`range(4)`, []int{0, 1, 2, 3}},
+        {`range(2, 5)`, []int{2, 3, 4}},
+        {`range(5, 0, -2)`, []int{5, 3, 1}},
+        {`range(3, 1)`, []int{}},
+        {`range(0, 5, 0)`, errors.New("step to `range` must not be zero")},
+        {`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+        {`zip([1, 2], ["a", "b"])[1][1]`, "b"},
+        {`zip([1], 2)`, errors.New("argument 2 to `zip` must be ARRAY, got INTEGER")},
+        {`any([1, 2, 3], fn(x) { x > 2 })`, true},
+        {`any([1, 2, 3], fn(x) { x > 3 })`, false},
+        {`any([], fn(x) { true })`, false},
+        {`all([1, 2, 3], fn(x) { x > 0 })`, true},
+        {`all([1, 2, 3], fn(x) { x > 1 })`, false},
+        {`all([], fn(x) { false })`, true},
+        {`find([1, 2, 3], fn(x) { x > 1 })`, 2},
+        {`find([1, 2, 3], fn(x) { x > 3 })`, nil},
+        {`index_of([1, 2, 3], 2)`, 1},
+        {`index_of(["a", "b"], "b")`, 1},
+        {`index_of([1, 2, 3], 4)`, -1},
+        {`index_of(1, 1)`, errors.New("argument to `index_of` not supported, got INTEGER")},
+        {`contains([1, 2, 3], 3)`, true},
+        {`contains([1, 2, 3], "3")`, false},
+        {`contains([[1, 2], [3]], [3])`, true},
+        {`index_of([{"a": 1}, {"b": 2}], {"b": 2})`, 1},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestArrayBuiltinsOnLargeArrays(t *testing.T) {
+    input := `reduce(map(range(100000), fn(x) { x * 2 }), fn(acc, x) { acc + x }, 0)`
+    testObject(t, input, testEval(input), 9999900000)
+}
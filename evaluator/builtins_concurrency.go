@@ -0,0 +1,127 @@
+package evaluator
+
+import (
+    "reflect"
+
+    "necronet.info/interpreter/object"
+)
+
+var concurrencyBuiltins = map[string]*object.Builtin{
+    "chan": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("chan", args, 0, 1, object.INTEGER_OBJ); err != nil {
+                return err
+            }
+            size := int64(0)
+            if len(args) == 1 {
+                size = args[0].(*object.Integer).Value
+            }
+            if size < 0 {
+                return newError("negative size to `chan`: %d", size)
+            }
+            return object.NewChannel(int(size))
+        },
+    },
+    "send": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkArgs("send", args, 2, 2, object.CHANNEL_OBJ); err != nil {
+                return err
+            }
+            if err := args[0].(*object.Channel).Send(call.Context, args[1]); err != nil {
+                return newError("%s", err)
+            }
+            return NULL
+        },
+    },
+    "recv": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkArgs("recv", args, 1, 1, object.CHANNEL_OBJ); err != nil {
+                return err
+            }
+            value, ok, err := args[0].(*object.Channel).Recv(call.Context)
+            if err != nil {
+                return newError("%s", err)
+            }
+            if !ok {
+                return NULL
+            }
+            return value
+        },
+    },
+    "close": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) != 1 {
+                return newError("wrong number of arguments. got=%d, want=1", len(args))
+            }
+            switch arg := args[0].(type) {
+            case *object.Channel:
+                if !arg.Close() {
+                    return newError("close of closed channel")
+                }
+            case *object.Generator:
+                arg.Close()
+            default:
+                return newError("argument to `close` not supported, got %s", args[0].Type())
+            }
+            return NULL
+        },
+    },
+    "await": &object.Builtin{
+        ContextFn: func(call *object.CallContext, args ...object.Object) object.Object {
+            if err := checkArgs("await", args, 1, 1, object.TASK_OBJ); err != nil {
+                return err
+            }
+            result, err := args[0].(*object.Task).Wait(call.Context)
+            if err != nil {
+                return newError("%s", err)
+            }
+            return result
+        },
+    },
+    "select": &object.Builtin{
+        ContextFn: selectChannels,
+    },
+}
+
+// selectChannels waits until one of its arguments can proceed and returns
+// [index, value] for it. A CHANNEL argument receives, with value NULL once
+// the channel is closed; a [CHANNEL, value] argument sends, with value NULL.
+func selectChannels(call *object.CallContext, args ...object.Object) (result object.Object) {
+    if len(args) == 0 {
+        return newError("wrong number of arguments. got=0, want at least 1")
+    }
+
+    cases := make([]reflect.SelectCase, len(args), len(args)+1)
+    for i, arg := range args {
+        if ch, ok := arg.(*object.Channel); ok {
+            cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.C)}
+            continue
+        }
+        pair, ok := arg.(*object.Array)
+        if !ok || len(pair.Elements) != 2 || pair.Elements[0].Type() != object.CHANNEL_OBJ {
+            return newError("argument %d to `select` must be CHANNEL or [CHANNEL, value], got %s", i+1, arg.Type())
+        }
+        cases[i] = reflect.SelectCase{
+            Dir: reflect.SelectSend,
+            Chan: reflect.ValueOf(pair.Elements[0].(*object.Channel).C),
+            Send: reflect.ValueOf(&pair.Elements[1]).Elem(),
+        }
+    }
+    cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(call.Context.Done())})
+
+    defer func() {
+        if recover() != nil {
+            result = newError("%s", object.ErrClosedChannel)
+        }
+    }()
+    chosen, value, ok := reflect.Select(cases)
+    if chosen == len(args) {
+        return newError("%s", call.Context.Err())
+    }
+
+    received := object.Object(NULL)
+    if cases[chosen].Dir == reflect.SelectRecv && ok {
+        received = value.Interface().(object.Object)
+    }
+    return &object.Array{Elements: []object.Object{object.NewInteger(int64(chosen)), received}}
+}
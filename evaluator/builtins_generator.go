@@ -0,0 +1,23 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/object"
+)
+
+var generatorBuiltins = map[string]*object.Builtin{
+    "next": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("next", args, 1, 2, object.GENERATOR_OBJ); err != nil {
+                return err
+            }
+            value, ok := args[0].(*object.Generator).Next()
+            if !ok {
+                if len(args) == 2 {
+                    return args[1]
+                }
+                return NULL
+            }
+            return value
+        },
+    },
+}
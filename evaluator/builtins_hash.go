@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/object"
+)
+
+var hashBuiltins = map[string]*object.Builtin{
+    "keys": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("keys", args, 1, 1, object.HASH_OBJ); err != nil {
+                return err
+            }
+            pairs := args[0].(*object.Hash).Pairs()
+            keys := make([]object.Object, len(pairs))
+            for i, pair := range pairs {
+                keys[i] = pair.Key
+            }
+            return &object.Array{Elements: keys}
+        },
+    },
+    "values": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("values", args, 1, 1, object.HASH_OBJ); err != nil {
+                return err
+            }
+            pairs := args[0].(*object.Hash).Pairs()
+            values := make([]object.Object, len(pairs))
+            for i, pair := range pairs {
+                values[i] = pair.Value
+            }
+            return &object.Array{Elements: values}
+        },
+    },
+    "items": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("items", args, 1, 1, object.HASH_OBJ); err != nil {
+                return err
+            }
+            pairs := args[0].(*object.Hash).Pairs()
+            items := make([]object.Object, len(pairs))
+            for i, pair := range pairs {
+                items[i] = &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+            }
+            return &object.Array{Elements: items}
+        },
+    },
+    "has": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+            if args[0].Type() != object.HASH_OBJ && args[0].Type() != object.SET_OBJ {
+                return newError("argument 1 to `has` must be HASH or SET, got %s", args[0].Type())
+            }
+            key, err := asHashKey(args[1])
+            if err != nil {
+                return err
+            }
+            if set, ok := args[0].(*object.Set); ok {
+                return nativeBoolToBooleanObject(set.Has(key))
+            }
+            _, ok := args[0].(*object.Hash).Get(key)
+            return nativeBoolToBooleanObject(ok)
+        },
+    },
+    "delete": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("delete", args, 2, 2, object.HASH_OBJ); err != nil {
+                return err
+            }
+            key, err := asHashKey(args[1])
+            if err != nil {
+                return err
+            }
+            hash := copyHash(args[0].(*object.Hash))
+            hash.Delete(key)
+            return hash
+        },
+    },
+    "remove": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+            if args[0].Type() != object.HASH_OBJ && args[0].Type() != object.SET_OBJ {
+                return newError("argument 1 to `remove` must be HASH or SET, got %s", args[0].Type())
+            }
+            key, err := asHashKey(args[1])
+            if err != nil {
+                return err
+            }
+            if set, ok := args[0].(*object.Set); ok {
+                return nativeBoolToBooleanObject(set.Remove(key))
+            }
+            hash := args[0].(*object.Hash)
+            if hash.Frozen() {
+                return newError("cannot modify frozen HASH")
+            }
+            value, ok := hash.Delete(key)
+            if !ok {
+                return NULL
+            }
+            return value
+        },
+    },
+    "merge": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            merged := object.NewHash()
+            for i, arg := range args {
+                hash, ok := arg.(*object.Hash)
+                if !ok {
+                    return newError("argument %d to `merge` must be HASH, got %s", i+1, arg.Type())
+                }
+                for _, pair := range hash.Pairs() {
+                    merged.Set(pair.Key.(object.Hashable), pair.Value)
+                }
+            }
+            return merged
+        },
+    },
+}
+
+func copyHash(hash *object.Hash) *object.Hash {
+    copied := object.NewHash()
+    for _, pair := range hash.Pairs() {
+        copied.Set(pair.Key.(object.Hashable), pair.Value)
+    }
+    return copied
+}
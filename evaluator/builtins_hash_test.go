@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestHashBuiltins(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`keys({"b": 1, "a": 2, "c": 3})`, []string{"b", "a", "c"}},
+        {`keys({3: 1, 1: 2, 2: 3})`, []int{3, 1, 2}},
+        {`keys({})`, []int{}},
+        {`len(keys({"a": 1, 2: 2, true: 3}))`, 3},
+        {`keys({"a": 1, 2: 2, true: 3})[0]`, "a"},
+        {`keys({"a": 1, 2: 2, true: 3})[1]`, 2},
+        {`keys({"a": 1, 2: 2, true: 3})[2]`, true},
+        {`keys([1])`, errors.New("argument 1 to `keys` must be HASH, got ARRAY")},
+        {`values({"b": 1, "a": 2, "c": 3})`, []int{1, 2, 3}},
+        {`items({"b": 1, "a": 2})[0][0]`, "b"},
+        {`items({"b": 1, "a": 2})[0][1]`, 1},
+        {`items({"b": 1, "a": 2})[1][0]`, "a"},
+        {`has({"a": 1}, "a")`, true},
+        {`has({"a": 1}, "b")`, false},
+        {`has({"a": 1}, [1])`, false},
+        {`has({"a": 1}, fn(x) { x })`, errors.New("unusable as hash key: FUNCTION")},
+        {`delete({"a": 1, "b": 2}, "a")["a"]`, nil},
+        {`len(delete({"a": 1, "b": 2}, "a"))`, 1},
+        {`len(delete({"a": 1, "b": 2}, "c"))`, 2},
+        {`let h = {"a": 1, "b": 2}; delete(h, "a"); h["a"]`, 1},
+        {`let h = {"a": 1, "b": 2}; remove(h, "a")`, 1},
+        {`let h = {"a": 1, "b": 2}; remove(h, "a"); keys(h)`, []string{"b"}},
+        {`let h = {"a": 1}; remove(h, "b")`, nil},
+        {`let m = merge({"a": 1, "b": 2}, {"b": 3, "c": 4}); values(m)`, []int{1, 3, 4}},
+        {`let m = merge({"b": 1, "a": 2}, {"c": 3, "b": 4}); keys(m)`, []string{"b", "a", "c"}},
+        {`let h = {"a": 1, "b": 2}; remove(h, "a"); keys(merge(h, {"a": 3}))`, []string{"b", "a"}},
+        {`len(merge())`, 0},
+        {`merge({}, 1)`, errors.New("argument 2 to `merge` must be HASH, got INTEGER")},
+        {`len({"a": 1, "b": 2})`, 2},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestHasDistinguishesStoredNull(t *testing.T) {
+    input := `let h = {"a": if (false) { 1 }}; [h["a"], has(h, "a"), h["b"], has(h, "b")]`
+    testObject(t, input, testEval(input), []interface{}{nil, true, nil, false})
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`let x = 1; let y = 2; let grid = {[x, y]: "cell"}; grid[[1, 2]]`, "cell"},
+        {`{[1, 2]: "a"}[[2, 1]]`, nil},
+        {`{[1, [2, 3]]: "nested"}[[1, [2, 3]]]`, "nested"},
+        {`{[]: "empty"}[[]]`, "empty"},
+        {`len({[1, 2]: 1, [1, 2]: 2})`, 1},
+        {`has({[0, 0]: true}, [0, 0])`, true},
+        {`let key = freeze({"a": 1, "b": 2}); {key: "hash"}[freeze({"b": 2, "a": 1})]`, "hash"},
+        {`{freeze({"a": [1]}): 1}[freeze({"a": [1]})]`, 1},
+        {`{freeze([{"a": 1}]): 1}[freeze([{"a": 1}])]`, 1},
+        {`{{"a": 1}: 1}`, errors.New("unusable as hash key: mutable HASH, freeze it first")},
+        {`{"a": 1}[{"a": 1}]`, errors.New("unusable as hash key: mutable HASH, freeze it first")},
+        {`{[{"a": 1}]: 1}`, errors.New("unusable as hash key: mutable HASH, freeze it first")},
+        {`{[fn(x) { x }]: 1}`, errors.New("unusable as hash key: FUNCTION")},
+        {`{freeze({"f": fn(x) { x }}): 1}`, errors.New("unusable as hash key: FUNCTION")},
+        {`has({}, {})`, errors.New("unusable as hash key: mutable HASH, freeze it first")},
+        {`let h = freeze({"a": 1}); remove(h, "a")`, errors.New("cannot modify frozen HASH")},
+        {`let h = freeze({"a": 1}); delete(h, "a")["a"]`, nil},
+        {`let h = {"a": 1}; let f = freeze(h); remove(h, "a"); f["a"]`, 1},
+        {`let memo = {}; let memo = merge(memo, {[3, 4]: 7}); memo[[3, 4]]`, 7},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
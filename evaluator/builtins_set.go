@@ -0,0 +1,72 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/object"
+)
+
+var setBuiltins = map[string]*object.Builtin{
+    "set": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) > 1 {
+                return newError("wrong number of arguments. got=%d, want=0..1", len(args))
+            }
+            set := object.NewSet()
+            if len(args) == 0 {
+                return set
+            }
+            elements, ok := iterableElements(args[0])
+            if !ok {
+                return newError("argument 1 to `set` must be iterable, got %s", args[0].Type())
+            }
+            if len(elements) == 1 && isError(elements[0]) {
+                return elements[0]
+            }
+            return addMembers(set, elements)
+        },
+    },
+    "add": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("add", args, 2, 2, object.SET_OBJ); err != nil {
+                return err
+            }
+            member, err := asHashKey(args[1])
+            if err != nil {
+                return err
+            }
+            return nativeBoolToBooleanObject(args[0].(*object.Set).Add(member))
+        },
+    },
+}
+
+// addMembers adds each of elements to set, failing on the first one that
+// cannot be hashed.
+func addMembers(set *object.Set, elements []object.Object) object.Object {
+    for _, el := range elements {
+        member, err := asHashKey(el)
+        if err != nil {
+            return err
+        }
+        set.Add(member)
+    }
+    return set
+}
+
+func evalSetInfixExpression(operator string, left, right object.Object) object.Object {
+    leftVal := left.(*object.Set)
+    rightVal := right.(*object.Set)
+
+    switch operator {
+    case "|":
+        return leftVal.Union(rightVal)
+    case "&":
+        return leftVal.Intersection(rightVal)
+    case "-":
+        return leftVal.Difference(rightVal)
+    case "==":
+        return nativeBoolToBooleanObject(object.Equals(left, right))
+    case "!=":
+        return nativeBoolToBooleanObject(!object.Equals(left, right))
+    default:
+        return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+    }
+}
@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestSets(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`len({1, 2, 2, 3})`, 3},
+        {`len(set())`, 0},
+        {`len(set([1, 1, "a"]))`, 2},
+        {`set(1)`, errors.New("argument 1 to `set` must be iterable, got INTEGER")},
+        {`{1, fn(x) { x }}`, errors.New("unusable as hash key: FUNCTION")},
+        {`{1, [2, 3]} == {[2, 3], 1}`, true},
+        {`{1, 2} == {1, 3}`, false},
+        {`{1, 2} != {1, 3}`, true},
+        {`{1, 2} == [1, 2]`, false},
+        {`has({1, 2}, 2)`, true},
+        {`has({1, 2}, 3)`, false},
+        {`has([1], 1)`, errors.New("argument 1 to `has` must be HASH or SET, got ARRAY")},
+        {`let s = {1}; add(s, 2)`, true},
+        {`let s = {1}; add(s, 1)`, false},
+        {`let s = {1}; add(s, 2); has(s, 2)`, true},
+        {`add({1}, {"a": 1})`, errors.New("unusable as hash key: mutable HASH, freeze it first")},
+        {`add({"a": 1}, 1)`, errors.New("argument 1 to `add` must be SET, got HASH")},
+        {`let s = {1, 2}; remove(s, 1)`, true},
+        {`let s = {1, 2}; remove(s, 3)`, false},
+        {`let s = {1, 2}; remove(s, 1); len(s)`, 1},
+        {`let u = {1, 2} | {2, 3}; u == {1, 2, 3}`, true},
+        {`len({1} | {2} & {1})`, 1},
+        {`sort({3, 1} | {2})`, []int{1, 2, 3}},
+        {`sort({1, 2, 3} & {2, 3, 4})`, []int{2, 3}},
+        {`sort({1, 2, 3} - {2})`, []int{1, 3}},
+        {`{1} < {2}`, errors.New("unknown operator: SET < SET")},
+        {`{1} * {2}`, errors.New("unknown operator: SET * SET")},
+        {`{1} | [2]`, errors.New("type mismatch: SET | ARRAY")},
+        {`map({1, 2, 3}, fn(x) { x * 2 })`, []int{2, 4, 6}},
+        {`filter({1, 2, 3}, fn(x) { x > 1 })`, []int{2, 3}},
+        {`reduce({1, 2, 3}, fn(acc, x) { acc + x })`, 6},
+        {`any({1, 2}, fn(x) { x > 1 })`, true},
+        {`all({1, 2}, fn(x) { x > 1 })`, false},
+        {`find({1, 2, 3}, fn(x) { x > 1 })`, 2},
+        {`sort(set({3, 1}))`, []int{1, 3}},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestSetInspect(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`{3, 1, 2}`, "{3, 1, 2}"},
+        {`set()`, "set()"},
+        {`let s = {"a", 1}; add(s, true); s`, `{a, 1, true}`},
+    }
+
+    for _, tt := range tests {
+        if got := testEval(tt.input).Inspect(); got != tt.expected {
+            t.Errorf("%s: wrong Inspect. got=%q, want=%q", tt.input, got, tt.expected)
+        }
+    }
+}
@@ -0,0 +1,155 @@
+package evaluator
+
+import (
+    "fmt"
+    "strings"
+
+    "necronet.info/interpreter/object"
+)
+
+// maxRepeatLength bounds the length of the strings repeat builds, which
+// would otherwise exhaust memory or overflow.
+const maxRepeatLength = 1 << 30
+
+var stringBuiltins = map[string]*object.Builtin{
+    "split": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("split", args, 1, 2, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+                return err
+            }
+            str := args[0].(*object.String).Value
+            var parts []string
+            if len(args) == 1 {
+                parts = strings.Fields(str)
+            } else {
+                parts = strings.Split(str, args[1].(*object.String).Value)
+            }
+            elements := make([]object.Object, len(parts))
+            for i, part := range parts {
+                elements[i] = &object.String{Value: part}
+            }
+            return &object.Array{Elements: elements}
+        },
+    },
+    "join": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("join", args, 1, 2, object.ARRAY_OBJ, object.STRING_OBJ); err != nil {
+                return err
+            }
+            elements := args[0].(*object.Array).Elements
+            parts := make([]string, len(elements))
+            for i, el := range elements {
+                str, ok := el.(*object.String)
+                if !ok {
+                    return newError("argument to `join` must be ARRAY of STRING, got %s at index %d", el.Type(), i)
+                }
+                parts[i] = str.Value
+            }
+            sep := ""
+            if len(args) == 2 {
+                sep = args[1].(*object.String).Value
+            }
+            return &object.String{Value: strings.Join(parts, sep)}
+        },
+    },
+    "trim": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("trim", args, 1, 2, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+                return err
+            }
+            str := args[0].(*object.String).Value
+            if len(args) == 2 {
+                return &object.String{Value: strings.Trim(str, args[1].(*object.String).Value)}
+            }
+            return &object.String{Value: strings.TrimSpace(str)}
+        },
+    },
+    "upper": stringFunction("upper", strings.ToUpper),
+    "lower": stringFunction("lower", strings.ToLower),
+    "replace": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("replace", args, 3, 3, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+                return err
+            }
+            str := args[0].(*object.String).Value
+            old, new := args[1].(*object.String).Value, args[2].(*object.String).Value
+            return &object.String{Value: strings.ReplaceAll(str, old, new)}
+        },
+    },
+    "starts_with": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("starts_with", args, 2, 2, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+                return err
+            }
+            str, prefix := args[0].(*object.String).Value, args[1].(*object.String).Value
+            return nativeBoolToBooleanObject(strings.HasPrefix(str, prefix))
+        },
+    },
+    "ends_with": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("ends_with", args, 2, 2, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+                return err
+            }
+            str, suffix := args[0].(*object.String).Value, args[1].(*object.String).Value
+            return nativeBoolToBooleanObject(strings.HasSuffix(str, suffix))
+        },
+    },
+    "repeat": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs("repeat", args, 2, 2, object.STRING_OBJ, object.INTEGER_OBJ); err != nil {
+                return err
+            }
+            str, count := args[0].(*object.String).Value, args[1].(*object.Integer).Value
+            if count < 0 {
+                return newError("negative count to `repeat`: %d", count)
+            }
+            if len(str) != 0 && count > maxRepeatLength/int64(len(str)) {
+                return newError("result of `repeat` too long: %d times %d bytes, the maximum is %d bytes",
+                    count, len(str), maxRepeatLength)
+            }
+            return &object.String{Value: strings.Repeat(str, int(count))}
+        },
+    },
+    "format": &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if len(args) < 1 {
+                return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+            }
+            if args[0].Type() != object.STRING_OBJ {
+                return newError("argument 1 to `format` must be STRING, got %s", args[0].Type())
+            }
+            values := make([]interface{}, len(args)-1)
+            for i, arg := range args[1:] {
+                values[i] = formatValue(arg)
+            }
+            return &object.String{Value: fmt.Sprintf(args[0].(*object.String).Value, values...)}
+        },
+    },
+}
+
+// stringFunction wraps a function from string to string as a builtin.
+func stringFunction(name string, fn func(string) string) *object.Builtin {
+    return &object.Builtin{
+        Fn: func(args ...object.Object) object.Object {
+            if err := checkArgs(name, args, 1, 1, object.STRING_OBJ); err != nil {
+                return err
+            }
+            return &object.String{Value: fn(args[0].(*object.String).Value)}
+        },
+    }
+}
+
+// formatValue converts an object into the Go value handed to fmt by
+// `format`, so that verbs like %d and %t work on Monkey values.
+func formatValue(obj object.Object) interface{} {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        return obj.Value
+    case *object.String:
+        return obj.Value
+    case *object.Boolean:
+        return obj.Value
+    default:
+        return obj.Inspect()
+    }
+}
@@ -0,0 +1,136 @@
+package evaluator
+
+import (
+    "errors"
+    "testing"
+
+    "necronet.info/interpreter/object"
+)
+
+func TestStringBuiltins(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`split("a,b,c", ",")`, []string{"a", "b", "c"}},
+        {`split("  a b   c ")`, []string{"a", "b", "c"}},
+        {`split("", ",")`, []string{""}},
+        {`split(1, ",")`, errors.New("argument 1 to `split` must be STRING, got INTEGER")},
+        {`join(["a", "b", "c"], "-")`, "a-b-c"},
+        {`join(["a", "b"])`, "ab"},
+        {`join([], ",")`, ""},
+        {`join(["a", 1], ",")`, errors.New("argument to `join` must be ARRAY of STRING, got INTEGER at index 1")},
+        {`trim("  hi  ")`, "hi"},
+        {`trim("xxhixx", "x")`, "hi"},
+        {`upper("Hello")`, "HELLO"},
+        {`lower("Hello")`, "hello"},
+        {`upper("a", "b")`, errors.New("wrong number of arguments. got=2, want=1")},
+        {`contains("monkey", "key")`, true},
+        {`contains("monkey", "donkey")`, false},
+        {`index_of("monkey", "key")`, 3},
+        {`index_of("monkey", "z")`, -1},
+        {`index_of("héllo", "l")`, 3},
+        {`len("héllo")`, 6},
+        {`slice("héllo", 0, 3)`, "hé"},
+        {`slice("héllo", index_of("héllo", "é"))`, "éllo"},
+        {`slice("héllo", 0, 2)`, "h\xc3"},
+        {`replace("a-b-c", "-", "+")`, "a+b+c"},
+        {`starts_with("monkey", "mon")`, true},
+        {`starts_with("monkey", "key")`, false},
+        {`ends_with("monkey", "key")`, true},
+        {`ends_with("monkey", "mon")`, false},
+        {`repeat("ab", 3)`, "ababab"},
+        {`repeat("ab", 0)`, ""},
+        {`repeat("ab", -1)`, errors.New("negative count to `repeat`: -1")},
+        {`repeat("ab", 9223372036854775807)`, errors.New("result of `repeat` too long: 9223372036854775807 times 2 bytes, the maximum is 1073741824 bytes")},
+        {`repeat("ab", 536870913)`, errors.New("result of `repeat` too long: 536870913 times 2 bytes, the maximum is 1073741824 bytes")},
+        {`repeat("", 9223372036854775807)`, ""},
+        {`format("%s is %d", "answer", 42)`, "answer is 42"},
+        {`format("%t %v %q", true, [1, 2], "x")`, `true [1, 2] "x"`},
+        {`format("plain")`, "plain"},
+        {`format()`, errors.New("wrong number of arguments. got=0, want at least 1")},
+        {`format(1)`, errors.New("argument 1 to `format` must be STRING, got INTEGER")},
+        {`slice("monkey", 1, 3)`, "on"},
+        {`slice("monkey", 3)`, "key"},
+        {`slice("monkey", -3)`, "key"},
+        {`slice("monkey", 0, -1)`, "monke"},
+        {`slice("monkey", 4, 2)`, ""},
+        {`slice("monkey", 2, 100)`, "nkey"},
+        {`slice("monkey")`, errors.New("wrong number of arguments. got=1, want=2..3")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+// testObject checks obj against an expected Go value: int, bool and string
+// for scalars, []string, []int and []interface{} for arrays, nil for NULL
+// and an error for an Error object with the same message.
+func testObject(t *testing.T, input string, obj object.Object, expected interface{}) bool {
+    t.Helper()
+    switch expected := expected.(type) {
+    case int:
+        return testIntegerObject(t, obj, int64(expected))
+    case bool:
+        return testBooleanObject(t, obj, expected)
+    case nil:
+        return testNullObject(t, obj)
+    case string:
+        str, ok := obj.(*object.String)
+        if !ok {
+            t.Errorf("%s: object is not String. got=%T (%+v)", input, obj, obj)
+            return false
+        }
+        if str.Value != expected {
+            t.Errorf("%s: String has wrong value. got=%q, want=%q", input, str.Value, expected)
+            return false
+        }
+    case []string:
+        array, ok := obj.(*object.Array)
+        if !ok || len(array.Elements) != len(expected) {
+            t.Errorf("%s: object is not Array of %d elements. got=%T (%+v)", input, len(expected), obj, obj)
+            return false
+        }
+        for i, el := range array.Elements {
+            if !testObject(t, input, el, expected[i]) {
+                return false
+            }
+        }
+    case []int:
+        array, ok := obj.(*object.Array)
+        if !ok || len(array.Elements) != len(expected) {
+            t.Errorf("%s: object is not Array of %d elements. got=%T (%+v)", input, len(expected), obj, obj)
+            return false
+        }
+        for i, el := range array.Elements {
+            if !testIntegerObject(t, el, int64(expected[i])) {
+                return false
+            }
+        }
+    case []interface{}:
+        array, ok := obj.(*object.Array)
+        if !ok || len(array.Elements) != len(expected) {
+            t.Errorf("%s: object is not Array of %d elements. got=%T (%+v)", input, len(expected), obj, obj)
+            return false
+        }
+        for i, el := range array.Elements {
+            if !testObject(t, input, el, expected[i]) {
+                return false
+            }
+        }
+    case error:
+        errObj, ok := obj.(*object.Error)
+        if !ok {
+            t.Errorf("%s: object is not Error. got=%T (%+v)", input, obj, obj)
+            return false
+        }
+        if errObj.Message != expected.Error() {
+            t.Errorf("%s: wrong error message. expected=%q, got=%q", input, expected.Error(), errObj.Message)
+            return false
+        }
+    default:
+        t.Fatalf("%s: unsupported expectation %T", input, expected)
+    }
+    return true
+}
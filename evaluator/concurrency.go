@@ -0,0 +1,40 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/object"
+)
+
+// evalSpawnExpression starts a task. For spawn f(a, b) the function and
+// its arguments are evaluated before the task starts, so only the call
+// itself runs concurrently.
+func (in *Interpreter) evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+    var fn object.Object
+    var args []object.Object
+    if call, ok := node.Call.(*ast.CallExpression); ok {
+        fn = in.Eval(call.Function, env)
+        if isError(fn) {
+            return fn
+        }
+        args = in.evalExpressions(call.Arguments, env)
+        if len(args) == 1 && isError(args[0]) {
+            return args[0]
+        }
+    } else {
+        fn = in.Eval(node.Call, env)
+        if isError(fn) {
+            return fn
+        }
+    }
+    if !isCallable(fn) {
+        return newError("cannot spawn %s", fn.Type())
+    }
+
+    // The task imports modules as an evaluation of its own, while still
+    // resolving paths relative to the module spawning it.
+    task := *in
+    task.importer = nil
+    return object.NewTask(func() object.Object {
+        return task.applyFunction(fn, args, env)
+    })
+}
@@ -0,0 +1,127 @@
+package evaluator
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/parser"
+)
+
+func TestConcurrency(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`await(spawn fn() { 1 + 2 })`, 3},
+        {`let add = fn(a, b) { a + b }; await(spawn add(1, 2))`, 3},
+        {`let t = spawn fn() { 1 + true }; await(t)`, errors.New("type mismatch: INTEGER + BOOLEAN")},
+        {`spawn 1`, errors.New("cannot spawn INTEGER")},
+        {`spawn f(1)`, errors.New("identifier not found: f")},
+        {`spawn len(x)`, errors.New("identifier not found: x")},
+        {`await(1)`, errors.New("argument 1 to `await` must be TASK, got INTEGER")},
+        {`let ch = chan(); spawn fn() { send(ch, "ping") }; recv(ch)`, "ping"},
+        {`let ch = chan(2); send(ch, 1); send(ch, 2); [recv(ch), recv(ch)]`, []int{1, 2}},
+        {`let ch = chan(1); send(ch, 1); close(ch); [recv(ch), recv(ch)]`, []interface{}{1, nil}},
+        {`let ch = chan(1); close(ch); send(ch, 1)`, errors.New("send on closed channel")},
+        {`let ch = chan(); close(ch); close(ch)`, errors.New("close of closed channel")},
+        {`close(1)`, errors.New("argument to `close` not supported, got INTEGER")},
+        {`chan(-1)`, errors.New("negative size to `chan`: -1")},
+        {`send(1, 2)`, errors.New("argument 1 to `send` must be CHANNEL, got INTEGER")},
+        {`let ch = chan(); let work = fn(n) { send(ch, n * n) }; for (i in 1..=10) { spawn work(i) }; reduce(1..=10, fn(acc, _x) { acc + recv(ch) }, 0)`, 385},
+        {`let a = chan(); let b = chan(1); send(b, "b"); select(a, b)`, []interface{}{1, "b"}},
+        {`let a = chan(1); let b = chan(); select([a, "sent"], b)[0]`, 0},
+        {`let a = chan(1); select([a, "sent"]); recv(a)`, "sent"},
+        {`let a = chan(); close(a); select(a)`, []interface{}{0, nil}},
+        {`let a = chan(); close(a); select([a, 1])`, errors.New("send on closed channel")},
+        {`select(1)`, errors.New("argument 1 to `select` must be CHANNEL or [CHANNEL, value], got INTEGER")},
+        {`select([1, 2])`, errors.New("argument 1 to `select` must be CHANNEL or [CHANNEL, value], got ARRAY")},
+        {`select()`, errors.New("wrong number of arguments. got=0, want at least 1")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestConcurrencyInspect(t *testing.T) {
+    if got := testEval(`chan()`).Inspect(); got != "channel" {
+        t.Errorf("wrong Inspect. got=%q", got)
+    }
+    if got := testEval(`spawn fn() { 1 }`).Inspect(); got != "task" {
+        t.Errorf("wrong Inspect. got=%q", got)
+    }
+}
+
+func TestTasksShareEnvironment(t *testing.T) {
+    input := `
+    let results = chan(20);
+    let work = fn(n) {
+        let local = n * 2;
+        send(results, local);
+    };
+    let tasks = map(0..20, fn(n) { spawn work(n) });
+    for (task in tasks) { await(task) };
+    len(set(map(0..20, fn(_x) { recv(results) })))
+    `
+    testObject(t, "tasks", testEval(input), 20)
+}
+
+func TestTasksShareSetsAndHashes(t *testing.T) {
+    input := `
+    let s = set();
+    let h = reduce(0..800, fn(acc, i) { merge(acc, {i: i}) }, {});
+    let work = fn(n) {
+        for (i in 0..100) {
+            add(s, n * 100 + i);
+            add(s, i);
+            remove(h, n * 100 + i);
+        }
+    };
+    let tasks = map(0..8, fn(n) { spawn work(n) });
+    for (task in tasks) { await(task) };
+    [len(s), len(h)]
+    `
+    testObject(t, "tasks", testEval(input), []int{800, 0})
+}
+
+func TestInterpretersShareProgram(t *testing.T) {
+    program := parser.New(lexer.New(`
+    let offset = 10;
+    let add = fn(x) { let y = x + offset; y };
+    reduce(1..=10, fn(acc, x) { acc + add(x) }, 0)
+    `)).ParseProgram()
+    before := program.String()
+
+    results := make(chan object.Object)
+    for i := 0; i < 8; i++ {
+        go func() {
+            results <- New().Eval(program, object.NewEnvironment())
+        }()
+    }
+    for i := 0; i < 8; i++ {
+        testObject(t, "shared program", <-results, 155)
+    }
+    if program.String() != before {
+        t.Errorf("program changed by Eval: %q", program.String())
+    }
+}
+
+func TestBlockingOperationsStopWhenContextIsDone(t *testing.T) {
+    inputs := []string{
+        `recv(chan())`,
+        `send(chan(), 1)`,
+        `select(chan())`,
+        `await(spawn fn() { recv(chan()) })`,
+    }
+
+    for _, input := range inputs {
+        ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+        in := New().WithContext(ctx)
+        testObject(t, input, testEvalWith(in, input), errors.New("context deadline exceeded"))
+        cancel()
+    }
+}
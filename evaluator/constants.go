@@ -0,0 +1,22 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/object"
+)
+
+// buildConstants stores in every integer and string literal of node the
+// object it evaluates to, so that evaluating a literal allocates nothing.
+// It runs before the program does, as tasks may evaluate the same
+// literals concurrently.
+func buildConstants(node ast.Node) {
+    ast.Inspect(node, func(node ast.Node) bool {
+        switch node := node.(type) {
+        case *ast.IntegerLiteral:
+            node.Object = object.NewInteger(node.Value)
+        case *ast.StringLiteral:
+            node.Object = &object.String{Value: node.Value}
+        }
+        return true
+    })
+}
@@ -5,6 +5,7 @@ import (
 
 	"necronet.info/interpreter/ast"
 	"necronet.info/interpreter/object"
+	"necronet.info/interpreter/resolver"
 )
 
 var (
@@ -21,122 +22,169 @@ func isError(obj object.Object) bool {
     return false
 }
 
+// Eval evaluates node with an interpreter that only knows the standard
+// builtins. Use New to get an interpreter that host functions can be
+// registered on.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+    return standard.Eval(node, env)
+}
+
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
 
     switch node := node.(type) {
     case *ast.Program:
-        return evalProgram(node, env)
+        return in.evalProgram(node, env)
     case *ast.ExpressionStatement:
-        return Eval(node.Expression, env)
+        return in.Eval(node.Expression, env)
     case *ast.LetStatement:
-        val := Eval(node.Value, env)
+        val := in.Eval(node.Value, env)
         if isError(val) {
             return val
         }
-        env.Set(node.Name.Value, val)
+        setIdentifier(env, node.Name, val)
+    case *ast.ExportStatement:
+        return in.Eval(node.Statement, env)
+    case *ast.ImportExpression:
+        return in.evalImportExpression(node, env)
     case *ast.HashLiteral:
-        return evalHashLiteral(node, env)
+        return in.evalHashLiteral(node, env)
+    case *ast.SetLiteral:
+        elements := in.evalExpressions(node.Elements, env)
+        if len(elements) == 1 && isError(elements[0]) {
+            return elements[0]
+        }
+        return addMembers(object.NewSet(), elements)
     case *ast.CallExpression:
-        function := Eval(node.Function, env)
+        if node.Calls("quote") {
+            return in.evalQuote(node, env)
+        }
+        function := in.Eval(node.Function, env)
         if isError(function) {
             return function
         }
-        args := evalExpressions(node.Arguments, env)
+        args := in.evalExpressions(node.Arguments, env)
         if len(args) == 1 && isError(args[0]) {
             return args[0]
         }
-        return applyFunction(function, args)
+        return in.applyFunction(function, args, env)
     case *ast.FunctionLiteral:
         params := node.Parameters
         body := node.Body
-        return &object.Function{Parameters: params, Env: env, Body: body}
+        return &object.Function{Parameters: params, Env: env, Body: body, IsGenerator: node.IsGenerator, Locals: node.Locals}
+    case *ast.MacroLiteral:
+        return newError("macros can only be defined by a top-level let")
     case *ast.ArrayLiteral:
-        elements := evalExpressions(node.Elements, env)
+        elements := in.evalExpressions(node.Elements, env)
         if len(elements) == 1 && isError(elements[0]) {
             return elements[0]
         }
         return &object.Array{Elements: elements}
     case *ast.IndexExpression:
-        left := Eval(node.Left, env)
+        left := in.Eval(node.Left, env)
         if isError(left) {
             return left
         }
-        index := Eval(node.Index, env)
+        index := in.Eval(node.Index, env)
         if isError(index) {
             return index
         }
-        return evalIndexExpression(left, index)
+        return in.evalIndexExpression(left, index)
+    case *ast.SliceExpression:
+        return in.evalSliceExpression(node, env)
     case *ast.StringLiteral:
+        if str, ok := node.Object.(*object.String); ok {
+            return str
+        }
         return &object.String{Value: node.Value}
     case *ast.Identifier:
-        return evalIdentifier(node, env)
+        return in.evalIdentifier(node, env)
     case *ast.PrefixExpression:
-        right := Eval(node.Right, env)
+        right := in.Eval(node.Right, env)
         if isError(right) {
             return right
         }
         return evalPrefixExpression(node.Operator, right)
     case *ast.InfixExpression:
-        left := Eval(node.Left, env)
+        left := in.Eval(node.Left, env)
         if isError(left) {
             return left
         }
-        right := Eval(node.Right, env)
+        right := in.Eval(node.Right, env)
         if isError(right) {
             return right
          }
         return evalInfixExpression(node.Operator, left, right)
         // Expressions
     case *ast.ReturnStatement:
-        val := Eval(node.ReturnValue, env)
+        val := in.Eval(node.ReturnValue, env)
         if isError(val) {
             return val
         }
         return &object.ReturnValue{Value: val}
     case *ast.BlockStatement:
-        return evalBlockStatements(node, env) 
+        return in.evalBlockStatements(node, env) 
     case *ast.IfExpression:
-        return evalIfExpression(node, env)
+        return in.evalIfExpression(node, env)
+    case *ast.ForExpression:
+        return in.evalForExpression(node, env)
+    case *ast.YieldExpression:
+        return in.evalYieldExpression(node, env)
+    case *ast.SpawnExpression:
+        return in.evalSpawnExpression(node, env)
     case *ast.IntegerLiteral:
-        return &object.Integer{Value: node.Value}
+        if integer, ok := node.Object.(*object.Integer); ok {
+            return integer
+        }
+        return object.NewInteger(node.Value)
     case *ast.Boolean:
         return nativeBoolToBooleanObject(node.Value)
     }
     return NULL 
 }
 
-func evalHashLiteral(
+func (in *Interpreter) evalHashLiteral(
     node *ast.HashLiteral,
     env *object.Environment,
 ) object.Object {
-    pairs := make(map[object.HashKey]object.HashPair)
-    for keyNode, valueNode := range node.Pairs {
-        key := Eval(keyNode, env)
+    hash := object.NewHash()
+    for _, pair := range node.Pairs {
+        key := in.Eval(pair.Key, env)
         if isError(key) {
             return key
         }
-        hashKey, ok := key.(object.Hashable)
-        if !ok {
-            return newError("unusable as hash key: %s", key.Type())
+        hashKey, err := asHashKey(key)
+        if err != nil {
+            return err
         }
-        value := Eval(valueNode, env)
+        value := in.Eval(pair.Value, env)
         if isError(value) {
             return value
         }
-        hashed := hashKey.HashKey()
-        pairs[hashed] = object.HashPair{Key: key, Value: value}
+        hash.Set(hashKey, value)
     }
-    return &object.Hash{Pairs: pairs}
+    return hash
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (in *Interpreter) applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 
     switch function := fn.(type) {
     case *object.Function:
+        if err := in.ctx.Err(); err != nil {
+            return newError("%s", err)
+        }
+        if len(args) < len(function.Parameters) {
+            return newError("wrong number of arguments. got=%d, want=%d", len(args), len(function.Parameters))
+        }
         extendedEnv := extendFunctionEnv(function, args)
-        evaluated := Eval(function.Body, extendedEnv)
+        if function.IsGenerator {
+            return in.newGenerator(function, extendedEnv)
+        }
+        evaluated := in.Eval(function.Body, extendedEnv)
         return unwrapReturnValue(evaluated)
     case *object.Builtin:
+        if function.ContextFn != nil {
+            return function.ContextFn(in.callContext(env), args...)
+        }
         return function.Fn(args...)
 
     default:
@@ -144,12 +192,16 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
     }
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+func (in *Interpreter) evalIndexExpression(left, index object.Object) object.Object {
     switch {
     case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-        return evalArrayIndexExpression(left, index)
+        return in.evalArrayIndexExpression(left, index)
+    case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+        return in.evalStringIndexExpression(left, index)
     case left.Type() == object.HASH_OBJ:
         return evalHashIndexExpression(left, index)
+    case left.Type() == object.MODULE_OBJ:
+        return evalModuleIndexExpression(left, index)
     default:
         return newError("index operator not supported: %s", left.Type())
     }
@@ -157,37 +209,75 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
     hashObject := hash.(*object.Hash)
-    key, ok := index.(object.Hashable)
-    if !ok {
-        return newError("unusable as hash key: %s", index.Type())
+    key, err := asHashKey(index)
+    if err != nil {
+        return err
     }
-    pair, ok := hashObject.Pairs[key.HashKey()]
+    value, ok := hashObject.Get(key)
     if !ok {
         return NULL
     }
-    return pair.Value
+    return value
 }
 
-func evalArrayIndexExpression(array, index object.Object) object.Object {
+func (in *Interpreter) evalArrayIndexExpression(array, index object.Object) object.Object {
     arrayObject := array.(*object.Array)
+    idx, ok := elementIndex(index, len(arrayObject.Elements))
+    if !ok {
+        return in.indexOutOfRange(index, len(arrayObject.Elements))
+    }
+    return arrayObject.Elements[idx]
+}
+
+// evalStringIndexExpression returns the byte at index as a string.
+func (in *Interpreter) evalStringIndexExpression(str, index object.Object) object.Object {
+    value := str.(*object.String).Value
+    idx, ok := elementIndex(index, len(value))
+    if !ok {
+        return in.indexOutOfRange(index, len(value))
+    }
+    return &object.String{Value: value[idx : idx+1]}
+}
+
+// elementIndex resolves an INTEGER index into a sequence of length
+// elements, counting negative indices back from the end.
+func elementIndex(index object.Object, length int) (int, bool) {
     idx := index.(*object.Integer).Value
-    max := int64(len(arrayObject.Elements) -1)
+    if idx < 0 {
+        idx += int64(length)
+    }
+    if idx < 0 || idx >= int64(length) {
+        return 0, false
+    }
+    return int(idx), true
+}
 
-    if idx < 0 || idx > max {
-        return NULL
+func (in *Interpreter) indexOutOfRange(index object.Object, length int) object.Object {
+    if in.strict {
+        return newError("index out of range: %d with length %d", index.(*object.Integer).Value, length)
     }
-    return arrayObject.Elements[idx]
+    return NULL
 }
 
 func extendFunctionEnv( fn *object.Function, args[]object.Object) *object.Environment {
 
-    env := object.NewEnclosedEnviroment(fn.Env)
+    env := object.NewFrame(fn.Env, fn.Locals)
     for paramIdx, param := range fn.Parameters {
-        env.Set(param.Value, args[paramIdx])
+        setIdentifier(env, param, args[paramIdx])
     }
     return env
 }
 
+// setIdentifier binds the identifier of a let, parameter or loop variable
+// to val in env, the frame it is declared in.
+func setIdentifier(env *object.Environment, ident *ast.Identifier, val object.Object) {
+    if ident.Binding == ast.Local {
+        env.SetLocal(ident.Slot, val)
+        return
+    }
+    env.Set(ident.Value, val)
+}
+
     func unwrapReturnValue(obj object.Object) object.Object {
         if returnValue, ok := obj.(*object.ReturnValue); ok {
             return returnValue.Value
@@ -195,11 +285,11 @@ func extendFunctionEnv( fn *object.Function, args[]object.Object) *object.Enviro
     return obj
 }
 
-func evalExpressions( exps []ast.Expression, env *object.Environment) []object.Object {
+func (in *Interpreter) evalExpressions( exps []ast.Expression, env *object.Environment) []object.Object {
     var result []object.Object
 
     for _, e := range exps {
-        evaluated := Eval(e, env)
+        evaluated := in.Eval(e, env)
         if isError(evaluated){
             return []object.Object{evaluated}
         }
@@ -208,16 +298,26 @@ func evalExpressions( exps []ast.Expression, env *object.Environment) []object.O
     return result
 }
 
+// asHashKey returns obj as a hash key, or an error explaining why it
+// cannot be one.
+func asHashKey(obj object.Object) (object.Hashable, *object.Error) {
+    key, err := object.AsHashable(obj)
+    if err != nil {
+        return nil, newError("%s", err)
+    }
+    return key, nil
+}
+
 func newError(format string, a ...interface{}) *object.Error {
     return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (in *Interpreter) evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
     var result object.Object
 
     for _, statement := range block.Statements {
 
-        result = Eval(statement, env)
+        result = in.Eval(statement, env)
         if result != nil {
             if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
                 return result
@@ -227,11 +327,23 @@ func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) obj
     return result
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+    program, err := in.ExpandMacros(program, env)
+    if err != nil {
+        return newError("%s", err)
+    }
+    // Resolving and building the constants write into the program, so
+    // they work on a copy: other interpreters may run the same program.
+    program = ast.Copy(program).(*ast.Program)
+    if errs := resolver.Resolve(program, in.defined(env)); len(errs) != 0 {
+        return newError("%s", errs[0].Message())
+    }
+    buildConstants(program)
+
     var result object.Object
 
     for _, statement := range program.Statements {
-        result = Eval(statement, env)
+        result = in.Eval(statement, env)
 
         switch result := result.(type) {
         case *object.ReturnValue:
@@ -243,22 +355,53 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
     return result
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-    condition := Eval(ie.Condition, env)
+func (in *Interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+    condition := in.Eval(ie.Condition, env)
     
     if isError(condition){
         return condition
     }
 
     if isTruth(condition) {
-        return Eval(ie.Consequence, env)
+        return in.Eval(ie.Consequence, env)
     } else if ie.Alternative != nil {
-        return Eval(ie.Alternative, env)
+        return in.Eval(ie.Alternative, env)
     } else {
         return NULL
     }
 }
 
+// evalForExpression runs the loop body in the enclosing environment, like
+// any other block, so the loop variable and lets in the body stay visible
+// after the loop. The loop itself evaluates to NULL.
+func (in *Interpreter) evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Object {
+    iterable := in.Eval(fe.Iterable, env)
+    if isError(iterable) {
+        return iterable
+    }
+    it, ok := iterate(iterable)
+    if !ok {
+        return newError("cannot iterate over %s", iterable.Type())
+    }
+
+    for el, ok := it.Next(); ok; el, ok = it.Next() {
+        if isError(el) {
+            return el
+        }
+        if err := in.ctx.Err(); err != nil {
+            return newError("%s", err)
+        }
+        setIdentifier(env, fe.Variable, el)
+        result := in.Eval(fe.Body, env)
+        if result != nil {
+            if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+                return result
+            }
+        }
+    }
+    return NULL
+}
+
 func isTruth(obj object.Object) bool {
     switch obj {
     case NULL:
@@ -279,10 +422,12 @@ func evalInfixExpression(
             return evalIntegerInfixExpression(operator, left, right)
         case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
             return evalStringInfixExpression(operator, left, right)
+        case left.Type() == object.SET_OBJ && right.Type() == object.SET_OBJ:
+            return evalSetInfixExpression(operator, left, right)
         case operator == "==":
-            return nativeBoolToBooleanObject(left == right)
+            return nativeBoolToBooleanObject(object.Equals(left, right))
         case operator == "!=":
-            return nativeBoolToBooleanObject(left != right)
+            return nativeBoolToBooleanObject(!object.Equals(left, right))
         case left.Type() != right.Type():
             return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
         default:
@@ -291,12 +436,19 @@ func evalInfixExpression(
     }
 
     func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-        if operator != "+" {
-            return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-        }
         leftVal := left.(*object.String).Value
         rightVal := right.(*object.String).Value
-        return &object.String{Value: leftVal + rightVal}
+
+        switch operator {
+        case "+":
+            return &object.String{Value: leftVal + rightVal}
+        case "==":
+            return nativeBoolToBooleanObject(leftVal == rightVal)
+        case "!=":
+            return nativeBoolToBooleanObject(leftVal != rightVal)
+        default:
+            return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+        }
     }
 
     func evalIntegerInfixExpression(
@@ -307,13 +459,16 @@ func evalInfixExpression(
 
             switch operator {
             case "+":
-                return &object.Integer{Value: leftVal + rightVal}
+                return object.NewInteger(leftVal + rightVal)
             case "-":
-                return &object.Integer{Value: leftVal - rightVal}
+                return object.NewInteger(leftVal - rightVal)
             case "*":
-                return &object.Integer{Value: leftVal * rightVal}
+                return object.NewInteger(leftVal * rightVal)
             case "/":
-                return &object.Integer{Value: leftVal / rightVal}
+                if rightVal == 0 {
+                    return newError("division by zero")
+                }
+                return object.NewInteger(leftVal / rightVal)
             case "<":
                 return nativeBoolToBooleanObject(leftVal < rightVal)
             case ">":
@@ -322,19 +477,28 @@ func evalInfixExpression(
                 return nativeBoolToBooleanObject(leftVal == rightVal) 
             case "!=":
                 return nativeBoolToBooleanObject(leftVal != rightVal) 
+            case "..":
+                return &object.Range{Start: leftVal, End: rightVal}
+            case "..=":
+                return &object.Range{Start: leftVal, End: rightVal, Inclusive: true}
             default:
                 return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
             }
         }
 
-        func evalIdentifier( node *ast.Identifier,
+        func (in *Interpreter) evalIdentifier( node *ast.Identifier,
         env *object.Environment,
     ) object.Object {
+        if node.Binding == ast.Local {
+            if val := env.Local(node.Depth, node.Slot); val != nil {
+                return val
+            }
+        }
         if val, ok := env.Get(node.Value); ok {
             return val
         }
 
-        if builtin, ok := builtins[node.Value]; ok {
+        if builtin, ok := in.builtins[node.Value]; ok {
             return builtin
         }
 
@@ -359,7 +523,7 @@ func evalInfixExpression(
                 return newError("unknown operator: -%s", right.Type())
             }
             value := right.(*object.Integer).Value
-            return &object.Integer{Value: -value}
+            return object.NewInteger(-value)
         }
 
         func evalBangOperatorExpression(right object.Object) object.Object {
@@ -382,11 +546,11 @@ func evalInfixExpression(
             return FALSE
         }
 
-        func evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
+        func (in *Interpreter) evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
             var result object.Object
 
             for _, statement := range stmts {
-                result = Eval(statement, env)
+                result = in.Eval(statement, env)
                 if returnValue, ok := result.(*object.ReturnValue); ok {
                     return returnValue.Value
                 }
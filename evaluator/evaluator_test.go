@@ -1,6 +1,11 @@
 package evaluator
 
 import(
+    "context"
+    "errors"
+    "strings"
+
+    "necronet.info/interpreter/ast"
     "necronet.info/interpreter/lexer"
     "necronet.info/interpreter/object"
     "necronet.info/interpreter/parser"
@@ -140,23 +145,59 @@ func TestHashLiterals(t *testing.T) {
     if !ok {
         t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
     }
-    expected := map[object.HashKey]int64{
-        (&object.String{Value: "one"}).HashKey(): 1,
-        (&object.String{Value: "two"}).HashKey(): 2,
-        (&object.String{Value: "three"}).HashKey(): 3,
-        (&object.Integer{Value: 4}).HashKey(): 4,
-        TRUE.HashKey(): 5,
-        FALSE.HashKey(): 6,
+    expected := map[object.Hashable]int64{
+        &object.String{Value: "one"}: 1,
+        &object.String{Value: "two"}: 2,
+        &object.String{Value: "three"}: 3,
+        &object.Integer{Value: 4}: 4,
+        TRUE: 5,
+        FALSE: 6,
     }
-    if len(result.Pairs) != len(expected) {
-        t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+    if result.Len() != len(expected) {
+        t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
     }
     for expectedKey, expectedValue := range expected {
-        pair, ok := result.Pairs[expectedKey]
+        value, ok := result.Get(expectedKey)
         if !ok {
             t.Errorf("no pair for given key in Pairs")
+            continue
+        }
+        testIntegerObject(t, value, expectedValue)
+    }
+    if result.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+        t.Errorf("hash not in insertion order. got=%q", result.Inspect())
+    }
+}
+
+func TestHashLiteralsEvaluateKeysInSourceOrder(t *testing.T) {
+    in := New()
+    calls := []string{}
+    err := in.Register("trace", func(s string) string {
+        calls = append(calls, s)
+        return s
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    input := `{trace("c"): trace("1"), trace("a"): trace("2"), trace("b"): trace("3")}`
+    for i := 0; i < 20; i++ {
+        calls = calls[:0]
+        evaluated := testEvalWith(in, input)
+        if evaluated.Inspect() != "{c: 1, a: 2, b: 3}" {
+            t.Fatalf("hash not in insertion order. got=%q", evaluated.Inspect())
+        }
+        if strings.Join(calls, ",") != "c,1,a,2,b,3" {
+            t.Fatalf("hash literal evaluated out of order. got=%v", calls)
         }
-        testIntegerObject(t, pair.Value, expectedValue)
+    }
+}
+
+func TestHashOverwriteKeepsPosition(t *testing.T) {
+    input := `{"a": 1, "b": 2, "a": 3}`
+    evaluated := testEval(input)
+    if evaluated.Inspect() != "{a: 3, b: 2}" {
+        t.Errorf("wrong hash. got=%q", evaluated.Inspect())
     }
 }
 
@@ -203,6 +244,18 @@ func TestArrayIndexExpressions(t *testing.T) {
         },
         {
             "[1, 2, 3][-1]",
+            3,
+        },
+        {
+            "[1, 2, 3][-3]",
+            1,
+        },
+        {
+            "[1, 2, 3][-4]",
+            nil,
+        },
+        {
+            "[][0]",
             nil,
         },
     }
@@ -325,6 +378,7 @@ func TestErrorHandling(t *testing.T) {
             `, "unknown operator: BOOLEAN + BOOLEAN",
         },
         { "foobar", "identifier not found: foobar"},
+        { "10 / 0", "division by zero"},
         {`"Hello" - "World"`, "unknown operator: STRING - STRING"},
         {
             `{"name": "Monkey"}[fn(x) { x }];`,
@@ -415,6 +469,21 @@ func TestEvalBooleanExpression(t *testing.T){
         {"false == true", false},
         {"true == false", false},
         {"true != false", true},
+        {`"a" == "a"`, true},
+        {`"a" == "b"`, false},
+        {`"a" != "b"`, true},
+        {"[1, 2] == [1, 2]", true},
+        {"[1, 2] == [2, 1]", false},
+        {"[1, [2, 3]] == [1, [2, 3]]", true},
+        {"[1, 2] != [1, 2, 3]", true},
+        {`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+        {`{"a": 1} == {"a": 2}`, false},
+        {`{"a": 1} != {"b": 1}`, true},
+        {"[] == {}", false},
+        {`1 == "1"`, false},
+        {"let a = [1]; a == a", true},
+        {"let f = fn() { 1 }; f == f", true},
+        {"fn() { 1 } == fn() { 1 }", false},
     }
 
     for _, tt  := range tests {
@@ -482,3 +551,140 @@ if result.Value != expected {
 return true
 
 }
+
+func TestRangeExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`len(0..10)`, 10},
+        {`len(0..=10)`, 11},
+        {`len(5..0)`, 0},
+        {`let n = 4; len(1..n - 1)`, 2},
+        {`len(0..1000000000000)`, 1000000000000},
+        {`len(-5000000000000000000..5000000000000000000)`, 9223372036854775807},
+        {`find(-5000000000000000000..5000000000000000000, fn(x) { true })`, -5000000000000000000},
+        {`map(0..4, fn(x) { x * x })`, []int{0, 1, 4, 9}},
+        {`filter(1..=10, fn(x) { x > 8 })`, []int{9, 10}},
+        {`reduce(1..=4, fn(acc, x) { acc * x })`, 24},
+        {`find(0..1000000000000, fn(x) { x > 3 })`, 4},
+        {`any(0..1000000000000, fn(x) { x > 3 })`, true},
+        {`sort(3..0)`, []int{}},
+        {`len(set(0..3))`, 3},
+        {`0..3 == 0..=2`, true},
+        {`0..3 == 0..3`, true},
+        {`0..3 == 1..4`, false},
+        {`1..0 == 5..2`, true},
+        {`"a".."b"`, errors.New("unknown operator: STRING .. STRING")},
+        {`1.."b"`, errors.New("type mismatch: INTEGER .. STRING")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestRangeInspect(t *testing.T) {
+    if got := testEval(`1..3`).Inspect(); got != "1..3" {
+        t.Errorf("wrong Inspect. got=%q", got)
+    }
+    if got := testEval(`1..=3`).Inspect(); got != "1..=3" {
+        t.Errorf("wrong Inspect. got=%q", got)
+    }
+}
+
+func TestForExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`let total = 0; for (x in 1..=4) { let total = total + x; }; total`, 10},
+        {`let total = 0; for (x in [1, 2, 3]) { let total = total + x; }; total`, 6},
+        {`let seen = set(); for (x in {1, 2, 3}) { add(seen, x * 10) }; sort(seen)`, []int{10, 20, 30}},
+        {`for (x in 0..3) { x }`, nil},
+        {`for (x in 0..3) { x }; x`, 2},
+        {`for (x in []) { x }`, nil},
+        {`let f = fn() { for (x in 0..1000000000000) { if (x > 2) { return x; } } }; f()`, 3},
+        {`let s = {1, 2}; for (x in s) { remove(s, x) }; len(s)`, 0},
+        {`for (x in 1) { x }`, errors.New("cannot iterate over INTEGER")},
+        {`for (x in {"a": 1}) { x }`, errors.New("cannot iterate over HASH")},
+        {`for (x in 0..3) { x + true }`, errors.New("type mismatch: INTEGER + BOOLEAN")},
+        {`for (x in y) { x }`, errors.New("identifier not found: y")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestScopes(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`let f = fn(a) { let b = a * 2; fn(c) { a + b + c } }; f(1)(10)`, 13},
+        {`let f = fn(len) { len }; f(3) + len([1])`, 4},
+        {`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; odd(7)`, true},
+        {`if (false) { foobar }`, errors.New("identifier not found: foobar")},
+        {`let f = fn() { let x = 1 }; f(); x`, errors.New("identifier not found: x")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestLiteralsAreBuiltOnce(t *testing.T) {
+    for _, input := range []string{`let f = fn() { "s" }; [f(), f()]`, `let f = fn() { 100000 }; [f(), f()]`} {
+        evaluated := testEval(input)
+        array, ok := evaluated.(*object.Array)
+        if !ok {
+            t.Fatalf("%s: object is not Array. got=%T (%+v)", input, evaluated, evaluated)
+        }
+        if array.Elements[0] != array.Elements[1] {
+            t.Errorf("%s: literal evaluated to distinct objects", input)
+        }
+    }
+}
+
+func TestLiteralObjectsStayOutOfTheProgram(t *testing.T) {
+    program := parser.New(lexer.New(`let f = fn() { "s" }; [f(), 100000]`)).ParseProgram()
+    Eval(program, object.NewEnvironment())
+
+    ast.Inspect(program, func(node ast.Node) bool {
+        switch node := node.(type) {
+        case *ast.IntegerLiteral:
+            if node.Object != nil {
+                t.Errorf("Object of %s set in the program passed to Eval", node)
+            }
+        case *ast.StringLiteral:
+            if node.Object != nil {
+                t.Errorf("Object of %s set in the program passed to Eval", node)
+            }
+        }
+        return true
+    })
+}
+
+func TestUnknownIdentifierStopsBeforeRunning(t *testing.T) {
+    env := object.NewEnvironment()
+    env.Set("known", &object.Integer{Value: 1})
+
+    program := parser.New(lexer.New(`let a = fn() { known }(); a`)).ParseProgram()
+    testObject(t, "known", Eval(program, env), 1)
+
+    program = parser.New(lexer.New(`let b = 2; unknown`)).ParseProgram()
+    evaluated := Eval(program, env)
+    testObject(t, "unknown", evaluated, errors.New("identifier not found: unknown"))
+    if _, ok := env.Get("b"); ok {
+        t.Errorf("b was set before the error was reported")
+    }
+}
+
+func TestForExpressionStopsWhenContextIsDone(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    in := New().WithContext(ctx)
+
+    testObject(t, "loop", testEvalWith(in, `for (x in 0..10) { x }`), errors.New("context canceled"))
+}
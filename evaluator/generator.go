@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/object"
+)
+
+// newGenerator returns the generator for a call of a generator function
+// whose arguments are bound in env. The body runs on a copy of the
+// interpreter that knows where to send yielded values.
+func (in *Interpreter) newGenerator(fn *object.Function, env *object.Environment) *object.Generator {
+    return object.NewGenerator(in.ctx, func(yield object.YieldFunction) object.Object {
+        gen := *in
+        gen.yield = yield
+        result := unwrapReturnValue(gen.Eval(fn.Body, env))
+        if isError(result) {
+            return result
+        }
+        return NULL
+    })
+}
+
+// evalYieldExpression suspends the generator until its next value is asked
+// for. When the generator is closed instead, it unwinds the body with an
+// error nobody sees.
+func (in *Interpreter) evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+    if in.yield == nil {
+        return newError("yield outside of a generator")
+    }
+    var value object.Object = NULL
+    if node.Value != nil {
+        value = in.Eval(node.Value, env)
+        if isError(value) {
+            return value
+        }
+    }
+    if !in.yield(value) {
+        if err := in.ctx.Err(); err != nil {
+            return newError("%s", err)
+        }
+        return newError("generator closed")
+    }
+    return NULL
+}
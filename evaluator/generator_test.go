@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+    "context"
+    "errors"
+    "runtime"
+    "testing"
+    "time"
+)
+
+func TestGenerators(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`let g = fn() { yield 1; yield 2; }(); [next(g), next(g), next(g)]`, []interface{}{1, 2, nil}},
+        {`let g = fn() { yield 1; }(); next(g); next(g, "done")`, "done"},
+        {`let g = fn() { yield; }(); next(g, 1)`, nil},
+        {`let count = fn(n) { for (i in 0..n) { yield i * 10; } }; map(count(3), fn(x) { x })`, []int{0, 10, 20}},
+        {`let naturals = fn() { for (i in 0..9223372036854775807) { yield i; } }; find(naturals(), fn(x) { x > 5 })`, 6},
+        {`let g = fn() { yield 1; return 5; yield 2; }; sort(g())`, []int{1}},
+        {`let total = 0; for (x in fn() { yield 1; yield 2; }()) { let total = total + x; }; total`, 3},
+        {`let g = fn(a, b) { yield a; yield b; }; let it = g(1); 1`, errors.New("wrong number of arguments. got=1, want=2")},
+        {`let g = fn() { yield 1; yield 1 + true; }(); next(g); next(g)`, errors.New("type mismatch: INTEGER + BOOLEAN")},
+        {`let g = fn() { yield 1; yield 1 + true; }(); map(g, fn(x) { x })`, errors.New("type mismatch: INTEGER + BOOLEAN")},
+        {`let g = fn() { yield 1; yield 2; }(); close(g); next(g)`, nil},
+        {`let g = fn() { yield 1; yield 2; }(); next(g); close(g); next(g)`, nil},
+        {`let g = fn() { yield 1; }(); len(set(g)) + len(set(g))`, 1},
+        {`next([1])`, errors.New("argument 1 to `next` must be GENERATOR, got ARRAY")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestGeneratorInspect(t *testing.T) {
+    if got := testEval(`fn() { yield 1; }()`).Inspect(); got != "generator" {
+        t.Errorf("wrong Inspect. got=%q", got)
+    }
+}
+
+func TestGeneratorStopsWhenContextIsDone(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    in := New().WithContext(ctx)
+    input := `let g = fn() { yield 1; yield 2; }(); next(g)`
+    testObject(t, input, testEvalWith(in, input), 1)
+
+    cancel()
+    input = `let g = fn() { yield 1; yield 2; }(); next(g); next(g)`
+    testObject(t, input, testEvalWith(in, input), errors.New("context canceled"))
+}
+
+func TestAbandonedGeneratorsAreCleanedUp(t *testing.T) {
+    before := runtime.NumGoroutine()
+    for i := 0; i < 20; i++ {
+        testEval(`next(fn() { for (i in 0..9223372036854775807) { yield i; } }())`)
+    }
+
+    deadline := time.Now().Add(5 * time.Second)
+    for runtime.NumGoroutine() > before {
+        if time.Now().After(deadline) {
+            t.Fatalf("generator goroutines leaked. before=%d, now=%d", before, runtime.NumGoroutine())
+        }
+        runtime.GC()
+        time.Sleep(10 * time.Millisecond)
+    }
+}
@@ -0,0 +1,156 @@
+package evaluator
+
+import (
+    "context"
+    "fmt"
+
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/token"
+)
+
+// Interpreter holds the state shared by every evaluation it runs, most
+// notably the set of builtins visible to Monkey code.
+type Interpreter struct {
+    ctx context.Context
+    builtins map[string]*object.Builtin
+    searchPath []string
+    modules *modules
+    // importing is set on the copy of the interpreter that evaluates a
+    // module, and shared by the tasks it spawns. importer is the
+    // evaluation loading it, which the tasks are not part of.
+    importing *moduleLoad
+    importer *importer
+    strict bool
+    // yield is set on the copy of the interpreter that runs the body of a
+    // generator.
+    yield object.YieldFunction
+}
+
+// standard backs the package level Eval. It is never registered on.
+var standard = New()
+
+// stdlib lists the builtin sets every interpreter starts with.
+var stdlib = []map[string]*object.Builtin{
+    builtins,
+    stringBuiltins,
+    arrayBuiltins,
+    hashBuiltins,
+    setBuiltins,
+    generatorBuiltins,
+    concurrencyBuiltins,
+}
+
+// New returns an interpreter that knows the standard builtins.
+func New() *Interpreter {
+    in := &Interpreter{
+        ctx: context.Background(),
+        builtins: make(map[string]*object.Builtin),
+        modules: newModules(),
+    }
+    for _, set := range stdlib {
+        for name, builtin := range set {
+            in.builtins[name] = builtin
+        }
+    }
+    return in
+}
+
+// WithContext returns a copy of the interpreter that evaluates under ctx.
+// Function calls fail with an error once ctx is done. The copy shares its
+// builtins and loaded modules with the original.
+func (in *Interpreter) WithContext(ctx context.Context) *Interpreter {
+    if ctx == nil {
+        panic("nil context")
+    }
+    copied := *in
+    copied.ctx = ctx
+    return &copied
+}
+
+// Context returns the context the interpreter evaluates under.
+func (in *Interpreter) Context() context.Context {
+    return in.ctx
+}
+
+// SetStrict makes indexing an array or string out of range an error
+// instead of NULL.
+func (in *Interpreter) SetStrict(strict bool) {
+    in.strict = strict
+}
+
+// Builtin returns the builtin registered under name.
+func (in *Interpreter) Builtin(name string) (*object.Builtin, bool) {
+    builtin, ok := in.builtins[name]
+    return builtin, ok
+}
+
+// Register makes fn available to Monkey code as the builtin name,
+// replacing any builtin already registered under it. fn can be an
+// *object.Builtin, an object.BuiltinFunction, an
+// object.ContextBuiltinFunction or any other Go function, which is
+// adapted by reflection as described in Native.
+func (in *Interpreter) Register(name string, fn interface{}) error {
+    if !isIdentifier(name) {
+        return fmt.Errorf("invalid builtin name %q", name)
+    }
+
+    var builtin *object.Builtin
+    switch fn := fn.(type) {
+    case *object.Builtin:
+        builtin = fn
+    case object.BuiltinFunction:
+        builtin = &object.Builtin{Fn: fn}
+    case func(args ...object.Object) object.Object:
+        builtin = &object.Builtin{Fn: fn}
+    case object.ContextBuiltinFunction:
+        builtin = &object.Builtin{ContextFn: fn}
+    case func(call *object.CallContext, args ...object.Object) object.Object:
+        builtin = &object.Builtin{ContextFn: fn}
+    default:
+        native, err := Native(name, fn)
+        if err != nil {
+            return err
+        }
+        builtin = native
+    }
+
+    if builtin == nil || (builtin.Fn == nil && builtin.ContextFn == nil) {
+        return fmt.Errorf("builtin %q has no function", name)
+    }
+    in.builtins[name] = builtin
+    return nil
+}
+
+func (in *Interpreter) callContext(env *object.Environment) *object.CallContext {
+    return &object.CallContext{
+        Context: in.ctx,
+        Env: env,
+        Apply: func(fn object.Object, args ...object.Object) object.Object {
+            return in.applyFunction(fn, args, env)
+        },
+    }
+}
+
+// defined reports whether a name is known when evaluating a program in
+// env, though the program does not declare it.
+func (in *Interpreter) defined(env *object.Environment) func(name string) bool {
+    return func(name string) bool {
+        if _, ok := env.Get(name); ok {
+            return true
+        }
+        _, ok := in.builtins[name]
+        return ok
+    }
+}
+
+func isIdentifier(name string) bool {
+    if name == "" || token.LookupIdent(name) != token.IDENT {
+        return false
+    }
+    for _, ch := range name {
+        if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,230 @@
+package evaluator
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/parser"
+)
+
+func testEvalWith(in *Interpreter, input string) object.Object {
+    l := lexer.New(input)
+    p := parser.New(l)
+    program := p.ParseProgram()
+    env := object.NewEnvironment()
+
+    return in.Eval(program, env)
+}
+
+func TestRegisterBuiltinFunction(t *testing.T) {
+    in := New()
+    err := in.Register("double", object.BuiltinFunction(func(args ...object.Object) object.Object {
+        return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+    }))
+    if err != nil {
+        t.Fatalf("Register returned error: %s", err)
+    }
+
+    testIntegerObject(t, testEvalWith(in, "double(21)"), 42)
+}
+
+func TestRegisterIsPerInterpreter(t *testing.T) {
+    in := New()
+    err := in.Register("answer", func() int { return 42 })
+    if err != nil {
+        t.Fatalf("Register returned error: %s", err)
+    }
+
+    testIntegerObject(t, testEvalWith(in, "answer()"), 42)
+
+    evaluated := testEval("answer()")
+    errObj, ok := evaluated.(*object.Error)
+    if !ok {
+        t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+    }
+    if errObj.Message != "identifier not found: answer" {
+        t.Errorf("wrong error message. got=%q", errObj.Message)
+    }
+
+    if _, ok := New().Builtin("answer"); ok {
+        t.Errorf("builtin leaked into a new interpreter")
+    }
+}
+
+func TestRegisterInvalidName(t *testing.T) {
+    in := New()
+    for _, name := range []string{"", "let", "two words", "x1"} {
+        if err := in.Register(name, func() {}); err == nil {
+            t.Errorf("expected error registering %q", name)
+        }
+    }
+}
+
+func TestRegisterUnsupportedSignature(t *testing.T) {
+    in := New()
+    tests := []interface{}{
+        42,
+        func(f float64) {},
+        func() (int, int) { return 0, 0 },
+        func() (int, string, error) { return 0, "", nil },
+        func(m map[string]int) {},
+    }
+    for _, fn := range tests {
+        if err := in.Register("f", fn); err == nil {
+            t.Errorf("expected error registering %T", fn)
+        }
+    }
+}
+
+func TestNativeFunctions(t *testing.T) {
+    in := New()
+    register := func(name string, fn interface{}) {
+        if err := in.Register(name, fn); err != nil {
+            t.Fatalf("Register(%q) returned error: %s", name, err)
+        }
+    }
+    register("add", func(a, b int) int { return a + b })
+    register("shout", func(s string) string { return strings.ToUpper(s) + "!" })
+    register("negate", func(b bool) bool { return !b })
+    register("sum", func(xs ...int64) int64 {
+        var total int64
+        for _, x := range xs {
+            total += x
+        }
+        return total
+    })
+    register("total", func(xs []int) int {
+        total := 0
+        for _, x := range xs {
+            total += x
+        }
+        return total
+    })
+    register("words", func(s string) []string { return strings.Fields(s) })
+    register("kind", func(v interface{}) string {
+        switch v.(type) {
+        case int64:
+            return "int"
+        case string:
+            return "string"
+        case nil:
+            return "nil"
+        }
+        return "other"
+    })
+    register("size", func(a *object.Array) int { return len(a.Elements) })
+    register("nothing", func() {})
+    register("divide", func(a, b int) (int, error) {
+        if b == 0 {
+            return 0, errors.New("division by zero")
+        }
+        return a / b, nil
+    })
+    register("small", func(n uint8) uint8 { return n })
+
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {"add(2, 3)", 5},
+        {`shout("hi")`, "HI!"},
+        {"negate(true)", false},
+        {"sum()", 0},
+        {"sum(1, 2, 3)", 6},
+        {"total([1, 2, 3])", 6},
+        {`len(words("a b c"))`, 3},
+        {`kind(1)`, "int"},
+        {`kind("a")`, "string"},
+        {`kind(if (false) { 1 })`, "nil"},
+        {"size([1, 2])", 2},
+        {"nothing()", nil},
+        {"divide(6, 3)", 2},
+        {"small(255)", 255},
+        {"divide(1, 0)", errors.New("division by zero")},
+        {"add(1)", errors.New("wrong number of arguments. got=1, want=2")},
+        {`add(1, "2")`, errors.New("argument 2 to `add` must be INTEGER, got STRING")},
+        {`total([1, "2"])`, errors.New("argument 1 to `total` must be ARRAY of INTEGER, got ARRAY")},
+        {`size("a")`, errors.New("argument 1 to `size` must be ARRAY, got STRING")},
+        {"small(256)", errors.New("argument 1 to `small` out of range, got 256")},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEvalWith(in, tt.input)
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case bool:
+            testBooleanObject(t, evaluated, expected)
+        case string:
+            str, ok := evaluated.(*object.String)
+            if !ok {
+                t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+                continue
+            }
+            if str.Value != expected {
+                t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+            }
+        case nil:
+            testNullObject(t, evaluated)
+        case error:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok {
+                t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+                continue
+            }
+            if errObj.Message != expected.Error() {
+                t.Errorf("wrong error message. expected=%q, got=%q", expected.Error(), errObj.Message)
+            }
+        }
+    }
+}
+
+func TestBuiltinReceivesCallContext(t *testing.T) {
+    type key struct{}
+    ctx := context.WithValue(context.Background(), key{}, "value")
+    in := New().WithContext(ctx)
+
+    err := in.Register("lookup", func(call *object.CallContext, args ...object.Object) object.Object {
+        name := args[0].(*object.String).Value
+        if val, ok := call.Env.Get(name); ok {
+            return val
+        }
+        return NULL
+    })
+    if err != nil {
+        t.Fatalf("Register returned error: %s", err)
+    }
+    err = in.Register("fromContext", func(ctx context.Context) string {
+        return ctx.Value(key{}).(string)
+    })
+    if err != nil {
+        t.Fatalf("Register returned error: %s", err)
+    }
+
+    testIntegerObject(t, testEvalWith(in, `let f = fn(x) { lookup("x") }; f(7)`), 7)
+
+    evaluated := testEvalWith(in, "fromContext()")
+    str, ok := evaluated.(*object.String)
+    if !ok || str.Value != "value" {
+        t.Errorf("fromContext() returned %T (%+v)", evaluated, evaluated)
+    }
+}
+
+func TestCancelledContextStopsEvaluation(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    in := New().WithContext(ctx)
+
+    evaluated := testEvalWith(in, "let f = fn() { 1 }; f()")
+    errObj, ok := evaluated.(*object.Error)
+    if !ok {
+        t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+    }
+    if errObj.Message != context.Canceled.Error() {
+        t.Errorf("wrong error message. got=%q", errObj.Message)
+    }
+}
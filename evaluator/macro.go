@@ -0,0 +1,218 @@
+package evaluator
+
+import (
+    "fmt"
+    "strconv"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/token"
+)
+
+// evalQuote returns the argument of quote(...) unevaluated, but for the
+// calls to unquote in it, which are replaced by the code of their values.
+func (in *Interpreter) evalQuote(call *ast.CallExpression, env *object.Environment) object.Object {
+    if len(call.Arguments) != 1 {
+        return newError("wrong number of arguments to quote. got=%d, want=1", len(call.Arguments))
+    }
+
+    var err object.Object
+    quoted := ast.Modify(call.Arguments[0], func(node ast.Node) ast.Node {
+        unquote, ok := node.(*ast.CallExpression)
+        if !ok || err != nil || !unquote.Calls("unquote") {
+            return node
+        }
+        if len(unquote.Arguments) != 1 {
+            err = newError("wrong number of arguments to unquote. got=%d, want=1", len(unquote.Arguments))
+            return node
+        }
+        value := in.Eval(unquote.Arguments[0], env)
+        if isError(value) {
+            err = value
+            return node
+        }
+        expression, convErr := objectToNode(value, unquote.Pos())
+        if convErr != nil {
+            err = convErr
+            return node
+        }
+        return expression
+    })
+    if err != nil {
+        return err
+    }
+    return &object.Quote{Node: quoted}
+}
+
+// objectToNode returns code evaluating to obj, at pos. A quote gives a
+// copy of its code.
+func objectToNode(obj object.Object, pos token.Position) (ast.Expression, *object.Error) {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        literal := strconv.FormatInt(obj.Value, 10)
+        return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Pos: pos}, Value: obj.Value}, nil
+    case *object.String:
+        return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}, Value: obj.Value}, nil
+    case *object.Boolean:
+        if obj.Value {
+            return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}, nil
+        }
+        return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}, Value: false}, nil
+    case *object.Quote:
+        expression, ok := obj.Node.(ast.Expression)
+        if !ok {
+            return nil, newError("cannot unquote a quote of %T", obj.Node)
+        }
+        return ast.Copy(expression).(ast.Expression), nil
+    case *object.Array:
+        array := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}}
+        for _, element := range obj.Elements {
+            node, err := objectToNode(element, pos)
+            if err != nil {
+                return nil, err
+            }
+            array.Elements = append(array.Elements, node)
+        }
+        return array, nil
+    case *object.Hash:
+        hash := &ast.HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}}
+        for _, pair := range obj.Pairs() {
+            key, err := objectToNode(pair.Key, pos)
+            if err != nil {
+                return nil, err
+            }
+            value, err := objectToNode(pair.Value, pos)
+            if err != nil {
+                return nil, err
+            }
+            hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+        }
+        return hash, nil
+    case *object.Set:
+        set := &ast.SetLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}}
+        for _, member := range obj.Members() {
+            node, err := objectToNode(member, pos)
+            if err != nil {
+                return nil, err
+            }
+            set.Elements = append(set.Elements, node)
+        }
+        return set, nil
+    }
+    return nil, newError("cannot unquote %s", obj.Type())
+}
+
+// ExpandMacros binds the macros program defines, with top-level lets of
+// macro literals, in env. It returns a copy of program without those lets,
+// where every call of a macro of env is replaced by the code the macro
+// returns for it. The macro gets the code of its arguments as quotes.
+func (in *Interpreter) ExpandMacros(program *ast.Program, env *object.Environment) (*ast.Program, error) {
+    program = defineMacros(program, env)
+    if !callsMacro(program, env) {
+        return program, nil
+    }
+
+    var err error
+    expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+        call, ok := node.(*ast.CallExpression)
+        if !ok || err != nil {
+            return node
+        }
+        macro, ok := macroOf(call, env)
+        if !ok {
+            return node
+        }
+        var expansion ast.Expression
+        expansion, err = in.expandMacro(macro, call)
+        if err != nil {
+            return node
+        }
+        return expansion
+    })
+    return expanded.(*ast.Program), err
+}
+
+func defineMacros(program *ast.Program, env *object.Environment) *ast.Program {
+    var statements []ast.Statement
+    defined := false
+    for _, statement := range program.Statements {
+        let, ok := statement.(*ast.LetStatement)
+        if !ok {
+            statements = append(statements, statement)
+            continue
+        }
+        macro, ok := let.Value.(*ast.MacroLiteral)
+        if !ok {
+            statements = append(statements, statement)
+            continue
+        }
+        env.Set(let.Name.Value, &object.Macro{
+            Parameters: macro.Parameters,
+            Body: macro.Body,
+            Env: env,
+            Locals: macro.Locals,
+        })
+        defined = true
+    }
+    if !defined {
+        return program
+    }
+    copied := *program
+    copied.Statements = statements
+    return &copied
+}
+
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+    ident, ok := call.Function.(*ast.Identifier)
+    if !ok {
+        return nil, false
+    }
+    obj, ok := env.Get(ident.Value)
+    if !ok {
+        return nil, false
+    }
+    macro, ok := obj.(*object.Macro)
+    return macro, ok
+}
+
+func callsMacro(program *ast.Program, env *object.Environment) bool {
+    found := false
+    ast.Inspect(program, func(node ast.Node) bool {
+        if call, ok := node.(*ast.CallExpression); ok {
+            if _, ok := macroOf(call, env); ok {
+                found = true
+            }
+        }
+        return !found
+    })
+    return found
+}
+
+func (in *Interpreter) expandMacro(macro *object.Macro, call *ast.CallExpression) (ast.Expression, error) {
+    name := call.Function.String()
+    if len(call.Arguments) != len(macro.Parameters) {
+        return nil, fmt.Errorf("wrong number of arguments to macro %s. got=%d, want=%d",
+            name, len(call.Arguments), len(macro.Parameters))
+    }
+
+    frame := object.NewFrame(macro.Env, macro.Locals)
+    for i, param := range macro.Parameters {
+        setIdentifier(frame, param, &object.Quote{Node: call.Arguments[i]})
+    }
+    result := unwrapReturnValue(in.Eval(macro.Body, frame))
+
+    switch result := result.(type) {
+    case *object.Error:
+        return nil, fmt.Errorf("in macro %s: %s", name, result.Message)
+    case *object.Quote:
+        expression, err := objectToNode(result, call.Pos())
+        if err != nil {
+            return nil, fmt.Errorf("in macro %s: %s", name, err.Message)
+        }
+        return expression, nil
+    }
+    if result == nil {
+        result = NULL
+    }
+    return nil, fmt.Errorf("macro %s must return QUOTE, got %s", name, result.Type())
+}
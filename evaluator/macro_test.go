@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+    "errors"
+    "testing"
+
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/parser"
+)
+
+func TestQuote(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`quote(5)`, `5`},
+        {`quote(5 + 8)`, `(5 + 8)`},
+        {`quote(foobar)`, `foobar`},
+        {`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+        {`quote(unquote(4))`, `4`},
+        {`quote(unquote(4 + 4))`, `8`},
+        {`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+        {`let foobar = 8; quote(unquote(foobar))`, `8`},
+        {`quote(unquote(true == false))`, `false`},
+        {`quote(unquote("a" + "b"))`, `ab`},
+        {`quote(unquote([1, "a"]))`, `[1,a]`},
+        {`quote(unquote({"a": 1}))`, `{a:1}`},
+        {`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+        {`let q = quote(4 + 4); quote(unquote(q) + 8)`, `((4 + 4) + 8)`},
+        {`let f = fn(x) { quote(unquote(x) * y) }; f(2)`, `(2 * y)`},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        quote, ok := evaluated.(*object.Quote)
+        if !ok {
+            t.Errorf("%s: expected *object.Quote. got=%T (%+v)", tt.input, evaluated, evaluated)
+            continue
+        }
+        if got := quote.Node.String(); got != tt.expected {
+            t.Errorf("%s: wrong quoted code. got=%q, want=%q", tt.input, got, tt.expected)
+        }
+    }
+}
+
+func TestMacros(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`let unless = macro(cond, cons, alt) { quote(if (unquote(cond)) { unquote(alt) } else { unquote(cons) }) };
+unless(10 > 5, "no", "yes")`, "yes"},
+        {`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5)`, 1},
+        {`let ignore = macro(x) { quote(1) }; ignore(undefined)`, 1},
+        {`let twice = macro(x) { quote(unquote(x) + unquote(x)) }; let f = fn(y) { twice(y) }; f(4)`, 8},
+        {`let m = macro(x) { let q = quote(unquote(x) * 2); q }; m(3)`, 6},
+
+        {`let m = macro(x) { 1 }; m(2)`, errors.New("macro m must return QUOTE, got INTEGER")},
+        {`let m = macro(x) { quote(x) }; m(1, 2)`, errors.New("wrong number of arguments to macro m. got=2, want=1")},
+        {`let m = macro() { quote(unquote(nope)) }; m()`, errors.New("in macro m: identifier not found: nope")},
+        {`fn() { macro(x) { x } }()`, errors.New("macros can only be defined by a top-level let")},
+        {`quote(1, 2)`, errors.New("wrong number of arguments to quote. got=2, want=1")},
+        {`quote(unquote(1, 2))`, errors.New("wrong number of arguments to unquote. got=2, want=1")},
+        {`quote(unquote(fn(x) { x }))`, errors.New("cannot unquote FUNCTION")},
+        {`unquote(1)`, errors.New("identifier not found: unquote")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestExpandMacros(t *testing.T) {
+    input := `let number = 1; let infix = macro() { quote(1 + 2) }; infix(); fn() { infix() }`
+    program := parser.New(lexer.New(input)).ParseProgram()
+    env := object.NewEnvironment()
+
+    expanded, err := New().ExpandMacros(program, env)
+    if err != nil {
+        t.Fatalf("ExpandMacros: %s", err)
+    }
+    if got, want := expanded.String(), "let number = 1(1 + 2)fn() (1 + 2)"; got != want {
+        t.Errorf("wrong expansion. got=%q, want=%q", got, want)
+    }
+    if got, want := program.String(), "let number = 1let infix = macro() quote((1 + 2))infix()fn() infix()"; got != want {
+        t.Errorf("program was modified. got=%q", got)
+    }
+
+    if obj, ok := env.Get("infix"); !ok || obj.Type() != object.MACRO_OBJ {
+        t.Errorf("infix is not bound to a macro. got=%v", obj)
+    }
+    if _, ok := env.Get("number"); ok {
+        t.Errorf("number was evaluated")
+    }
+}
@@ -0,0 +1,258 @@
+package evaluator
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/parser"
+)
+
+// ModuleExt is the extension added to import paths that have none.
+const ModuleExt = ".mk"
+
+// modules caches the modules loaded by an interpreter and tracks the ones
+// being loaded, so that an import of a module that is loading waits for it,
+// or fails when that would wait forever.
+type modules struct {
+    mu sync.Mutex
+    loaded map[string]*object.Module
+    loading map[string]*moduleLoad
+}
+
+// moduleLoad is the evaluation of a module in progress.
+type moduleLoad struct {
+    name string
+    path string
+    // parent is the module whose evaluation imports this one, nil for an
+    // import by the main program.
+    parent *moduleLoad
+    owner *importer
+    done chan struct{}
+    result object.Object
+}
+
+// importer is an evaluation importing modules: the main program or a
+// task. current is the innermost module it is loading and waiting the
+// module another importer is loading that it waits for.
+type importer struct {
+    current *moduleLoad
+    waiting *moduleLoad
+}
+
+func newModules() *modules {
+    return &modules{
+        loaded: make(map[string]*object.Module),
+        loading: make(map[string]*moduleLoad),
+    }
+}
+
+// SetSearchPath sets the directories searched, in order, for imports that
+// are not found relative to the importing file.
+func (in *Interpreter) SetSearchPath(dirs []string) {
+    in.searchPath = append([]string(nil), dirs...)
+}
+
+func (in *Interpreter) evalImportExpression(node *ast.ImportExpression, env *object.Environment) object.Object {
+    path := in.Eval(node.Path, env)
+    if isError(path) {
+        return path
+    }
+    name, ok := path.(*object.String)
+    if !ok {
+        return newError("import path must be STRING, got %s", path.Type())
+    }
+    return in.importModule(name.Value)
+}
+
+func (in *Interpreter) importModule(name string) object.Object {
+    file, err := in.findModule(name)
+    if err != nil {
+        return newError("%s", err)
+    }
+
+    m := in.modules
+    m.mu.Lock()
+    if module, ok := m.loaded[file]; ok {
+        m.mu.Unlock()
+        return module
+    }
+    if load, ok := m.loading[file]; ok {
+        if cycle := in.importCycle(load); cycle != nil {
+            m.mu.Unlock()
+            cycle = append(cycle, fmt.Sprintf("%q", name))
+            return newError("import cycle: %s", strings.Join(cycle, " -> "))
+        }
+        if in.importer != nil {
+            in.importer.waiting = load
+        }
+        m.mu.Unlock()
+        return in.awaitModule(load)
+    }
+
+    owner := in.importer
+    if owner == nil {
+        owner = &importer{}
+    }
+    load := &moduleLoad{name: name, path: file, parent: in.importing, owner: owner, done: make(chan struct{})}
+    m.loading[file] = load
+    outer := owner.current
+    owner.current = load
+    m.mu.Unlock()
+
+    loader := *in
+    loader.importing = load
+    loader.importer = owner
+    load.result = loader.loadModule(name, file)
+
+    m.mu.Lock()
+    owner.current = outer
+    delete(m.loading, file)
+    if module, ok := load.result.(*object.Module); ok {
+        m.loaded[file] = module
+    }
+    m.mu.Unlock()
+    close(load.done)
+
+    return load.result
+}
+
+// importCycle returns the names of the modules that import each other when
+// the evaluation waits for load, following the importers load waits for in
+// turn, or nil if load gets done without it. It is called with the lock
+// held; a load that is done no longer leads anywhere.
+func (in *Interpreter) importCycle(load *moduleLoad) []string {
+    var cycle []string
+    for load != nil && in.modules.loading[load.path] == load {
+        owner := load.owner
+        var names []string
+        for l := owner.current; l != load; l = l.parent {
+            names = append(names, fmt.Sprintf("%q", l.name))
+        }
+        cycle = append(cycle, fmt.Sprintf("%q", load.name))
+        for i := len(names) - 1; i >= 0; i-- {
+            cycle = append(cycle, names[i])
+        }
+        if owner == in.importer {
+            return cycle
+        }
+        load = owner.waiting
+    }
+    return nil
+}
+
+// awaitModule waits for another importer to be done loading a module.
+func (in *Interpreter) awaitModule(load *moduleLoad) object.Object {
+    var result object.Object
+    select {
+    case <-load.done:
+        result = load.result
+    case <-in.ctx.Done():
+        result = newError("%s", in.ctx.Err())
+    }
+
+    if in.importer != nil {
+        in.modules.mu.Lock()
+        in.importer.waiting = nil
+        in.modules.mu.Unlock()
+    }
+    return result
+}
+
+func (in *Interpreter) loadModule(name, file string) object.Object {
+    source, err := os.ReadFile(file)
+    if err != nil {
+        return newError("%s", err)
+    }
+
+    p := parser.New(lexer.New(string(source)))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        return newError("parse errors in %q: %s", name, strings.Join(p.Errors(), "; "))
+    }
+
+    env := object.NewEnvironment()
+    evaluated := in.Eval(program, env)
+    if isError(evaluated) {
+        return evaluated
+    }
+
+    module := &object.Module{Name: name, Path: file, Exports: make(map[string]object.Object)}
+    for _, binding := range exportedNames(program) {
+        if val, ok := env.Get(binding); ok {
+            module.Exports[binding] = val
+        }
+    }
+    return module
+}
+
+// exportedNames lists the bindings a module makes public: the names of its
+// export statements or, when it has none, of all its top-level lets.
+func exportedNames(program *ast.Program) []string {
+    exported := []string{}
+    all := []string{}
+    for _, statement := range program.Statements {
+        switch statement := statement.(type) {
+        case *ast.ExportStatement:
+            exported = append(exported, statement.Statement.Name.Value)
+        case *ast.LetStatement:
+            all = append(all, statement.Name.Value)
+        }
+    }
+    if len(exported) > 0 {
+        return exported
+    }
+    return all
+}
+
+// findModule resolves an import path to a file, first relative to the
+// importing file (or the working directory at the top level) and then
+// relative to each directory of the search path.
+func (in *Interpreter) findModule(name string) (string, error) {
+    file := name
+    if filepath.Ext(file) == "" {
+        file += ModuleExt
+    }
+
+    candidates := []string{}
+    if filepath.IsAbs(file) {
+        candidates = append(candidates, file)
+    } else {
+        base := "."
+        if in.importing != nil {
+            base = filepath.Dir(in.importing.path)
+        }
+
+        candidates = append(candidates, filepath.Join(base, file))
+        for _, dir := range in.searchPath {
+            candidates = append(candidates, filepath.Join(dir, file))
+        }
+    }
+
+    for _, candidate := range candidates {
+        info, err := os.Stat(candidate)
+        if err != nil || info.IsDir() {
+            continue
+        }
+        return filepath.Abs(candidate)
+    }
+    return "", fmt.Errorf("module not found: %q", name)
+}
+
+func evalModuleIndexExpression(module, index object.Object) object.Object {
+    moduleObject := module.(*object.Module)
+    name, ok := index.(*object.String)
+    if !ok {
+        return newError("module member must be STRING, got %s", index.Type())
+    }
+    val, ok := moduleObject.Exports[name.Value]
+    if !ok {
+        return newError("module %q has no member %q", moduleObject.Name, name.Value)
+    }
+    return val
+}
@@ -0,0 +1,263 @@
+package evaluator
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "necronet.info/interpreter/internal/monkeytest"
+    "necronet.info/interpreter/object"
+)
+
+func writeModules(t *testing.T, files map[string]string) string {
+    dir := t.TempDir()
+    for name, source := range files {
+        path := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return dir
+}
+
+func TestImportModule(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "lib/math.mk": `
+            let square = fn(x) { x * x };
+            let ten = 10;
+        `,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+
+    tests := []struct {
+        input string
+        expected int64
+    }{
+        {`let m = import "lib/math"; m["square"](3)`, 9},
+        {`let m = import "lib/math.mk"; m["ten"]`, 10},
+        {`let path = "lib/" + "math"; let m = import path; m["square"](m["ten"])`, 100},
+    }
+    for _, tt := range tests {
+        testIntegerObject(t, testEvalWith(in, tt.input), tt.expected)
+    }
+}
+
+func TestModulesHaveTheirOwnNamespace(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "counter.mk": `
+            let x = 1;
+            let get = fn() { x };
+        `,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+
+    input := `let x = 2; let m = import "counter"; m["get"]() + x`
+    testIntegerObject(t, testEvalWith(in, input), 3)
+}
+
+func TestExportHidesPrivateBindings(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "greet.mk": `
+            let prefix = "Hello, ";
+            export let greet = fn(name) { prefix + name };
+        `,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+
+    evaluated := testEvalWith(in, `let g = import "greet"; g["greet"]("Monkey")`)
+    str, ok := evaluated.(*object.String)
+    if !ok || str.Value != "Hello, Monkey" {
+        t.Fatalf("wrong result. got=%T (%+v)", evaluated, evaluated)
+    }
+
+    evaluated = testEvalWith(in, `let g = import "greet"; g["prefix"]`)
+    testErrorObject(t, evaluated, `module "greet" has no member "prefix"`)
+}
+
+func TestModulesAreLoadedOnce(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "once.mk": `let loaded = tick();`,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+    ticks := 0
+    if err := in.Register("tick", func() int { ticks++; return ticks }); err != nil {
+        t.Fatal(err)
+    }
+
+    input := `
+        let a = import "once";
+        let b = import "once";
+        a["loaded"] + b["loaded"]
+    `
+    testIntegerObject(t, testEvalWith(in, input), 2)
+    if ticks != 1 {
+        t.Errorf("module evaluated %d times, want 1", ticks)
+    }
+    if a, b := testEvalWith(in, `import "once"`), testEvalWith(in, `import "once"`); a != b {
+        t.Errorf("imports returned different modules: %p and %p", a, b)
+    }
+}
+
+func TestImportsAreRelativeToTheImportingFile(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "pkg/a.mk": `let b = import "b"; let value = b["value"] + 1;`,
+        "pkg/b.mk": `let value = 41;`,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+
+    testIntegerObject(t, testEvalWith(in, `let a = import "pkg/a"; a["value"]`), 42)
+}
+
+func TestTasksImportTheSameModule(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "slow.mk": `let value = load();`,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+    loads := make(chan struct{}, 2)
+    release := make(chan struct{})
+    if err := in.Register("load", func() int { loads <- struct{}{}; <-release; return 21 }); err != nil {
+        t.Fatal(err)
+    }
+    go func() {
+        <-loads
+        // Give the second task time to import the module being loaded.
+        time.Sleep(20 * time.Millisecond)
+        close(release)
+    }()
+
+    input := `
+        let a = spawn fn() { import "slow" }();
+        let b = spawn fn() { import "slow" }();
+        await(a)["value"] + await(b)["value"]
+    `
+    testIntegerObject(t, testEvalWith(in, input), 42)
+    if n := len(loads); n != 0 {
+        t.Errorf("module evaluated %d times, want 1", n+1)
+    }
+}
+
+func TestTasksImportRelativeToTheirOwnModule(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "value.mk": `let value = 1;`,
+        "pkg/a.mk": `let ready = loading(); let value = (import "value")["value"];`,
+        "pkg/value.mk": `let value = 2;`,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+    loading := make(chan struct{})
+    release := make(chan struct{})
+    if err := in.Register("loading", func() int { close(loading); <-release; return 0 }); err != nil {
+        t.Fatal(err)
+    }
+    if err := in.Register("loaded", func() int { <-loading; return 0 }); err != nil {
+        t.Fatal(err)
+    }
+    if err := in.Register("release", func() int { close(release); return 0 }); err != nil {
+        t.Fatal(err)
+    }
+
+    // The main program imports value while a task loads pkg/a.
+    input := `
+        let a = spawn fn() { import "pkg/a" }();
+        loaded();
+        let value = (import "value")["value"];
+        release();
+        [value, await(a)["value"]]
+    `
+    evaluated := testEvalWith(in, input)
+    arr, ok := evaluated.(*object.Array)
+    if !ok || len(arr.Elements) != 2 {
+        t.Fatalf("wrong result. got=%T (%+v)", evaluated, evaluated)
+    }
+    testIntegerObject(t, arr.Elements[0], 1)
+    testIntegerObject(t, arr.Elements[1], 2)
+}
+
+func TestImportCycleBetweenTasks(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "x.mk": `meet(); let y = import "y";`,
+        "y.mk": `meet(); let x = import "x";`,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+    var arrived sync.WaitGroup
+    arrived.Add(2)
+    if err := in.Register("meet", func() int { arrived.Done(); arrived.Wait(); return 0 }); err != nil {
+        t.Fatal(err)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    in = in.WithContext(ctx)
+    env := object.NewEnvironment()
+    in.Eval(monkeytest.MustParse(t, `
+        let x = spawn fn() { import "x" }();
+        let y = spawn fn() { import "y" }();
+    `), env)
+
+    // The task that finds the cycle fails, and so does the other one,
+    // which waits for the module the first one was loading.
+    for _, input := range []string{"await(x)", "await(y)"} {
+        evaluated := in.Eval(monkeytest.MustParse(t, input), env)
+        err, ok := evaluated.(*object.Error)
+        if !ok || !strings.HasPrefix(err.Message, "import cycle: ") {
+            t.Errorf("%s: expected an import cycle, got %s", input, evaluated.Inspect())
+        }
+    }
+}
+
+func TestImportErrors(t *testing.T) {
+    dir := writeModules(t, map[string]string{
+        "a.mk": `let b = import "b";`,
+        "b.mk": `let c = import "c";`,
+        "c.mk": `let a = import "a";`,
+        "self.mk": `let me = import "self";`,
+        "broken.mk": `let = 5;`,
+        "failing.mk": `let x = 1 + true;`,
+        "plain.mk": `let x = 1;`,
+    })
+    in := New()
+    in.SetSearchPath([]string{dir})
+
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`import "a"`, `import cycle: "a" -> "b" -> "c" -> "a"`},
+        {`import "self"`, `import cycle: "self" -> "self"`},
+        {`import "missing"`, `module not found: "missing"`},
+        {`import 5`, "import path must be STRING, got INTEGER"},
+        {`import "broken"`, `parse errors in "broken": expected next token to be IDENT, got = instead; no prefix parse function for = found`},
+        {`import "failing"`, "type mismatch: INTEGER + BOOLEAN"},
+        {`let m = import "plain"; m[1]`, "module member must be STRING, got INTEGER"},
+    }
+    for _, tt := range tests {
+        testErrorObject(t, testEvalWith(in, tt.input), tt.expected)
+    }
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+    errObj, ok := obj.(*object.Error)
+    if !ok {
+        t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+        return false
+    }
+    if errObj.Message != expected {
+        t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+        return false
+    }
+    return true
+}
@@ -0,0 +1,286 @@
+package evaluator
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "reflect"
+
+    "necronet.info/interpreter/object"
+)
+
+var (
+    objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+    errorType = reflect.TypeOf((*error)(nil)).Elem()
+    contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+    callContextType = reflect.TypeOf((*object.CallContext)(nil))
+)
+
+// Native adapts an arbitrary Go function into a builtin called name.
+//
+// Arguments are converted according to the parameter they are passed to:
+// object.Object and concrete object types receive the object itself,
+// integer kinds receive INTEGER, string receives STRING, bool receives
+// BOOLEAN, slices receive an ARRAY whose elements are converted in turn and
+// interface{} receives the natural Go value (int64, string, bool,
+// []interface{}, nil for null, or the object itself). A leading
+// context.Context or *object.CallContext parameter is filled from the call
+// site instead of from the arguments. Variadic functions are supported.
+//
+// The function may return nothing, a value, an error, or a value and an
+// error. Values are converted back to objects with the same rules and a
+// non-nil error is turned into a Monkey error.
+func Native(name string, fn interface{}) (*object.Builtin, error) {
+    value := reflect.ValueOf(fn)
+    if value.Kind() != reflect.Func || value.IsNil() {
+        return nil, fmt.Errorf("builtin %q: %T is not a function", name, fn)
+    }
+    fnType := value.Type()
+
+    first := 0
+    if fnType.NumIn() > 0 && (fnType.In(0) == contextType || fnType.In(0) == callContextType) {
+        first = 1
+    }
+    for i := first; i < fnType.NumIn(); i++ {
+        param := fnType.In(i)
+        if fnType.IsVariadic() && i == fnType.NumIn()-1 {
+            param = param.Elem()
+        }
+        if !isNativeType(param) {
+            return nil, fmt.Errorf("builtin %q: unsupported parameter type %s", name, param)
+        }
+    }
+
+    returnsError := false
+    switch fnType.NumOut() {
+    case 0:
+    case 1:
+        returnsError = fnType.Out(0) == errorType
+        if !returnsError && !isNativeType(fnType.Out(0)) {
+            return nil, fmt.Errorf("builtin %q: unsupported result type %s", name, fnType.Out(0))
+        }
+    case 2:
+        if fnType.Out(1) != errorType {
+            return nil, fmt.Errorf("builtin %q: second result must be error, got %s", name, fnType.Out(1))
+        }
+        if !isNativeType(fnType.Out(0)) {
+            return nil, fmt.Errorf("builtin %q: unsupported result type %s", name, fnType.Out(0))
+        }
+        returnsError = true
+    default:
+        return nil, fmt.Errorf("builtin %q: too many results", name)
+    }
+
+    call := func(call *object.CallContext, args ...object.Object) object.Object {
+        want := fnType.NumIn() - first
+        if fnType.IsVariadic() {
+            if len(args) < want-1 {
+                return newError("wrong number of arguments. got=%d, want at least %d", len(args), want-1)
+            }
+        } else if len(args) != want {
+            return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+        }
+
+        in := make([]reflect.Value, 0, first+len(args))
+        if first == 1 {
+            if fnType.In(0) == contextType {
+                in = append(in, reflect.ValueOf(&call.Context).Elem())
+            } else {
+                in = append(in, reflect.ValueOf(call))
+            }
+        }
+        for i, arg := range args {
+            param := first + i
+            var paramType reflect.Type
+            if fnType.IsVariadic() && param >= fnType.NumIn()-1 {
+                paramType = fnType.In(fnType.NumIn() - 1).Elem()
+            } else {
+                paramType = fnType.In(param)
+            }
+            converted, ok := toNative(arg, paramType)
+            if !ok {
+                if integer, isInteger := arg.(*object.Integer); isInteger && nativeTypeName(paramType) == object.INTEGER_OBJ {
+                    return newError("argument %d to `%s` out of range, got %d", i+1, name, integer.Value)
+                }
+                return newError("argument %d to `%s` must be %s, got %s",
+                    i+1, name, nativeTypeName(paramType), arg.Type())
+            }
+            in = append(in, converted)
+        }
+
+        out := value.Call(in)
+        if returnsError {
+            if err := out[len(out)-1]; !err.IsNil() {
+                return newError("%s", err.Interface().(error))
+            }
+            out = out[:len(out)-1]
+        }
+        if len(out) == 0 {
+            return NULL
+        }
+        result, err := fromNative(out[0])
+        if err != nil {
+            return newError("%s: %s", name, err)
+        }
+        return result
+    }
+
+    return &object.Builtin{ContextFn: call}, nil
+}
+
+func isNativeType(t reflect.Type) bool {
+    if t.Implements(objectType) {
+        return true
+    }
+    switch t.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+        reflect.String, reflect.Bool:
+        return true
+    case reflect.Slice:
+        return isNativeType(t.Elem())
+    case reflect.Interface:
+        return t.NumMethod() == 0
+    }
+    return false
+}
+
+func nativeTypeName(t reflect.Type) string {
+    if t.Kind() == reflect.Ptr && t.Implements(objectType) {
+        return string(reflect.New(t.Elem()).Interface().(object.Object).Type())
+    }
+    switch t.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return object.INTEGER_OBJ
+    case reflect.String:
+        return object.STRING_OBJ
+    case reflect.Bool:
+        return object.BOOLEAN_OBJ
+    case reflect.Slice:
+        return object.ARRAY_OBJ + " of " + nativeTypeName(t.Elem())
+    }
+    return t.String()
+}
+
+func toNative(obj object.Object, t reflect.Type) (reflect.Value, bool) {
+    if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+        native := nativeValue(obj)
+        if native == nil {
+            return reflect.Zero(t), true
+        }
+        return reflect.ValueOf(native), true
+    }
+    if t.Implements(objectType) {
+        value := reflect.ValueOf(obj)
+        if !value.Type().AssignableTo(t) {
+            return reflect.Value{}, false
+        }
+        return value, true
+    }
+
+    switch t.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        integer, ok := obj.(*object.Integer)
+        if !ok || reflect.Zero(t).OverflowInt(integer.Value) {
+            return reflect.Value{}, false
+        }
+        return reflect.ValueOf(integer.Value).Convert(t), true
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        integer, ok := obj.(*object.Integer)
+        if !ok || integer.Value < 0 || reflect.Zero(t).OverflowUint(uint64(integer.Value)) {
+            return reflect.Value{}, false
+        }
+        return reflect.ValueOf(uint64(integer.Value)).Convert(t), true
+    case reflect.String:
+        str, ok := obj.(*object.String)
+        if !ok {
+            return reflect.Value{}, false
+        }
+        return reflect.ValueOf(str.Value).Convert(t), true
+    case reflect.Bool:
+        boolean, ok := obj.(*object.Boolean)
+        if !ok {
+            return reflect.Value{}, false
+        }
+        return reflect.ValueOf(boolean.Value).Convert(t), true
+    case reflect.Slice:
+        array, ok := obj.(*object.Array)
+        if !ok {
+            return reflect.Value{}, false
+        }
+        slice := reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+        for i, el := range array.Elements {
+            converted, ok := toNative(el, t.Elem())
+            if !ok {
+                return reflect.Value{}, false
+            }
+            slice.Index(i).Set(converted)
+        }
+        return slice, true
+    }
+    return reflect.Value{}, false
+}
+
+func nativeValue(obj object.Object) interface{} {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        return obj.Value
+    case *object.String:
+        return obj.Value
+    case *object.Boolean:
+        return obj.Value
+    case *object.Null:
+        return nil
+    case *object.Array:
+        elements := make([]interface{}, len(obj.Elements))
+        for i, el := range obj.Elements {
+            elements[i] = nativeValue(el)
+        }
+        return elements
+    default:
+        return obj
+    }
+}
+
+func fromNative(value reflect.Value) (object.Object, error) {
+    if !value.IsValid() {
+        return NULL, nil
+    }
+    switch value.Kind() {
+    case reflect.Interface, reflect.Ptr, reflect.Slice:
+        if value.IsNil() {
+            return NULL, nil
+        }
+    }
+    if value.Type().Implements(objectType) {
+        return value.Interface().(object.Object), nil
+    }
+
+    switch value.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return object.NewInteger(value.Int()), nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        if value.Uint() > math.MaxInt64 {
+            return nil, fmt.Errorf("integer overflow: %d", value.Uint())
+        }
+        return object.NewInteger(int64(value.Uint())), nil
+    case reflect.String:
+        return &object.String{Value: value.String()}, nil
+    case reflect.Bool:
+        return nativeBoolToBooleanObject(value.Bool()), nil
+    case reflect.Slice, reflect.Array:
+        elements := make([]object.Object, value.Len())
+        for i := range elements {
+            el, err := fromNative(value.Index(i))
+            if err != nil {
+                return nil, err
+            }
+            elements[i] = el
+        }
+        return &object.Array{Elements: elements}, nil
+    case reflect.Interface:
+        return fromNative(value.Elem())
+    }
+    return nil, fmt.Errorf("unsupported result type %s", value.Type())
+}
@@ -0,0 +1,34 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/object"
+)
+
+// The functions in this file expose the semantics of Monkey's operators
+// to other engines, such as the vm package, so that they agree with Eval
+// on every value. Failures are returned as *object.Error.
+
+// Infix applies a binary operator such as "+", "==" or ".." to two values.
+func Infix(operator string, left, right object.Object) object.Object {
+    return evalInfixExpression(operator, left, right)
+}
+
+// Prefix applies the "!" or "-" operator to a value.
+func Prefix(operator string, right object.Object) object.Object {
+    return evalPrefixExpression(operator, right)
+}
+
+// Index evaluates left[index], honouring the interpreter's strict mode.
+func (in *Interpreter) Index(left, index object.Object) object.Object {
+    return in.evalIndexExpression(left, index)
+}
+
+// Slice evaluates left[start:end:step]. Bounds that were left out are nil.
+func Slice(left, start, end, step object.Object) object.Object {
+    return sliceObject(left, start, end, step)
+}
+
+// IsTruthy reports whether a condition holding obj is taken.
+func IsTruthy(obj object.Object) bool {
+    return isTruth(obj)
+}
@@ -0,0 +1,125 @@
+package evaluator
+
+import (
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/object"
+)
+
+// evalSliceExpression evaluates left[start:end:step] on arrays and strings
+// the way Python does: negative bounds count back from the end, bounds out
+// of range are clamped and a negative step walks backwards.
+func (in *Interpreter) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+    left := in.Eval(node.Left, env)
+    if isError(left) {
+        return left
+    }
+
+    bounds := make([]object.Object, 3)
+    for i, exp := range []ast.Expression{node.Start, node.End, node.Step} {
+        if exp == nil {
+            continue
+        }
+        bound := in.Eval(exp, env)
+        if isError(bound) {
+            return bound
+        }
+        bounds[i] = bound
+    }
+    return sliceObject(left, bounds[0], bounds[1], bounds[2])
+}
+
+// sliceObject slices an array or string. Bounds that were left out are
+// nil.
+func sliceObject(left, start, end, step object.Object) object.Object {
+    bounds := make([]*object.Integer, 3)
+    for i, bound := range []object.Object{start, end, step} {
+        if bound == nil {
+            continue
+        }
+        integer, ok := bound.(*object.Integer)
+        if !ok {
+            return newError("slice index must be INTEGER, got %s", bound.Type())
+        }
+        bounds[i] = integer
+    }
+
+    switch left := left.(type) {
+    case *object.Array:
+        indices, err := sliceIndices(len(left.Elements), bounds[0], bounds[1], bounds[2])
+        if err != nil {
+            return err
+        }
+        elements := make([]object.Object, len(indices))
+        for i, idx := range indices {
+            elements[i] = left.Elements[idx]
+        }
+        return &object.Array{Elements: elements}
+    case *object.String:
+        indices, err := sliceIndices(len(left.Value), bounds[0], bounds[1], bounds[2])
+        if err != nil {
+            return err
+        }
+        sliced := make([]byte, len(indices))
+        for i, idx := range indices {
+            sliced[i] = left.Value[idx]
+        }
+        return &object.String{Value: string(sliced)}
+    default:
+        return newError("slice operator not supported: %s", left.Type())
+    }
+}
+
+// sliceIndices lists the positions selected by a slice of a sequence of
+// length elements. Any of start, end and step may be nil when omitted.
+func sliceIndices(length int, start, end, step *object.Integer) ([]int, *object.Error) {
+    n := int64(length)
+    stride := int64(1)
+    if step != nil {
+        stride = step.Value
+    }
+    if stride == 0 {
+        return nil, newError("slice step cannot be zero")
+    }
+
+    first, last := int64(0), n
+    if stride < 0 {
+        first, last = n-1, -1
+    }
+    if start != nil {
+        first = clampSliceBound(start.Value, n, stride)
+    }
+    if end != nil {
+        last = clampSliceBound(end.Value, n, stride)
+    }
+
+    var count int64
+    switch {
+    case stride > 0 && first < last:
+        count = (last-first-1)/stride + 1
+    case stride < 0 && first > last:
+        count = (last-first+1)/stride + 1
+    }
+    indices := make([]int, count)
+    for i := range indices {
+        indices[i] = int(first + int64(i)*stride)
+    }
+    return indices, nil
+}
+
+func clampSliceBound(bound, length, stride int64) int64 {
+    if bound < 0 {
+        bound += length
+        if bound < 0 {
+            if stride < 0 {
+                return -1
+            }
+            return 0
+        }
+    } else if bound >= length {
+        if stride < 0 {
+            return length - 1
+        }
+        return length
+    }
+    return bound
+}
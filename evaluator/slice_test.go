@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestStringIndexExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`"monkey"[0]`, "m"},
+        {`"monkey"[5]`, "y"},
+        {`"monkey"[-1]`, "y"},
+        {`"monkey"[6]`, nil},
+        {`"monkey"[-7]`, nil},
+        {`""[0]`, nil},
+        {`"monkey"["a"]`, errors.New("index operator not supported: STRING")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestSliceExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`[1, 2, 3, 4, 5][1:3]`, []int{2, 3}},
+        {`[1, 2, 3, 4, 5][:2]`, []int{1, 2}},
+        {`[1, 2, 3, 4, 5][3:]`, []int{4, 5}},
+        {`[1, 2, 3, 4, 5][:]`, []int{1, 2, 3, 4, 5}},
+        {`[1, 2, 3, 4, 5][::2]`, []int{1, 3, 5}},
+        {`[1, 2, 3, 4, 5][1::2]`, []int{2, 4}},
+        {`[1, 2, 3, 4, 5][-2:]`, []int{4, 5}},
+        {`[1, 2, 3, 4, 5][:-2]`, []int{1, 2, 3}},
+        {`[1, 2, 3, 4, 5][-100:100]`, []int{1, 2, 3, 4, 5}},
+        {`[1, 2, 3, 4, 5][4:2]`, []int{}},
+        {`[1, 2, 3, 4, 5][::-1]`, []int{5, 4, 3, 2, 1}},
+        {`[1, 2, 3, 4, 5][3:0:-1]`, []int{4, 3, 2}},
+        {`[1, 2, 3, 4, 5][::-2]`, []int{5, 3, 1}},
+        {`[1, 2, 3, 4, 5][-1:-100:-2]`, []int{5, 3, 1}},
+        {`[1, 2, 3][::4611686018427387904]`, []int{1}},
+        {`[][:]`, []int{}},
+        {`let a = [1, 2, 3]; let b = a[:]; len(push(b, 4)) + len(a)`, 7},
+        {`"monkey"[1:3]`, "on"},
+        {`"monkey"[3:]`, "key"},
+        {`"monkey"[:-3]`, "mon"},
+        {`"monkey"[::-1]`, "yeknom"},
+        {`"monkey"[::2]`, "mne"},
+        {`[1, 2][::0]`, errors.New("slice step cannot be zero")},
+        {`[1, 2]["a":]`, errors.New("slice index must be INTEGER, got STRING")},
+        {`{"a": 1}[1:]`, errors.New("slice operator not supported: HASH")},
+        {`[1, 2][x:]`, errors.New("identifier not found: x")},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestStrictIndexing(t *testing.T) {
+    in := New()
+    in.SetStrict(true)
+
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {`[1, 2, 3][3]`, errors.New("index out of range: 3 with length 3")},
+        {`[1, 2, 3][-4]`, errors.New("index out of range: -4 with length 3")},
+        {`[1, 2, 3][-1]`, 3},
+        {`"abc"[3]`, errors.New("index out of range: 3 with length 3")},
+        {`[1, 2, 3][1:100]`, []int{2, 3}},
+        {`{"a": 1}["b"]`, nil},
+    }
+
+    for _, tt := range tests {
+        testObject(t, tt.input, testEvalWith(in, tt.input), tt.expected)
+    }
+}
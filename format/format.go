@@ -0,0 +1,514 @@
+// Package format prints Monkey programs in a canonical layout.
+package format
+
+import (
+    "bytes"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/parser"
+    "necronet.info/interpreter/token"
+)
+
+const (
+    // lineWidth is the width past which the elements of a list are put on
+    // lines of their own.
+    lineWidth = 80
+    indentation = "    "
+)
+
+// Source formats a Monkey program. Formatting is idempotent: formatting
+// its result gives it back unchanged.
+//
+// Statements get lines of their own, indented by four spaces per block,
+// and end with a semicolon, but for if and for expressions when nothing
+// follows that could be read as continuing them. A block holding a single
+// statement stays on one line when it is written on one line. Operators
+// are spaced, but for ranges, and parenthesized only where the precedence
+// of the parser requires it.
+//
+// The arguments of a call and the elements of array, hash and set
+// literals go one per line when they do not fit in lineWidth columns or
+// when they are not all on the line the list opens on.
+//
+// Comments are kept: those alone on their line stay so, indented like the
+// statement or element that follows them, the others stay at the end of a
+// line. Single blank lines between statements and comments are kept too.
+func Source(source []byte) ([]byte, error) {
+    l := lexer.New(string(source))
+    p := parser.New(l)
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+    }
+
+    pr := &printer{lines: strings.Split(string(source), "\n"), comments: l.Comments()}
+    pr.program(program)
+    return pr.out, nil
+}
+
+type printer struct {
+    out []byte
+    indent int
+    // lineStart is set when the indentation of the current line has not
+    // been written yet.
+    lineStart bool
+
+    // lines are the lines of the source.
+    lines []string
+    comments []token.Token
+    // next is the first comment not printed yet.
+    next int
+    // lastLine is the source line of the last statement, element or
+    // comment a line was started for.
+    lastLine int
+}
+
+func (p *printer) write(s string) {
+    if s == "" {
+        return
+    }
+    if p.lineStart {
+        p.out = append(p.out, strings.Repeat(indentation, p.indent)...)
+        p.lineStart = false
+    }
+    p.out = append(p.out, s...)
+}
+
+// newline ends the current line, and adds an empty one after it if blank
+// is set.
+func (p *printer) newline(blank bool) {
+    p.out = append(p.out, '\n')
+    if blank {
+        p.out = append(p.out, '\n')
+    }
+    p.lineStart = true
+}
+
+func (p *printer) column() int {
+    column := len(p.out) - (bytes.LastIndexByte(p.out, '\n') + 1)
+    if p.lineStart {
+        column += len(indentation) * p.indent
+    }
+    return column
+}
+
+// try prints with print, and takes it back unless ok accepts the text
+// that was printed.
+func (p *printer) try(print func(), ok func(printed []byte) bool) bool {
+    saved := *p
+    print()
+    if ok(p.out[len(saved.out):]) {
+        return true
+    }
+    *p = saved
+    return false
+}
+
+// pending reports whether a comment not printed yet starts before pos.
+func (p *printer) pending(pos token.Position) bool {
+    return p.next < len(p.comments) && p.comments[p.next].Pos.Before(pos)
+}
+
+// pendingBetween reports whether a comment not printed yet lies between
+// from and to.
+func (p *printer) pendingBetween(from, to token.Position) bool {
+    for _, c := range p.comments[p.next:] {
+        if !c.Pos.Before(to) {
+            return false
+        }
+        if from.Before(c.Pos) {
+            return true
+        }
+    }
+    return false
+}
+
+// ownLine reports whether comment c is alone on its line in the source.
+func (p *printer) ownLine(c token.Token) bool {
+    return strings.TrimSpace(p.lines[c.Pos.Line-1][:c.Pos.Column-1]) == ""
+}
+
+// blankBefore reports whether the source line before line is blank.
+func (p *printer) blankBefore(line int) bool {
+    return line >= 2 && strings.TrimSpace(p.lines[line-2]) == ""
+}
+
+// breakLine starts a line for something at line in the source, after a
+// blank line if there is one before it in the source. first is set for
+// the first line of a block or list, which never follows a blank line.
+func (p *printer) breakLine(line int, first bool) {
+    if len(p.out) != 0 {
+        p.newline(!first && line > p.lastLine && p.blankBefore(line))
+    }
+    p.lastLine = line
+}
+
+// flush prints the comments before pos. It returns first, cleared when a
+// comment took a line of its own.
+func (p *printer) flush(pos token.Position, first bool) bool {
+    for p.pending(pos) {
+        c := p.comments[p.next]
+        p.next++
+        if !p.ownLine(c) && len(p.out) > 0 {
+            p.write(" " + c.Literal)
+            continue
+        }
+        p.breakLine(c.Pos.Line, first)
+        p.write(c.Literal)
+        first = false
+    }
+    return first
+}
+
+// line starts the line of a statement, or of an element of a list, that
+// starts at pos in the source, after the comments before it.
+func (p *printer) line(pos token.Position, first bool) {
+    first = p.flush(pos, first)
+    p.breakLine(pos.Line, first)
+}
+
+func (p *printer) program(program *ast.Program) {
+    p.statements(program.Statements)
+    p.flush(token.Position{Line: math.MaxInt}, len(program.Statements) == 0)
+    if len(p.out) != 0 {
+        p.newline(false)
+    }
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+    for i, s := range statements {
+        p.line(s.Pos(), i == 0)
+        var next ast.Statement
+        if i+1 < len(statements) {
+            next = statements[i+1]
+        }
+        p.statement(s, needsSemicolon(s, next))
+    }
+}
+
+// needsSemicolon reports whether statement s, followed by next, must end
+// with a semicolon. Only if and for expressions may go without one, as
+// long as next cannot be read as an operand or operator following them.
+func needsSemicolon(s, next ast.Statement) bool {
+    es, ok := s.(*ast.ExpressionStatement)
+    if !ok {
+        return true
+    }
+    switch es.Expression.(type) {
+    case *ast.IfExpression, *ast.ForExpression:
+    default:
+        return true
+    }
+    nextES, ok := next.(*ast.ExpressionStatement)
+    return ok && leadsWithOperator(nextES.Expression)
+}
+
+// leadsWithOperator reports whether e is printed starting with a token
+// that may continue an expression: a parenthesis, bracket or minus.
+func leadsWithOperator(e ast.Expression) bool {
+    switch e := e.(type) {
+    case *ast.PrefixExpression:
+        return e.Operator == "-"
+    case *ast.IntegerLiteral:
+        return e.Value < 0
+    case *ast.ArrayLiteral:
+        return true
+    case *ast.InfixExpression:
+        return precedence(e.Left) < parser.Precedence(e.Token.Type) || leadsWithOperator(e.Left)
+    case *ast.CallExpression:
+        return precedence(e.Function) < parser.CALL || leadsWithOperator(e.Function)
+    case *ast.IndexExpression:
+        return precedence(e.Left) < parser.CALL || leadsWithOperator(e.Left)
+    case *ast.SliceExpression:
+        return precedence(e.Left) < parser.CALL || leadsWithOperator(e.Left)
+    }
+    return false
+}
+
+func (p *printer) statement(s ast.Statement, semicolon bool) {
+    switch s := s.(type) {
+    case *ast.LetStatement:
+        p.write("let " + s.Name.Value + " = ")
+        p.expression(s.Value)
+    case *ast.ReturnStatement:
+        p.write("return")
+        if s.ReturnValue != nil {
+            p.write(" ")
+            p.expression(s.ReturnValue)
+        }
+    case *ast.ExportStatement:
+        p.write("export ")
+        p.statement(s.Statement, false)
+    case *ast.ExpressionStatement:
+        p.expression(s.Expression)
+    }
+    if semicolon {
+        p.write(";")
+    }
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+    if p.pending(block.Rbrace) || !p.inline(block) {
+        p.write("{")
+        p.indent++
+        p.statements(block.Statements)
+        p.flush(block.Rbrace, len(block.Statements) == 0)
+        p.indent--
+        p.newline(false)
+        p.write("}")
+    }
+}
+
+// inline prints a block on one line if it is empty, or holds a single
+// statement that is written on one line, and reports whether it did.
+func (p *printer) inline(block *ast.BlockStatement) bool {
+    switch len(block.Statements) {
+    case 0:
+        p.write("{}")
+        return true
+    case 1:
+        s := block.Statements[0]
+        line := block.Token.Pos.Line
+        if s.Pos().Line != line || block.Rbrace.Line != line {
+            return false
+        }
+        return p.try(func() {
+            p.write("{ ")
+            p.statement(s, false)
+            p.write(" }")
+        }, func(printed []byte) bool {
+            return bytes.IndexByte(printed, '\n') < 0
+        })
+    }
+    return false
+}
+
+// precedence returns the precedence of the operator applied last by e,
+// which decides whether it needs parentheses as an operand.
+func precedence(e ast.Expression) int {
+    switch e := e.(type) {
+    case *ast.InfixExpression:
+        return parser.Precedence(e.Token.Type)
+    case *ast.PrefixExpression, *ast.SpawnExpression, *ast.ImportExpression:
+        return parser.PREFIX
+    case *ast.IntegerLiteral:
+        if e.Value < 0 {
+            return parser.PREFIX
+        }
+    case *ast.YieldExpression:
+        // yield takes everything after it as its value.
+        return parser.LOWEST
+    case *ast.CallExpression:
+        return parser.CALL
+    case *ast.IndexExpression, *ast.SliceExpression:
+        return parser.INDEX
+    }
+    return parser.INDEX + 1
+}
+
+// operand prints e, in parentheses if parenthesize is set.
+func (p *printer) operand(e ast.Expression, parenthesize bool) {
+    if parenthesize {
+        p.write("(")
+    }
+    p.expression(e)
+    if parenthesize {
+        p.write(")")
+    }
+}
+
+func (p *printer) expression(e ast.Expression) {
+    switch e := e.(type) {
+    case *ast.Identifier:
+        p.write(e.Value)
+    case *ast.IntegerLiteral:
+        if e.Token.Literal != "" {
+            p.write(e.Token.Literal)
+        } else {
+            p.write(strconv.FormatInt(e.Value, 10))
+        }
+    case *ast.StringLiteral:
+        p.write(`"` + e.Value + `"`)
+    case *ast.Boolean:
+        p.write(strconv.FormatBool(e.Value))
+
+    case *ast.PrefixExpression:
+        p.write(e.Operator)
+        p.operand(e.Right, precedence(e.Right) < parser.PREFIX)
+    case *ast.InfixExpression:
+        prec := parser.Precedence(e.Token.Type)
+        p.operand(e.Left, precedence(e.Left) < prec)
+        if prec == parser.RANGE {
+            p.write(e.Operator)
+        } else {
+            p.write(" " + e.Operator + " ")
+        }
+        p.operand(e.Right, precedence(e.Right) <= prec)
+
+    case *ast.IfExpression:
+        p.write("if (")
+        p.expression(e.Condition)
+        p.write(") ")
+        p.block(e.Consequence)
+        if e.Alternative != nil {
+            p.write(" else ")
+            p.block(e.Alternative)
+        }
+    case *ast.ForExpression:
+        p.write("for (" + e.Variable.Value + " in ")
+        p.expression(e.Iterable)
+        p.write(") ")
+        p.block(e.Body)
+    case *ast.FunctionLiteral:
+        p.write("fn")
+        p.parameters(e.Parameters)
+        p.block(e.Body)
+    case *ast.MacroLiteral:
+        p.write("macro")
+        p.parameters(e.Parameters)
+        p.block(e.Body)
+
+    case *ast.CallExpression:
+        p.operand(e.Function, precedence(e.Function) < parser.CALL)
+        p.expressions("(", e.Token.Pos, e.Arguments, ")")
+    case *ast.ArrayLiteral:
+        p.expressions("[", e.Token.Pos, e.Elements, "]")
+    case *ast.SetLiteral:
+        p.expressions("{", e.Token.Pos, e.Elements, "}")
+    case *ast.HashLiteral:
+        p.list("{", e.Token.Pos, len(e.Pairs), func(i int) token.Position {
+            return start(e.Pairs[i].Key)
+        }, func(i int) {
+            p.expression(e.Pairs[i].Key)
+            p.write(": ")
+            p.expression(e.Pairs[i].Value)
+        }, "}")
+    case *ast.IndexExpression:
+        p.operand(e.Left, precedence(e.Left) < parser.CALL)
+        p.write("[")
+        p.expression(e.Index)
+        p.write("]")
+    case *ast.SliceExpression:
+        p.operand(e.Left, precedence(e.Left) < parser.CALL)
+        p.write("[")
+        p.optional(e.Start)
+        p.write(":")
+        p.optional(e.End)
+        if e.Step != nil {
+            p.write(":")
+            p.expression(e.Step)
+        }
+        p.write("]")
+
+    case *ast.YieldExpression:
+        p.write("yield")
+        if e.Value != nil {
+            p.write(" ")
+            p.expression(e.Value)
+        }
+    case *ast.SpawnExpression:
+        p.write("spawn ")
+        p.operand(e.Call, precedence(e.Call) < parser.PREFIX)
+    case *ast.ImportExpression:
+        p.write("import ")
+        p.operand(e.Path, precedence(e.Path) < parser.PREFIX)
+    }
+}
+
+func (p *printer) optional(e ast.Expression) {
+    if e != nil {
+        p.expression(e)
+    }
+}
+
+func (p *printer) parameters(params []*ast.Identifier) {
+    names := make([]string, len(params))
+    for i, param := range params {
+        names[i] = param.Value
+    }
+    p.write("(" + strings.Join(names, ", ") + ") ")
+}
+
+func (p *printer) expressions(open string, pos token.Position, elements []ast.Expression, close string) {
+    p.list(open, pos, len(elements), func(i int) token.Position {
+        return start(elements[i])
+    }, func(i int) {
+        p.expression(elements[i])
+    }, close)
+}
+
+// list prints n elements between open and close, separated by commas.
+// They stay on one line when they fit and are all on the line open is at,
+// in the source, with no comments between them. Only the last one may then
+// span lines, so that formatting again keeps them together. Otherwise each
+// element, printed by element and starting at start(i) in the source, gets
+// a line of its own.
+func (p *printer) list(open string, pos token.Position, n int, start func(i int) token.Position, element func(i int), close string) {
+    p.write(open)
+    if n == 0 {
+        p.write(close)
+        return
+    }
+
+    last := start(n - 1)
+    if last.Line == pos.Line && !p.pendingBetween(pos, last) {
+        column, from, lastAt := p.column(), len(p.out), 0
+        flat := p.try(func() {
+            for i := 0; i < n; i++ {
+                if i > 0 {
+                    p.write(", ")
+                }
+                if i == n-1 {
+                    lastAt = len(p.out) - from
+                }
+                element(i)
+            }
+        }, func(printed []byte) bool {
+            if bytes.IndexByte(printed[:lastAt], '\n') >= 0 {
+                return false
+            }
+            width := bytes.IndexByte(printed, '\n')
+            if width < 0 {
+                width = len(printed)
+            }
+            return column+width+len(close) <= lineWidth && !p.pendingBetween(pos, last)
+        })
+        if flat {
+            p.write(close)
+            return
+        }
+    }
+
+    p.indent++
+    for i := 0; i < n; i++ {
+        p.line(start(i), i == 0)
+        element(i)
+        if i < n-1 {
+            p.write(",")
+        }
+    }
+    p.indent--
+    p.newline(false)
+    p.write(close)
+}
+
+// start returns the position of the first token of e, which for infix,
+// call and index expressions is in their left operand.
+func start(e ast.Expression) token.Position {
+    switch e := e.(type) {
+    case *ast.InfixExpression:
+        return start(e.Left)
+    case *ast.CallExpression:
+        return start(e.Function)
+    case *ast.IndexExpression:
+        return start(e.Left)
+    case *ast.SliceExpression:
+        return start(e.Left)
+    }
+    return e.Pos()
+}
@@ -0,0 +1,153 @@
+package format
+
+import (
+    "strings"
+    "testing"
+
+    "necronet.info/interpreter/internal/monkeytest"
+)
+
+func TestSource(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {"", ""},
+        {"let x=1", "let x = 1;\n"},
+        {"let x = 1; let y = 2\nx+y", "let x = 1;\nlet y = 2;\nx + y;\n"},
+        {"return 1", "return 1;\n"},
+        {`export let a = "s"`, "export let a = \"s\";\n"},
+        {`let m = import "m"`, "let m = import \"m\";\n"},
+
+        // Parentheses only where needed.
+        {"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+        {"1 + (2 * 3)", "1 + 2 * 3;\n"},
+        {"(1 + 2) + 3", "1 + 2 + 3;\n"},
+        {"1 - (2 - 3)", "1 - (2 - 3);\n"},
+        {"1 - (2 + 3)", "1 - (2 + 3);\n"},
+        {"-(a + b)", "-(a + b);\n"},
+        {"-(-a)", "--a;\n"},
+        {"!(a == b)", "!(a == b);\n"},
+        {"(-a)(1)", "(-a)(1);\n"},
+        {"(a + b)[0]", "(a + b)[0];\n"},
+        {"-(f(1)[0])", "-f(1)[0];\n"},
+        {"(a | b) & c", "(a | b) & c;\n"},
+        {"0..(n - 1)", "0..n - 1;\n"},
+        {"(0..n) == r", "0..n == r;\n"},
+        {"spawn (f)(1)", "spawn f(1);\n"},
+        {"let f = fn() { (yield 1) + 2 }", "let f = fn() { (yield 1) + 2 };\n"},
+
+        // Expressions.
+        {`[1,"a",true]`, "[1, \"a\", true];\n"},
+        {`{"a":1,2:[]}`, "{\"a\": 1, 2: []};\n"},
+        {`{1,2}`, "{1, 2};\n"},
+        {`{}`, "{};\n"},
+        {"xs[1:2] xs[:2] xs[1:] xs[::2] xs[:]", "xs[1:2];\nxs[:2];\nxs[1:];\nxs[::2];\nxs[:];\n"},
+        {"f()(1)(2,3)", "f()(1)(2, 3);\n"},
+        {"010", "010;\n"},
+
+        // Blocks.
+        {"fn(a,b){a+b}", "fn(a, b) { a + b };\n"},
+        {"fn() {}", "fn() {};\n"},
+        {"fn(){\nlet a=1;a}", "fn() {\n    let a = 1;\n    a;\n};\n"},
+        {"fn(){ a\n}", "fn() {\n    a;\n};\n"},
+        {"let m = macro(x) { quote(unquote(x)) }", "let m = macro(x) { quote(unquote(x)) };\n"},
+        {"if (a) { return 1; } else { 2 }", "if (a) { return 1 } else { 2 }\n"},
+        {"if(a){\nb}else{c}", "if (a) {\n    b;\n} else { c }\n"},
+        {"if (a) { b } c", "if (a) { b }\nc;\n"},
+        {"if (a) { b }; -1", "if (a) { b };\n-1;\n"},
+        {"if (a) { b }; (c)(1)", "if (a) { b }\nc(1);\n"},
+        {"if (a) { b }; (c + d)(1)", "if (a) { b };\n(c + d)(1);\n"},
+        {"for (x in xs) { puts(x) }; [1]", "for (x in xs) { puts(x) };\n[1];\n"},
+        {"let f = fn() {\n    for (x in xs) {\n        yield x\n    }\n}", "let f = fn() {\n    for (x in xs) {\n        yield x;\n    }\n};\n"},
+
+        // Blank lines.
+        {"a\n\n\n\nb\nc", "a;\n\nb;\nc;\n"},
+        {"fn() {\n\n    a\n\n    b\n\n}", "fn() {\n    a;\n\n    b;\n};\n"},
+        {"a; b\n\nc", "a;\nb;\n\nc;\n"},
+
+        // Wrapping.
+        {
+            `puts("aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccc", "dd")`,
+            "puts(\n    \"aaaaaaaaaaaaaaaaaaaa\",\n    \"bbbbbbbbbbbbbbbbbbbb\",\n    \"cccccccccccccccccccc\",\n    \"dd\"\n);\n",
+        },
+        {
+            `puts("aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccc", "")`,
+            `puts("aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccc", "");` + "\n",
+        },
+        {"let h = {\"a\": 1,\n  \"b\": [1,\n2]}", "let h = {\n    \"a\": 1,\n    \"b\": [\n        1,\n        2\n    ]\n};\n"},
+        {"f(1, fn(x) {\n  x\n})", "f(1, fn(x) {\n    x;\n});\n"},
+        {"f(fn(x) { let y = x; y }, 1)", "f(\n    fn(x) {\n        let y = x;\n        y;\n    },\n    1\n);\n"},
+        {"f(\n1, 2)", "f(\n    1,\n    2\n);\n"},
+
+        // Comments.
+        {"// only a comment", "// only a comment\n"},
+        {"// a\n\n// b\nx // c\n// d", "// a\n\n// b\nx; // c\n// d\n"},
+        {"let a = 1;   // one  \nlet b = 2;", "let a = 1; // one\nlet b = 2;\n"},
+        {"fn() { // start\n  a // a\n  // end\n}", "fn() { // start\n    a; // a\n    // end\n};\n"},
+        {"fn() {\n  // nothing\n}", "fn() {\n    // nothing\n};\n"},
+        {"if (a) { b } // b\nc", "if (a) { b } // b\nc;\n"},
+        {"f(1, // one\n  2)", "f(\n    1, // one\n    2\n);\n"},
+        {"{\n  // first\n  \"a\": 1,\n\n  // second\n  \"b\": 2\n}", "{\n    // first\n    \"a\": 1,\n\n    // second\n    \"b\": 2\n};\n"},
+        {"f(1, 2 // two\n)", "f(1, 2); // two\n"},
+        {"let a = 1 + // one\n  2;", "let a = 1 + 2; // one\n"},
+        {`"a // b" // c`, "\"a // b\"; // c\n"},
+    }
+
+    for _, tt := range tests {
+        formatted, err := Source([]byte(tt.input))
+        if err != nil {
+            t.Errorf("%q: %s", tt.input, err)
+            continue
+        }
+        if string(formatted) != tt.expected {
+            t.Errorf("%q:\n got %q\nwant %q", tt.input, formatted, tt.expected)
+        }
+        if again, _ := Source(formatted); string(again) != string(formatted) {
+            t.Errorf("formatting %q is not idempotent:\n got %q\nthen %q", tt.input, formatted, again)
+        }
+    }
+}
+
+func TestSourceErrors(t *testing.T) {
+    _, err := Source([]byte("let = 1"))
+    if err == nil || !strings.HasPrefix(err.Error(), "parser errors:\n\texpected next token to be IDENT") {
+        t.Errorf("wrong error. got=%v", err)
+    }
+}
+
+func parse(input string) (string, []string) {
+    program, errs := monkeytest.Parse(input)
+    if len(errs) != 0 {
+        return "", errs
+    }
+    return program.String(), nil
+}
+
+// TestRoundTrip formats every program of monkeytest.Programs,
+// checking that the result parses to the same program and that formatting
+// it again changes nothing.
+func TestRoundTrip(t *testing.T) {
+    for _, input := range monkeytest.Programs {
+        formatted, err := Source([]byte(input))
+        if err != nil {
+            t.Errorf("%q: %s", input, err)
+            continue
+        }
+
+        expected, _ := parse(input)
+        got, errs := parse(string(formatted))
+        if len(errs) != 0 {
+            t.Errorf("%q formatted as %q: parser errors: %v", input, formatted, errs)
+            continue
+        }
+        if got != expected {
+            t.Errorf("%q formatted as %q, which parses as %q, not %q", input, formatted, got, expected)
+        }
+
+        again, err := Source(formatted)
+        if err != nil || string(again) != string(formatted) {
+            t.Errorf("formatting %q is not idempotent:\n got %q\nthen %q", input, formatted, again)
+        }
+    }
+}
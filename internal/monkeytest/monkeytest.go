@@ -0,0 +1,28 @@
+// Package monkeytest holds helpers shared by the tests of the other
+// packages.
+package monkeytest
+
+import (
+    "testing"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/parser"
+)
+
+// Parse parses input and returns the program with the parser errors.
+func Parse(input string) (*ast.Program, []string) {
+    p := parser.New(lexer.New(input))
+    program := p.ParseProgram()
+    return program, p.Errors()
+}
+
+// MustParse parses input, failing the test if it does not parse.
+func MustParse(t testing.TB, input string) *ast.Program {
+    t.Helper()
+    program, errs := Parse(input)
+    if len(errs) != 0 {
+        t.Fatalf("%q: parser errors: %v", input, errs)
+    }
+    return program
+}
@@ -0,0 +1,812 @@
+package monkeytest
+
+// Programs lists Monkey programs that between them use every part of the
+// language. Tests that check a transformation of programs, or another way
+// of running them, against the evaluator run it on each of them; not all
+// of them run without errors, or even resolve.
+var Programs = []string{
+    `
+        let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+        fib(20)`,
+    `
+        let sum = fn(n) { let total = 0; for (i in 0..n) { let total = total + i * 2 }; total };
+        sum(10000)`,
+    `
+        let adder = fn(a) { fn(b) { a + b } };
+        let total = 0;
+        for (i in 0..1000) { let total = adder(i)(total) };
+        total`,
+    `
+        let xs = map(range(1000), fn(x) { x * 3 });
+        let evens = filter(xs, fn(x) { x / 2 * 2 == x });
+        reduce(evens, fn(acc, x) { acc + x }, 0)`,
+    `
+        let h = {};
+        for (i in 0..500) { let h = merge(h, {i: i * i}) };
+        let total = 0;
+        for (k in keys(h)) { let total = total + h[k] };
+        total`,
+    `
+        let s = "";
+        for (i in 0..500) { let s = s + "ab" };
+        len(s)`,
+    "map([1, 2, 3], fn(x) { x * 2 })",
+    "map([], fn(x) { x })",
+    `map([1, "a"], len)`,
+    "map([1], fn(x, y) { x })",
+    "map([1], 1)",
+    "map(1, fn(x) { x })",
+    "filter([1, 2, 3, 4], fn(x) { x > 2 })",
+    "filter([1, 2], fn(x) { false })",
+    "reduce([1, 2, 3, 4], fn(acc, x) { acc + x })",
+    "reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)",
+    "reduce([], fn(acc, x) { acc + x })",
+    "reduce([], fn(acc, x) { acc + x }, 0)",
+    `reduce(["a", "b"], fn(acc, x) { acc + x }, "")`,
+    "sort([3, 1, 2])",
+    `sort(["b", "c", "a"])`,
+    "sort([3, 1, 2], fn(a, b) { a > b })",
+    "sort([3, 1, 2], fn(a, b) { b - a })",
+    `sort([1, "a"])`,
+    `sort([1, 2], fn(a, b) { "x" })`,
+    "let a = [3, 1, 2]; sort(a); a",
+    "reverse([1, 2, 3])",
+    "reverse([])",
+    "slice([1, 2, 3, 4], 1, 3)",
+    "slice([1, 2, 3, 4], -2)",
+    "slice([1, 2, 3, 4], 3, 1)",
+    `slice([1, 2], "a")`,
+    "slice(1, 0)",
+    "concat([1], [2, 3], [])",
+    "concat()",
+    "concat([1], 2)",
+    "range(4)",
+    "range(2, 5)",
+    "range(5, 0, -2)",
+    "range(3, 1)",
+    "range(0, 5, 0)",
+    `len(zip([1, 2, 3], ["a", "b"]))`,
+    `zip([1, 2], ["a", "b"])[1][1]`,
+    "zip([1], 2)",
+    "any([1, 2, 3], fn(x) { x > 2 })",
+    "any([1, 2, 3], fn(x) { x > 3 })",
+    "any([], fn(x) { true })",
+    "all([1, 2, 3], fn(x) { x > 0 })",
+    "all([1, 2, 3], fn(x) { x > 1 })",
+    "all([], fn(x) { false })",
+    "find([1, 2, 3], fn(x) { x > 1 })",
+    "find([1, 2, 3], fn(x) { x > 3 })",
+    "index_of([1, 2, 3], 2)",
+    `index_of(["a", "b"], "b")`,
+    "index_of([1, 2, 3], 4)",
+    "index_of(1, 1)",
+    "contains([1, 2, 3], 3)",
+    `contains([1, 2, 3], "3")`,
+    "contains([[1, 2], [3]], [3])",
+    `index_of([{"a": 1}, {"b": 2}], {"b": 2})`,
+    "reduce(map(range(100000), fn(x) { x * 2 }), fn(acc, x) { acc + x }, 0)",
+    `keys({"b": 1, "a": 2, "c": 3})`,
+    "keys({3: 1, 1: 2, 2: 3})",
+    "keys({})",
+    `len(keys({"a": 1, 2: 2, true: 3}))`,
+    `keys({"a": 1, 2: 2, true: 3})[0]`,
+    `keys({"a": 1, 2: 2, true: 3})[1]`,
+    `keys({"a": 1, 2: 2, true: 3})[2]`,
+    "keys([1])",
+    `values({"b": 1, "a": 2, "c": 3})`,
+    `items({"b": 1, "a": 2})[0][0]`,
+    `items({"b": 1, "a": 2})[0][1]`,
+    `items({"b": 1, "a": 2})[1][0]`,
+    `has({"a": 1}, "a")`,
+    `has({"a": 1}, "b")`,
+    `has({"a": 1}, [1])`,
+    `has({"a": 1}, fn(x) { x })`,
+    `delete({"a": 1, "b": 2}, "a")["a"]`,
+    `len(delete({"a": 1, "b": 2}, "a"))`,
+    `len(delete({"a": 1, "b": 2}, "c"))`,
+    `let h = {"a": 1, "b": 2}; delete(h, "a"); h["a"]`,
+    `let h = {"a": 1, "b": 2}; remove(h, "a")`,
+    `let h = {"a": 1, "b": 2}; remove(h, "a"); keys(h)`,
+    `let h = {"a": 1}; remove(h, "b")`,
+    `let m = merge({"a": 1, "b": 2}, {"b": 3, "c": 4}); values(m)`,
+    `let m = merge({"b": 1, "a": 2}, {"c": 3, "b": 4}); keys(m)`,
+    `let h = {"a": 1, "b": 2}; remove(h, "a"); keys(merge(h, {"a": 3}))`,
+    "len(merge())",
+    "merge({}, 1)",
+    `len({"a": 1, "b": 2})`,
+    `let h = {"a": if (false) { 1 }}; [h["a"], has(h, "a"), h["b"], has(h, "b")]`,
+    `let x = 1; let y = 2; let grid = {[x, y]: "cell"}; grid[[1, 2]]`,
+    `{[1, 2]: "a"}[[2, 1]]`,
+    `{[1, [2, 3]]: "nested"}[[1, [2, 3]]]`,
+    `{[]: "empty"}[[]]`,
+    "len({[1, 2]: 1, [1, 2]: 2})",
+    "has({[0, 0]: true}, [0, 0])",
+    `let key = freeze({"a": 1, "b": 2}); {key: "hash"}[freeze({"b": 2, "a": 1})]`,
+    `{freeze({"a": [1]}): 1}[freeze({"a": [1]})]`,
+    `{freeze([{"a": 1}]): 1}[freeze([{"a": 1}])]`,
+    `{{"a": 1}: 1}`,
+    `{"a": 1}[{"a": 1}]`,
+    `{[{"a": 1}]: 1}`,
+    "{[fn(x) { x }]: 1}",
+    `{freeze({"f": fn(x) { x }}): 1}`,
+    "has({}, {})",
+    `let h = freeze({"a": 1}); remove(h, "a")`,
+    `let h = freeze({"a": 1}); delete(h, "a")["a"]`,
+    `let h = {"a": 1}; let f = freeze(h); remove(h, "a"); f["a"]`,
+    "let memo = {}; let memo = merge(memo, {[3, 4]: 7}); memo[[3, 4]]",
+    "len({1, 2, 2, 3})",
+    "len(set())",
+    `len(set([1, 1, "a"]))`,
+    "set(1)",
+    "{1, fn(x) { x }}",
+    "{1, [2, 3]} == {[2, 3], 1}",
+    "{1, 2} == {1, 3}",
+    "{1, 2} != {1, 3}",
+    "{1, 2} == [1, 2]",
+    "has({1, 2}, 2)",
+    "has({1, 2}, 3)",
+    "has([1], 1)",
+    "let s = {1}; add(s, 2)",
+    "let s = {1}; add(s, 1)",
+    "let s = {1}; add(s, 2); has(s, 2)",
+    `add({1}, {"a": 1})`,
+    `add({"a": 1}, 1)`,
+    "let s = {1, 2}; remove(s, 1)",
+    "let s = {1, 2}; remove(s, 3)",
+    "let s = {1, 2}; remove(s, 1); len(s)",
+    "let u = {1, 2} | {2, 3}; u == {1, 2, 3}",
+    "len({1} | {2} & {1})",
+    "sort({3, 1} | {2})",
+    "sort({1, 2, 3} & {2, 3, 4})",
+    "sort({1, 2, 3} - {2})",
+    "{1} < {2}",
+    "{1} * {2}",
+    "{1} | [2]",
+    "map({1, 2, 3}, fn(x) { x * 2 })",
+    "filter({1, 2, 3}, fn(x) { x > 1 })",
+    "reduce({1, 2, 3}, fn(acc, x) { acc + x })",
+    "any({1, 2}, fn(x) { x > 1 })",
+    "all({1, 2}, fn(x) { x > 1 })",
+    "find({1, 2, 3}, fn(x) { x > 1 })",
+    "sort(set({3, 1}))",
+    "{3, 1, 2}",
+    "set()",
+    `let s = {"a", 1}; add(s, true); s`,
+    "{a, 1, true}",
+    `split("a,b,c", ",")`,
+    `split("  a b   c ")`,
+    `split("", ",")`,
+    `split(1, ",")`,
+    `join(["a", "b", "c"], "-")`,
+    `join(["a", "b"])`,
+    `join([], ",")`,
+    `join(["a", 1], ",")`,
+    `trim("  hi  ")`,
+    `trim("xxhixx", "x")`,
+    `upper("Hello")`,
+    `lower("Hello")`,
+    `upper("a", "b")`,
+    `contains("monkey", "key")`,
+    `contains("monkey", "donkey")`,
+    `index_of("monkey", "key")`,
+    `index_of("monkey", "z")`,
+    `replace("a-b-c", "-", "+")`,
+    "a+b+c",
+    `starts_with("monkey", "mon")`,
+    `starts_with("monkey", "key")`,
+    `ends_with("monkey", "key")`,
+    `ends_with("monkey", "mon")`,
+    `repeat("ab", 3)`,
+    `repeat("ab", 0)`,
+    `repeat("ab", -1)`,
+    `repeat("ab", 9223372036854775807)`,
+    `repeat("ab", 536870913)`,
+    `repeat("", 9223372036854775807)`,
+    `format("%s is %d", "answer", 42)`,
+    "answer is 42",
+    `format("%t %v %q", true, [1, 2], "x")`,
+    `format("plain")`,
+    "format()",
+    "format(1)",
+    `slice("monkey", 1, 3)`,
+    `slice("monkey", 3)`,
+    `slice("monkey", -3)`,
+    `slice("monkey", 0, -1)`,
+    `slice("monkey", 4, 2)`,
+    `slice("monkey", 2, 100)`,
+    `slice("monkey")`,
+    "await(spawn fn() { 1 + 2 })",
+    "let add = fn(a, b) { a + b }; await(spawn add(1, 2))",
+    "let t = spawn fn() { 1 + true }; await(t)",
+    "spawn 1",
+    "spawn f(1)",
+    "spawn len(x)",
+    "await(1)",
+    `let ch = chan(); spawn fn() { send(ch, "ping") }; recv(ch)`,
+    "let ch = chan(2); send(ch, 1); send(ch, 2); [recv(ch), recv(ch)]",
+    "let ch = chan(1); send(ch, 1); close(ch); [recv(ch), recv(ch)]",
+    "let ch = chan(1); close(ch); send(ch, 1)",
+    "let ch = chan(); close(ch); close(ch)",
+    "close(1)",
+    "chan(-1)",
+    "send(1, 2)",
+    "let ch = chan(); let work = fn(n) { send(ch, n * n) }; for (i in 1..=10) { spawn work(i) }; reduce(1..=10, fn(acc, _x) { acc + recv(ch) }, 0)",
+    `let a = chan(); let b = chan(1); send(b, "b"); select(a, b)`,
+    `let a = chan(1); let b = chan(); select([a, "sent"], b)[0]`,
+    `let a = chan(1); select([a, "sent"]); recv(a)`,
+    "let a = chan(); close(a); select(a)",
+    "let a = chan(); close(a); select([a, 1])",
+    "select(1)",
+    "select([1, 2])",
+    "select()",
+    "chan()",
+    "spawn fn() { 1 }",
+    `
+    let results = chan(20);
+    let work = fn(n) {
+        let local = n * 2;
+        send(results, local);
+    };
+    let tasks = map(0..20, fn(n) { spawn work(n) });
+    for (task in tasks) { await(task) };
+    len(set(map(0..20, fn(_x) { recv(results) })))
+    `,
+    `
+    let s = set();
+    let h = reduce(0..800, fn(acc, i) { merge(acc, {i: i}) }, {});
+    let work = fn(n) {
+        for (i in 0..100) {
+            add(s, n * 100 + i);
+            add(s, i);
+            remove(h, n * 100 + i);
+        }
+    };
+    let tasks = map(0..8, fn(n) { spawn work(n) });
+    for (task in tasks) { await(task) };
+    [len(s), len(h)]
+    `,
+    `
+    let offset = 10;
+    let add = fn(x) { let y = x + offset; y };
+    reduce(1..=10, fn(acc, x) { acc + add(x) }, 0)
+    `,
+    "recv(chan())",
+    "send(chan(), 1)",
+    "select(chan())",
+    "await(spawn fn() { recv(chan()) })",
+    "5",
+    "10",
+    "-5",
+    "-10",
+    "5+5+5+5",
+    "5+5+5-5",
+    "3*10",
+    "15/5",
+    `len("")`,
+    `len("four")`,
+    `len("hello world")`,
+    "len(1)",
+    `len("four", "trois")`,
+    "[1, 2, 3, 2*2]",
+    `{"foo": 5}["foo"]`,
+    `{"foo": 5}["bar"]`,
+    `let key = "foo"; {"foo": 5}[key]`,
+    `{}["foo"]`,
+    "{5: 5}[5]",
+    "{true: 5}[true]",
+    "{false: 5}[false]",
+    `let two = "two";
+    {
+        "one": 10 - 9,
+        two: 1 + 1,
+        "thr" + "ee": 6 / 2,
+        4: 4,
+        true: 5,
+        false: 6
+    }`,
+    "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}",
+    `{trace("c"): trace("1"), trace("a"): trace("2"), trace("b"): trace("3")}`,
+    "{c: 1, a: 2, b: 3}",
+    `{"a": 1, "b": 2, "a": 3}`,
+    "{a: 3, b: 2}",
+    "[1, 2, 3][0]",
+    "[1, 2, 3][1]",
+    "[1, 2, 3][2]",
+    "let i = 0; [1][i];",
+    "[1, 2, 3][1 + 1];",
+    "let myArray = [1, 2, 3]; myArray[2];",
+    "let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+    "let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+    "[1, 2, 3][3]",
+    "[1, 2, 3][-1]",
+    "[1, 2, 3][-3]",
+    "[1, 2, 3][-4]",
+    "[][0]",
+    `"Hello world!"`,
+    `"Hello" + " " + "World!"`,
+    "let a = 5; a",
+    "let a = 5 * 5; a;",
+    "let a = 5; let b = a; b;",
+    "let a = 5; let b = a; let c = a + b + 5; c;",
+    "fn(x) { x + 2; } ;",
+    "(x + 2)",
+    "let identity = fn(x) { x; }; identity(5);",
+    "let identity = fn(x) { x; return x; }; identity(5);",
+    "let double = fn(x) { x*2; }; double(5);",
+    "let add = fn(x, y) { x+y; }; add(3, 5);",
+    "let add = fn(x, y) { x+y; }; add(5+5, add(5,5));",
+    "fn(x) { x; }(5)",
+    "5 + true",
+    "5 + true; 5;",
+    "true + false",
+    "5; true + false; 5",
+    "if (10 > 1) { true + false; }",
+    ` if (10 > 1) {
+                if (10 >1 ) {
+                    return true + false;
+                }
+            }
+            return 1;
+            `,
+    "10 / 0",
+    `"Hello" - "World"`,
+    `{"name": "Monkey"}[fn(x) { x }];`,
+    "return 10;",
+    "return 10; 9;",
+    "return 2 * 5;",
+    "9; return 10; 2*5",
+    "if (true) { 9 }",
+    "if (false) { 11 }",
+    "if (1) { 12 }",
+    "if (1 < 2) { 10 }",
+    "if (1 > 2) { 13 }",
+    " 1 < 2",
+    " 1 > 2",
+    " 1 < 1",
+    " 1 == 2",
+    " 1 != 2",
+    "true == true",
+    "false == true",
+    "true == false",
+    "true != false",
+    `"a" == "a"`,
+    `"a" == "b"`,
+    `"a" != "b"`,
+    "[1, 2] == [1, 2]",
+    "[1, 2] == [2, 1]",
+    "[1, [2, 3]] == [1, [2, 3]]",
+    "[1, 2] != [1, 2, 3]",
+    `{"a": 1, "b": [2]} == {"b": [2], "a": 1}`,
+    `{"a": 1} == {"a": 2}`,
+    `{"a": 1} != {"b": 1}`,
+    "[] == {}",
+    `1 == "1"`,
+    "let a = [1]; a == a",
+    "let f = fn() { 1 }; f == f",
+    "fn() { 1 } == fn() { 1 }",
+    "!true",
+    "!false",
+    "!5",
+    "!!true",
+    "!!5",
+    "len(0..10)",
+    "len(0..=10)",
+    "len(5..0)",
+    "let n = 4; len(1..n - 1)",
+    "len(0..1000000000000)",
+    "len(-5000000000000000000..5000000000000000000)",
+    "find(-5000000000000000000..5000000000000000000, fn(x) { true })",
+    "map(0..4, fn(x) { x * x })",
+    "filter(1..=10, fn(x) { x > 8 })",
+    "reduce(1..=4, fn(acc, x) { acc * x })",
+    "find(0..1000000000000, fn(x) { x > 3 })",
+    "any(0..1000000000000, fn(x) { x > 3 })",
+    "sort(3..0)",
+    "len(set(0..3))",
+    "0..3 == 0..=2",
+    "0..3 == 0..3",
+    "0..3 == 1..4",
+    "1..0 == 5..2",
+    `"a".."b"`,
+    `1.."b"`,
+    "1..3",
+    "1..=3",
+    "let total = 0; for (x in 1..=4) { let total = total + x; }; total",
+    "let total = 0; for (x in [1, 2, 3]) { let total = total + x; }; total",
+    "let seen = set(); for (x in {1, 2, 3}) { add(seen, x * 10) }; sort(seen)",
+    "for (x in 0..3) { x }",
+    "for (x in 0..3) { x }; x",
+    "for (x in []) { x }",
+    "let f = fn() { for (x in 0..1000000000000) { if (x > 2) { return x; } } }; f()",
+    "let s = {1, 2}; for (x in s) { remove(s, x) }; len(s)",
+    "for (x in 1) { x }",
+    `for (x in {"a": 1}) { x }`,
+    "for (x in 0..3) { x + true }",
+    "for (x in y) { x }",
+    "let f = fn(a) { let b = a * 2; fn(c) { a + b + c } }; f(1)(10)",
+    "let f = fn(len) { len }; f(3) + len([1])",
+    "let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; odd(7)",
+    "if (false) { foobar }",
+    "let f = fn() { let x = 1 }; f(); x",
+    `let f = fn() { "s" }; [f(), f()]`,
+    "let f = fn() { 100000 }; [f(), f()]",
+    `let f = fn() { "s" }; [f(), 100000]`,
+    "let a = fn() { known }(); a",
+    "let b = 2; unknown",
+    "for (x in 0..10) { x }",
+    "let g = fn() { yield 1; yield 2; }(); [next(g), next(g), next(g)]",
+    `let g = fn() { yield 1; }(); next(g); next(g, "done")`,
+    "let g = fn() { yield; }(); next(g, 1)",
+    "let count = fn(n) { for (i in 0..n) { yield i * 10; } }; map(count(3), fn(x) { x })",
+    "let naturals = fn() { for (i in 0..9223372036854775807) { yield i; } }; find(naturals(), fn(x) { x > 5 })",
+    "let g = fn() { yield 1; return 5; yield 2; }; sort(g())",
+    "let total = 0; for (x in fn() { yield 1; yield 2; }()) { let total = total + x; }; total",
+    "let g = fn(a, b) { yield a; yield b; }; let it = g(1); 1",
+    "let g = fn() { yield 1; yield 1 + true; }(); next(g); next(g)",
+    "let g = fn() { yield 1; yield 1 + true; }(); map(g, fn(x) { x })",
+    "let g = fn() { yield 1; yield 2; }(); close(g); next(g)",
+    "let g = fn() { yield 1; yield 2; }(); next(g); close(g); next(g)",
+    "let g = fn() { yield 1; }(); len(set(g)) + len(set(g))",
+    "next([1])",
+    "fn() { yield 1; }()",
+    "let g = fn() { yield 1; yield 2; }(); next(g)",
+    "let g = fn() { yield 1; yield 2; }(); next(g); next(g)",
+    "next(fn() { for (i in 0..9223372036854775807) { yield i; } }())",
+    "double(21)",
+    "answer()",
+    "x1",
+    "add(2, 3)",
+    `shout("hi")`,
+    "negate(true)",
+    "sum()",
+    "sum(1, 2, 3)",
+    "total([1, 2, 3])",
+    `len(words("a b c"))`,
+    "kind(1)",
+    `kind("a")`,
+    "kind(if (false) { 1 })",
+    "size([1, 2])",
+    "nothing()",
+    "divide(6, 3)",
+    "small(255)",
+    "divide(1, 0)",
+    "add(1)",
+    `add(1, "2")`,
+    `total([1, "2"])`,
+    `size("a")`,
+    "small(256)",
+    `let f = fn(x) { lookup("x") }; f(7)`,
+    "fromContext()",
+    "let f = fn() { 1 }; f()",
+    "quote(5)",
+    "quote(5 + 8)",
+    "(5 + 8)",
+    "quote(foobar)",
+    "quote(foobar + barfoo)",
+    "(foobar + barfoo)",
+    "quote(unquote(4))",
+    "4",
+    "quote(unquote(4 + 4))",
+    "8",
+    "quote(8 + unquote(4 + 4))",
+    "(8 + 8)",
+    "let foobar = 8; quote(unquote(foobar))",
+    "quote(unquote(true == false))",
+    `quote(unquote("a" + "b"))`,
+    `quote(unquote([1, "a"]))`,
+    "[1,a]",
+    `quote(unquote({"a": 1}))`,
+    "{a:1}",
+    "quote(unquote(quote(4 + 4)))",
+    "(4 + 4)",
+    "let q = quote(4 + 4); quote(unquote(q) + 8)",
+    "((4 + 4) + 8)",
+    "let f = fn(x) { quote(unquote(x) * y) }; f(2)",
+    "(2 * y)",
+    `let unless = macro(cond, cons, alt) { quote(if (unquote(cond)) { unquote(alt) } else { unquote(cons) }) };
+unless(10 > 5, "no", "yes")`,
+    "let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5)",
+    "let ignore = macro(x) { quote(1) }; ignore(undefined)",
+    "let twice = macro(x) { quote(unquote(x) + unquote(x)) }; let f = fn(y) { twice(y) }; f(4)",
+    "let m = macro(x) { let q = quote(unquote(x) * 2); q }; m(3)",
+    "let m = macro(x) { 1 }; m(2)",
+    "let m = macro(x) { quote(x) }; m(1, 2)",
+    "let m = macro() { quote(unquote(nope)) }; m()",
+    "fn() { macro(x) { x } }()",
+    "quote(1, 2)",
+    "quote(unquote(1, 2))",
+    "quote(unquote(fn(x) { x }))",
+    "unquote(1)",
+    "let number = 1; let infix = macro() { quote(1 + 2) }; infix(); fn() { infix() }",
+    "path/filepath",
+    `
+            let square = fn(x) { x * x };
+            let ten = 10;
+        `,
+    `let m = import "lib/math"; m["square"](3)`,
+    `let m = import "lib/math.mk"; m["ten"]`,
+    `let path = "lib/" + "math"; let m = import path; m["square"](m["ten"])`,
+    `
+            let x = 1;
+            let get = fn() { x };
+        `,
+    `let x = 2; let m = import "counter"; m["get"]() + x`,
+    `
+            let prefix = "Hello, ";
+            export let greet = fn(name) { prefix + name };
+        `,
+    `let g = import "greet"; g["greet"]("Monkey")`,
+    `let g = import "greet"; g["prefix"]`,
+    `module "greet" has no member "prefix"`,
+    "let loaded = tick();",
+    `
+        let a = import "once";
+        let b = import "once";
+        a["loaded"] + b["loaded"]
+    `,
+    `import "once"`,
+    `let b = import "b"; let value = b["value"] + 1;`,
+    "let value = 41;",
+    `let a = import "pkg/a"; a["value"]`,
+    `let b = import "b";`,
+    `let c = import "c";`,
+    `let a = import "a";`,
+    `let me = import "self";`,
+    "let x = 1 + true;",
+    "let x = 1;",
+    `import "a"`,
+    `import "self"`,
+    `import "missing"`,
+    "import 5",
+    `import "broken"`,
+    `import "failing"`,
+    `let m = import "plain"; m[1]`,
+    `"monkey"[0]`,
+    `"monkey"[5]`,
+    `"monkey"[-1]`,
+    `"monkey"[6]`,
+    `"monkey"[-7]`,
+    `""[0]`,
+    `"monkey"["a"]`,
+    "[1, 2, 3, 4, 5][1:3]",
+    "[1, 2, 3, 4, 5][:2]",
+    "[1, 2, 3, 4, 5][3:]",
+    "[1, 2, 3, 4, 5][:]",
+    "[1, 2, 3, 4, 5][::2]",
+    "[1, 2, 3, 4, 5][1::2]",
+    "[1, 2, 3, 4, 5][-2:]",
+    "[1, 2, 3, 4, 5][:-2]",
+    "[1, 2, 3, 4, 5][-100:100]",
+    "[1, 2, 3, 4, 5][4:2]",
+    "[1, 2, 3, 4, 5][::-1]",
+    "[1, 2, 3, 4, 5][3:0:-1]",
+    "[1, 2, 3, 4, 5][::-2]",
+    "[1, 2, 3, 4, 5][-1:-100:-2]",
+    "[1, 2, 3][::4611686018427387904]",
+    "[][:]",
+    "let a = [1, 2, 3]; let b = a[:]; len(push(b, 4)) + len(a)",
+    `"monkey"[1:3]`,
+    `"monkey"[3:]`,
+    `"monkey"[:-3]`,
+    `"monkey"[::-1]`,
+    `"monkey"[::2]`,
+    "[1, 2][::0]",
+    `[1, 2]["a":]`,
+    `{"a": 1}[1:]`,
+    "[1, 2][x:]",
+    `"abc"[3]`,
+    "[1, 2, 3][1:100]",
+    `{"a": 1}["b"]`,
+    `"hello world";`,
+    "[1,2,3,4*4]",
+    `return 5;
+			  return 10;
+			  return 993322;`,
+    "return x;",
+    "fn() { return x }",
+    "foobar;",
+    "myArray[1+1]",
+    "a[1:3]",
+    "(a[1:3])",
+    "a[:2]",
+    "(a[:2])",
+    "a[2:]",
+    "(a[2:])",
+    "a[:]",
+    "(a[:])",
+    "a[::2]",
+    "(a[::2])",
+    "a[1:-1:2]",
+    "(a[1:(-1):2])",
+    "a[::-1][0]",
+    "((a[::(-1)])[0])",
+    "a[i + 1:len(a)]",
+    "(a[(i + 1):len(a)])",
+    "5;",
+    "!5;",
+    "-15;",
+    "!true;",
+    "!false;",
+    "5 + 5;",
+    "5 - 5;",
+    "5 * 5;",
+    "5 / 5;",
+    "5 > 5;",
+    "5 < 5;",
+    "5 == 5;",
+    "5 != 5;",
+    "false == false",
+    "-a * b",
+    "((-a) * b)",
+    "3 > 5 == false",
+    "((3 > 5) == false)",
+    "3 < 5 == true",
+    "((3 < 5) == true)",
+    "!-a",
+    "(!(-a))",
+    "a + b + c",
+    "((a + b) + c)",
+    "a + b - c",
+    "((a + b) - c)",
+    "a * b * c",
+    "((a * b) * c)",
+    "a * b / c",
+    "((a * b) / c)",
+    "a + b / c",
+    "(a + (b / c))",
+    "a | b & c - d",
+    "((a | (b & c)) - d)",
+    "0..n - 1",
+    "(0 .. (n - 1))",
+    "a..=b == c",
+    "((a ..= b) == c)",
+    "a + b * c + d / e - f",
+    "(((a + (b * c)) + (d / e)) - f)",
+    "5 > 4 == 3 < 4",
+    "((5 > 4) == (3 < 4))",
+    "5 < 4 != 3 > 4",
+    "((5 < 4) != (3 > 4))",
+    "3 + 4 * 5 == 3 * 1 + 4 * 5",
+    "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
+    "a + add(b * c) + d",
+    "((a + add((b * c))) + d)",
+    "add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+    "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+    "add(a + b + c * d / f + g)",
+    "add((((a + b) + ((c * d) / f)) + g))",
+    "a * [1, 2, 3, 4][b * c] * d",
+    "((a * ([1,2,3,4][(b * c)])) * d)",
+    "add(a * b[2], b[1], 2 * [1, 2][1])",
+    "add((a * (b[2])), (b[1]), (2 * ([1,2][1])))",
+    "1 + (2 + 3) + 4",
+    "((1 + (2 + 3)) + 4)",
+    "(5 + 5) * 2",
+    "((5 + 5) * 2)",
+    "2 / (5 + 5)",
+    "(2 / (5 + 5))",
+    "-(5 + 5)",
+    "(-(5 + 5))",
+    "!(true == true)",
+    "(!(true == true))",
+    "(f)(1)[0]",
+    "(f(1)[0])",
+    `{"one": 1, "two": 2, "three": 3}`,
+    `{"c": 1, "a": 2, "b": 3, "a": 4}`,
+    "{c:1,a:2,b:3,a:4}",
+    "{}",
+    "{1}",
+    "{1, 2, 3}",
+    "{1, 2,}",
+    `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`,
+    "if (x < y) { x }",
+    "if (x < y) { x } else { y }",
+    `if (x) {
+  y
+  }`,
+    "for (x in 0..10) { puts(x) }",
+    "fn() { yield 1; yield; let inner = fn() { 2 }; }",
+    "fn() { fn() { yield 1; } }",
+    "spawn f(1, 2)",
+    "spawn fn() { x }",
+    "spawn fn(a) { a }(1)",
+    "spawn f + 1",
+    "(spawn f + 1)",
+    "fn(x, y) { x + y; }",
+    "let add = fn(x, y) { x + y };",
+    "let add = fn(x, y) { x + y }(1, 2);",
+    "fn(x) { x };",
+    "macro(x, y) { x + y; }",
+    "fn() {};",
+    "fn(x) {};",
+    "fn(x, y, z) {};",
+    "add(1, 2 * 3, 4 + 5);",
+    "let x = 5;",
+    "let y = true;",
+    "let foobar = y;",
+    `let m = import "path/to/mod";`,
+    "path/to/mod",
+    "export let x = 5;",
+    "fn() { let g = fn() { y }; let y = 5; g() }()",
+    `fn() {
+            let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+            let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+            even(10)
+        }()`,
+    "fn() { let x = 1; let f = fn() { x }; let x = 2; f() }()",
+    "fn(x) { let f = fn() { x }; let x = 5; f() }(1)",
+    "let f = fn() { let x = x; x }; let x = 1; f()",
+    "let n = 5; let f = fn() { let n = n * 2; n }; f()",
+    "fn() { let n = 3; fn() { let n = n * 2; n }() }()",
+    "fn() { let n = 3; fn() { fn() { let n = n + 1; n }() }() }()",
+    "fn() { let len = len([1, 2]); len }()",
+    "fn() { let f = fn() { len }; let len = 1; f() }()",
+    "fn() { let f = fn() { z }; f() }()",
+    "fn() { let fs = []; for (i in 0..3) { let fs = push(fs, fn() { i }) }; map(fs, fn(f) { f() }) }()",
+    "let counter = fn() { let n = 0; let next = fn() { n + 1 }; let n = next(); let n = next(); n }; counter()",
+    "let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)",
+    "let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d } }; newAdder(1, 2)(8)",
+    `
+        let newAdderOuter = fn(a, b) {
+            let c = a + b;
+            fn(d) {
+                let e = d + c;
+                fn(f) { e + f; };
+            };
+        };
+        let newAdderInner = newAdderOuter(1, 2);
+        let adder = newAdderInner(3);
+        adder(8);`,
+    "let a = 1; let f = fn(b) { fn(c) { a + b + c } }; f(2)(3)",
+    `
+        let countDown = fn(x) {
+            if (x == 0) { return 0; }
+            countDown(x - 1);
+        };
+        countDown(1);`,
+    `
+        let wrapper = fn() {
+            let countDown = fn(x) {
+                if (x == 0) { return 0; }
+                countDown(x - 1);
+            };
+            countDown(10);
+        };
+        wrapper();`,
+    `
+        let fib = fn(n) {
+            if (n < 2) { return n; }
+            fib(n - 1) + fib(n - 2)
+        };
+        fib(15);`,
+    "let total = fn(xs) { let t = 0; for (x in xs) { let t = t + x }; t }; total(1..=10)",
+    "let xs = map([1, 2, 3], fn(x) { x * 10 }); reduce(xs, fn(acc, x) { acc + x }, 0)",
+    "let f = fn(a) { a }; f(1, 2, 3)",
+    "let f = fn(x) { x }; len(map([1, 2], f)) + f(3)",
+    "fn(a, b) { a }(1)",
+    "1(2)",
+    "let f = fn() { if (false) { let x = 1; }; x }; f()",
+    "map([1, 2], fn(x) { x / 0 })",
+    "map([1], fn(x) { x + true })",
+    `import "foo"`,
+    "let g = fn() { yield 1 }",
+    "spawn f()",
+    `{trace("b"): trace(1), trace("a"): trace(2)}["a"]`,
+    "b 1 a 2",
+    "let x = 40;",
+    "let f = fn() { x + 2 };",
+    "f()",
+    `
+let fib = fn(n) {
+    if (n < 2) { return n; }
+    fib(n - 1) + fib(n - 2)
+};
+fib(25);`,
+    `let f = fn(x) {
+  x / 0
+};
+f(1)`,
+    `let add = fn(a, b) { a + b };
+add(1, 2)`,
+    "let r = reduce(xs, fn(acc, x) { let y = x * 2; acc + y }, 0);",
+    "let r = map(xs, fn(x) { let y = x * 2; y });",
+}
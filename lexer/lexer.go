@@ -1,5 +1,9 @@
 package lexer
-import "necronet.info/interpreter/token"
+import (
+	"strings"
+
+	"necronet.info/interpreter/token"
+)
 
 
 type Lexer struct {
@@ -7,16 +11,26 @@ type Lexer struct {
 	position	int
 	readPosition	int
 	ch	byte
-
+	// line and column locate ch in the input.
+	line	int
+	column	int
+	// comments are the comments skipped so far.
+	comments	[]token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -27,10 +41,19 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
+// NextToken returns the next token, marked with the position it starts
+// at.
 func (l *Lexer) NextToken() token.Token {
+	l.skipWhitespace()
+	pos := token.Position{Line: l.line, Column: l.column}
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 
 	var tok token.Token
-	l.skipWhitespace()
 
 	switch l.ch {
 		case '=':
@@ -70,6 +93,22 @@ func (l *Lexer) NextToken() token.Token {
 		    tok = newToken(token.LT, l.ch) 
 		case '>':
 		    tok = newToken(token.GT, l.ch) 
+        case '|':
+            tok = newToken(token.PIPE, l.ch)
+        case '&':
+            tok = newToken(token.AMPERSAND, l.ch)
+        case '.':
+            if l.peekChar() == '.' {
+                l.readChar()
+                if l.peekChar() == '=' {
+                    l.readChar()
+                    tok = token.Token{Type: token.DOTDOT_EQ, Literal: "..="}
+                } else {
+                    tok = token.Token{Type: token.DOTDOT, Literal: ".."}
+                }
+            } else {
+                tok = newToken(token.ILLEGAL, l.ch)
+            }
 		case '{':
 			tok = newToken(token.LBRACE, l.ch)
 		case '}':
@@ -144,10 +183,35 @@ func (l *Lexer) readIdentifier() string {
 		return l.input[position:l.position]
 	}
 
+// skipWhitespace skips whitespace and comments, which run from // to the
+// end of the line.
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	pos := token.Position{Line: l.line, Column: l.column}
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	literal := strings.TrimRight(l.input[position:l.position], " \t\r")
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Pos: pos})
+}
+
+// Comments returns the comments skipped so far, in source order, as
+// COMMENT tokens holding the whole comment.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 func isLetter(ch byte) bool {
@@ -29,6 +29,9 @@ func TestNextToken(t *testing.T) {
      "foo bar"
      [1, 2];
      {"foo" : "bar"}
+     a | b & c
+     0..5 0..=5 .
+     for (x in xs)
 	`
 
 	tests := []struct {
@@ -126,6 +129,24 @@ func TestNextToken(t *testing.T) {
         {token.COLON, ":" },
         {token.STRING, "bar" },
         {token.RBRACE, "}" },
+        {token.IDENT, "a" },
+        {token.PIPE, "|" },
+        {token.IDENT, "b" },
+        {token.AMPERSAND, "&" },
+        {token.IDENT, "c" },
+        {token.INT, "0" },
+        {token.DOTDOT, ".." },
+        {token.INT, "5" },
+        {token.INT, "0" },
+        {token.DOTDOT_EQ, "..=" },
+        {token.INT, "5" },
+        {token.ILLEGAL, "." },
+        {token.FOR, "for" },
+        {token.LPAREN, "(" },
+        {token.IDENT, "x" },
+        {token.IN, "in" },
+        {token.IDENT, "xs" },
+        {token.RPAREN, ")" },
         {token.EOF, ""},
     }
 
@@ -145,3 +166,63 @@ for i, tt := range tests {
 	}
 }
 }
+
+func TestTokenPositions(t *testing.T) {
+    input := "let x = 5;\n  x + \"a b\"\n\n1..=2"
+
+    tests := []struct {
+        expectedLiteral string
+        expectedPos token.Position
+    }{
+        {"let", token.Position{Line: 1, Column: 1}},
+        {"x", token.Position{Line: 1, Column: 5}},
+        {"=", token.Position{Line: 1, Column: 7}},
+        {"5", token.Position{Line: 1, Column: 9}},
+        {";", token.Position{Line: 1, Column: 10}},
+        {"x", token.Position{Line: 2, Column: 3}},
+        {"+", token.Position{Line: 2, Column: 5}},
+        {"a b", token.Position{Line: 2, Column: 7}},
+        {"1", token.Position{Line: 4, Column: 1}},
+        {"..=", token.Position{Line: 4, Column: 2}},
+        {"2", token.Position{Line: 4, Column: 5}},
+        {"", token.Position{Line: 4, Column: 6}},
+    }
+
+    l := New(input)
+    for i, tt := range tests {
+        tok := l.NextToken()
+        if tok.Literal != tt.expectedLiteral {
+            t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+        }
+        if tok.Pos != tt.expectedPos {
+            t.Errorf("test[%d] - position of %q wrong. expected=%s, got=%s", i, tok.Literal, tt.expectedPos, tok.Pos)
+        }
+    }
+}
+
+func TestComments(t *testing.T) {
+    input := "// header\nlet x = 1 / 2; // half  \n\"a // b\"//end"
+
+    expectedTokens := []string{"let", "x", "=", "1", "/", "2", ";", "a // b", ""}
+    l := New(input)
+    for i, expected := range expectedTokens {
+        if tok := l.NextToken(); tok.Literal != expected {
+            t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expected, tok.Literal)
+        }
+    }
+
+    expected := []token.Token{
+        {Type: token.COMMENT, Literal: "// header", Pos: token.Position{Line: 1, Column: 1}},
+        {Type: token.COMMENT, Literal: "// half", Pos: token.Position{Line: 2, Column: 16}},
+        {Type: token.COMMENT, Literal: "//end", Pos: token.Position{Line: 3, Column: 9}},
+    }
+    comments := l.Comments()
+    if len(comments) != len(expected) {
+        t.Fatalf("wrong number of comments. expected=%d, got=%d (%v)", len(expected), len(comments), comments)
+    }
+    for i, c := range comments {
+        if c != expected[i] {
+            t.Errorf("comment[%d] wrong. expected=%+v, got=%+v", i, expected[i], c)
+        }
+    }
+}
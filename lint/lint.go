@@ -0,0 +1,454 @@
+// Package lint reports code that is likely to be a mistake, like variables
+// that are never used or comparisons whose result is known in advance.
+package lint
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/evaluator"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/token"
+)
+
+// The IDs of the rules.
+const (
+    UnusedLet          = "unused-let"
+    UnusedParam        = "unused-param"
+    ShadowedBuiltin    = "shadowed-builtin"
+    UnreachableCode    = "unreachable-code"
+    DuplicateKey       = "duplicate-key"
+    ArgumentCount      = "argument-count"
+    ConstantComparison = "constant-comparison"
+)
+
+// Rule describes one kind of problem the linter reports.
+type Rule struct {
+    ID          string
+    Description string
+}
+
+// Rules lists every rule. They all run unless they are disabled.
+var Rules = []Rule{
+    {UnusedLet, "let bindings that are never used"},
+    {UnusedParam, "parameters of functions and macros that are never used"},
+    {ShadowedBuiltin, "variables named like a builtin, which hide it"},
+    {UnreachableCode, "statements after a return"},
+    {DuplicateKey, "keys given more than once in a hash literal"},
+    {ArgumentCount, "calls to a function or macro declared by a let with the wrong number of arguments"},
+    {ConstantComparison, "comparisons that are always true or always false"},
+}
+
+// Diagnostic is a problem found by a rule.
+type Diagnostic struct {
+    Pos     token.Position
+    Rule    string
+    Message string
+}
+
+func (d Diagnostic) String() string {
+    return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Linter checks programs with a set of rules.
+type Linter struct {
+    disabled map[string]bool
+    builtin  func(name string) bool
+}
+
+// New returns a linter that runs every rule and knows the builtins of a
+// standard interpreter.
+func New() *Linter {
+    standard := evaluator.New()
+    return &Linter{
+        disabled: map[string]bool{},
+        builtin: func(name string) bool {
+            _, ok := standard.Builtin(name)
+            return ok
+        },
+    }
+}
+
+// Enable makes the rule with the given ID run.
+func (l *Linter) Enable(id string) error {
+    return l.setDisabled(id, false)
+}
+
+// Disable stops the rule with the given ID from running.
+func (l *Linter) Disable(id string) error {
+    return l.setDisabled(id, true)
+}
+
+func (l *Linter) setDisabled(id string, disabled bool) error {
+    for _, rule := range Rules {
+        if rule.ID == id {
+            l.disabled[id] = disabled
+            return nil
+        }
+    }
+    ids := make([]string, len(Rules))
+    for i, rule := range Rules {
+        ids[i] = rule.ID
+    }
+    return fmt.Errorf("unknown rule %q, the rules are %s", id, strings.Join(ids, ", "))
+}
+
+// Lint checks program, as parsed and before its macros are expanded, and
+// returns the problems found, sorted by position.
+//
+// Variables are scoped like the resolver scopes them: a let anywhere in a
+// function declares a variable of the whole function. Variables whose
+// name starts with an underscore, loop variables and exported lets are
+// never reported as unused.
+func (l *Linter) Lint(program *ast.Program) []Diagnostic {
+    c := &checker{
+        linter:       l,
+        scope:        &scope{vars: map[string]*variable{}},
+        declarations: map[*ast.Identifier]bool{},
+        targets:      map[*ast.Identifier]*variable{},
+    }
+    ast.Inspect(program, c.visit)
+    c.checkCalls()
+
+    sort.SliceStable(c.diagnostics, func(i, j int) bool {
+        return c.diagnostics[i].Pos.Before(c.diagnostics[j].Pos)
+    })
+    return c.diagnostics
+}
+
+type kind int
+
+const (
+    letKind kind = iota
+    paramKind
+    loopKind
+)
+
+// declaration is one of the identifiers declaring a variable, with the
+// value of the let it comes from.
+type declaration struct {
+    ident    *ast.Identifier
+    kind     kind
+    value    ast.Expression
+    exported bool
+}
+
+type variable struct {
+    decls []declaration
+    used  bool
+}
+
+// scope is the scope of a function, or of the program at the outermost
+// level. Like in the resolver, references are only resolved once the
+// whole scope has been seen.
+type scope struct {
+    outer *scope
+    vars  map[string]*variable
+    names []string
+    refs  []*ast.Identifier
+}
+
+type checker struct {
+    linter *Linter
+    scope  *scope
+    // stack holds the nodes whose children are being visited.
+    stack []ast.Node
+    // declarations holds the identifiers that declare a variable rather
+    // than refer to one.
+    declarations map[*ast.Identifier]bool
+    // targets maps the identifiers referring to a variable of the program
+    // to it.
+    targets     map[*ast.Identifier]*variable
+    exported    *ast.LetStatement
+    calls       []*ast.CallExpression
+    diagnostics []Diagnostic
+}
+
+func (c *checker) report(pos token.Position, rule, format string, args ...interface{}) {
+    if c.linter.disabled[rule] {
+        return
+    }
+    c.diagnostics = append(c.diagnostics, Diagnostic{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) visit(node ast.Node) bool {
+    if node == nil {
+        done := c.stack[len(c.stack)-1]
+        c.stack = c.stack[:len(c.stack)-1]
+        switch done.(type) {
+        case *ast.Program, *ast.FunctionLiteral, *ast.MacroLiteral:
+            c.closeScope()
+        }
+        return false
+    }
+
+    switch node := node.(type) {
+    case *ast.Program:
+        c.unreachable(node.Statements)
+    case *ast.BlockStatement:
+        c.unreachable(node.Statements)
+    case *ast.ExportStatement:
+        c.exported = node.Statement
+    case *ast.LetStatement:
+        c.declare(declaration{ident: node.Name, kind: letKind, value: node.Value, exported: node == c.exported})
+    case *ast.ForExpression:
+        c.declare(declaration{ident: node.Variable, kind: loopKind})
+    case *ast.FunctionLiteral:
+        c.openScope(node.Parameters)
+    case *ast.MacroLiteral:
+        c.openScope(node.Parameters)
+    case *ast.Identifier:
+        if !c.declarations[node] {
+            c.scope.refs = append(c.scope.refs, node)
+        }
+    case *ast.CallExpression:
+        if node.Calls("quote") {
+            c.quoted(node.Arguments)
+            return false
+        }
+        c.calls = append(c.calls, node)
+    case *ast.HashLiteral:
+        c.duplicateKeys(node)
+    case *ast.InfixExpression:
+        c.comparison(node)
+    }
+    c.stack = append(c.stack, node)
+    return true
+}
+
+// quoted visits the code quoted by a call to quote. Only the arguments of
+// the calls to unquote in it are evaluated, so only they are checked.
+func (c *checker) quoted(arguments []ast.Expression) {
+    for _, argument := range arguments {
+        ast.Inspect(argument, func(node ast.Node) bool {
+            call, ok := node.(*ast.CallExpression)
+            if ok && call.Calls("unquote") {
+                for _, e := range call.Arguments {
+                    ast.Inspect(e, c.visit)
+                }
+                return false
+            }
+            return true
+        })
+    }
+}
+
+func (c *checker) declare(d declaration) {
+    if d.ident == nil {
+        return
+    }
+    c.declarations[d.ident] = true
+    if c.linter.builtin(d.ident.Value) {
+        c.report(d.ident.Pos(), ShadowedBuiltin, "%s shadows the builtin of the same name", d.ident.Value)
+    }
+
+    s := c.scope
+    v, ok := s.vars[d.ident.Value]
+    if !ok {
+        v = &variable{}
+        s.vars[d.ident.Value] = v
+        s.names = append(s.names, d.ident.Value)
+    }
+    v.decls = append(v.decls, d)
+}
+
+func (c *checker) openScope(params []*ast.Identifier) {
+    c.scope = &scope{outer: c.scope, vars: map[string]*variable{}}
+    for _, param := range params {
+        c.declare(declaration{ident: param, kind: paramKind})
+    }
+}
+
+// closeScope resolves the references of the current scope, hands those
+// it does not declare to the enclosing scope, and reports the variables
+// that are never used.
+func (c *checker) closeScope() {
+    s := c.scope
+    for _, ref := range s.refs {
+        if v, ok := s.vars[ref.Value]; ok {
+            v.used = true
+            c.targets[ref] = v
+        } else if s.outer != nil {
+            s.outer.refs = append(s.outer.refs, ref)
+        }
+    }
+
+    for _, name := range s.names {
+        v := s.vars[name]
+        if v.used || strings.HasPrefix(name, "_") || v.exported() {
+            continue
+        }
+        for _, d := range v.decls {
+            switch d.kind {
+            case letKind:
+                c.report(d.ident.Pos(), UnusedLet, "%s is declared but never used", name)
+            case paramKind:
+                c.report(d.ident.Pos(), UnusedParam, "parameter %s is never used", name)
+            }
+        }
+    }
+    c.scope = s.outer
+}
+
+func (v *variable) exported() bool {
+    for _, d := range v.decls {
+        if d.exported {
+            return true
+        }
+    }
+    return false
+}
+
+// unreachable reports the first statement after a return.
+func (c *checker) unreachable(statements []ast.Statement) {
+    for i := 0; i+1 < len(statements); i++ {
+        if _, ok := statements[i].(*ast.ReturnStatement); ok {
+            c.report(statements[i+1].Pos(), UnreachableCode, "unreachable code after return")
+            return
+        }
+    }
+}
+
+// duplicateKeys reports the keys of a hash literal that evaluate to a
+// constant given by an earlier key.
+func (c *checker) duplicateKeys(hl *ast.HashLiteral) {
+    seen := object.NewHash()
+    for _, pair := range hl.Pairs {
+        obj, ok := constant(pair.Key)
+        if !ok {
+            continue
+        }
+        key, ok := obj.(object.Hashable)
+        if !ok {
+            continue
+        }
+        if _, ok := seen.Get(key); ok {
+            c.report(pair.Key.Pos(), DuplicateKey, "duplicate key %s in hash literal", describe(key))
+            continue
+        }
+        seen.Set(key, evaluator.TRUE)
+    }
+}
+
+func describe(obj object.Object) string {
+    if s, ok := obj.(*object.String); ok {
+        return fmt.Sprintf("%q", s.Value)
+    }
+    return obj.Inspect()
+}
+
+var comparisons = map[string]bool{"==": true, "!=": true, "<": true, ">": true}
+
+// comparison reports comparisons of two constants, and of an expression
+// with itself.
+func (c *checker) comparison(ie *ast.InfixExpression) {
+    if !comparisons[ie.Operator] {
+        return
+    }
+    left, leftOk := constant(ie.Left)
+    right, rightOk := constant(ie.Right)
+    if leftOk && rightOk {
+        if result, ok := evaluator.Infix(ie.Operator, left, right).(*object.Boolean); ok {
+            c.report(ie.Pos(), ConstantComparison, "comparison is always %t", result.Value)
+        }
+        return
+    }
+    if pure(ie.Left) && pure(ie.Right) && ie.Left.String() == ie.Right.String() {
+        c.report(ie.Pos(), ConstantComparison, "comparison of an expression with itself is always %t", ie.Operator == "==")
+    }
+}
+
+// constant evaluates expressions made of literals and operators, failing
+// for anything else and for operations that fail.
+func constant(e ast.Expression) (object.Object, bool) {
+    var obj object.Object
+    switch e := e.(type) {
+    case *ast.IntegerLiteral:
+        return &object.Integer{Value: e.Value}, true
+    case *ast.StringLiteral:
+        return &object.String{Value: e.Value}, true
+    case *ast.Boolean:
+        if e.Value {
+            return evaluator.TRUE, true
+        }
+        return evaluator.FALSE, true
+    case *ast.PrefixExpression:
+        right, ok := constant(e.Right)
+        if !ok {
+            return nil, false
+        }
+        obj = evaluator.Prefix(e.Operator, right)
+    case *ast.InfixExpression:
+        left, ok := constant(e.Left)
+        if !ok {
+            return nil, false
+        }
+        right, ok := constant(e.Right)
+        if !ok {
+            return nil, false
+        }
+        obj = evaluator.Infix(e.Operator, left, right)
+    default:
+        return nil, false
+    }
+    if _, failed := obj.(*object.Error); failed {
+        return nil, false
+    }
+    return obj, true
+}
+
+// pure reports whether evaluating e twice gives equal values: it has no
+// calls, and builds no function or collection, whose copies would differ.
+func pure(e ast.Expression) bool {
+    switch e := e.(type) {
+    case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+        return true
+    case *ast.PrefixExpression:
+        return pure(e.Right)
+    case *ast.InfixExpression:
+        return pure(e.Left) && pure(e.Right)
+    case *ast.IndexExpression:
+        return pure(e.Left) && pure(e.Index)
+    }
+    return false
+}
+
+// checkCalls reports the calls to a variable declared once, by a let of a
+// function or macro literal, with the wrong number of arguments. Missing
+// arguments are an error, while extra ones are ignored by functions but
+// are an error for macros.
+func (c *checker) checkCalls() {
+    for _, call := range c.calls {
+        ident, ok := call.Function.(*ast.Identifier)
+        if !ok {
+            continue
+        }
+        v := c.targets[ident]
+        if v == nil || len(v.decls) != 1 || v.decls[0].kind != letKind {
+            continue
+        }
+        got := len(call.Arguments)
+        switch fn := v.decls[0].value.(type) {
+        case *ast.FunctionLiteral:
+            want := len(fn.Parameters)
+            if got < want {
+                c.report(ident.Pos(), ArgumentCount, "%s takes %s but is given %d", ident.Value, arguments(want), got)
+            } else if got > want {
+                c.report(ident.Pos(), ArgumentCount, "%s takes %s but is given %d, the extra ones are ignored", ident.Value, arguments(want), got)
+            }
+        case *ast.MacroLiteral:
+            if want := len(fn.Parameters); got != want {
+                c.report(ident.Pos(), ArgumentCount, "macro %s takes %s but is given %d", ident.Value, arguments(want), got)
+            }
+        }
+    }
+}
+
+func arguments(n int) string {
+    if n == 1 {
+        return "1 argument"
+    }
+    return fmt.Sprintf("%d arguments", n)
+}
@@ -0,0 +1,109 @@
+package lint
+
+import (
+    "strings"
+    "testing"
+
+    "necronet.info/interpreter/internal/monkeytest"
+)
+
+func lint(t *testing.T, l *Linter, input string) []string {
+    var got []string
+    for _, d := range l.Lint(monkeytest.MustParse(t, input)) {
+        got = append(got, d.String())
+    }
+    return got
+}
+
+func TestLint(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected []string
+    }{
+        {"let a = 1; puts(a);", nil},
+
+        // unused-let and unused-param
+        {"let a = 1;", []string{"1:5: a is declared but never used (unused-let)"}},
+        {"let f = fn(x, y) { x }; f(1, 2);", []string{"1:15: parameter y is never used (unused-param)"}},
+        {"let f = fn() { let a = 1; 2 }; f();", []string{"1:20: a is declared but never used (unused-let)"}},
+        {"let _a = 1; let f = fn(_x) { 1 }; f(1);", nil},
+        {"export let a = 1;", nil},
+        {"for (x in [1]) { puts(1) }", nil},
+        {"let f = fn() { g() }; let g = fn() { 1 }; f();", nil},
+        {"let a = 1; let f = fn() { a }; f();", nil},
+        {"let a = 1; let a = a + 1; puts(a);", nil},
+        {"let f = fn(x) { fn() { x } }; f(1);", nil},
+        {"let f = fn(x) { if (true) { let y = x; } 1 }; f(1);", []string{"1:33: y is declared but never used (unused-let)"}},
+        {"let m = macro(x) { quote(unquote(x) + 1) }; m(1);", nil},
+        {"let m = macro(x, y) { quote(unquote(y)) }; m(1, 2);", []string{"1:15: parameter x is never used (unused-param)"}},
+
+        // shadowed-builtin
+        {"let len = fn(x) { x }; len(1);", []string{"1:5: len shadows the builtin of the same name (shadowed-builtin)"}},
+        {"let f = fn(puts) { puts }; f(1);", []string{"1:12: puts shadows the builtin of the same name (shadowed-builtin)"}},
+        {"for (first in [1]) { first }", []string{"1:6: first shadows the builtin of the same name (shadowed-builtin)"}},
+
+        // unreachable-code
+        {"let f = fn() { return 1; puts(2); puts(3) }; f();", []string{"1:26: unreachable code after return (unreachable-code)"}},
+        {"return 1; puts(2);", []string{"1:11: unreachable code after return (unreachable-code)"}},
+        {"let f = fn(x) { if (x) { return 1 } 2 }; f(1);", nil},
+
+        // duplicate-key
+        {`puts({"a": 1, "b": 2, "a": 3});`, []string{`1:23: duplicate key "a" in hash literal (duplicate-key)`}},
+        {`puts({1: 1, 2 - 1: 2, true: 3, true: 4});`, []string{
+            "1:15: duplicate key 1 in hash literal (duplicate-key)",
+            "1:32: duplicate key true in hash literal (duplicate-key)",
+        }},
+        {`let a = 1; let b = 1; puts({a: 1, b: 2, "1": 3});`, nil},
+
+        // argument-count
+        {"let f = fn(x, y) { x + y }; f(1);", []string{"1:29: f takes 2 arguments but is given 1 (argument-count)"}},
+        {"let f = fn(x) { x }; f(1, 2);", []string{"1:22: f takes 1 argument but is given 2, the extra ones are ignored (argument-count)"}},
+        {"let f = fn(x) { x }; let g = fn(f) { f() }; g(f);", nil},
+        {"let f = fn(x) { x }; let f = fn() { 1 }; f();", nil},
+        {"let m = macro(x) { x }; m(1, 2);", []string{"1:25: macro m takes 1 argument but is given 2 (argument-count)"}},
+        {"let f = fn(x) { x }; f(1); puts(quote(f()));", nil},
+
+        // constant-comparison
+        {"puts(1 < 2);", []string{"1:8: comparison is always true (constant-comparison)"}},
+        {`puts(1 == "1", 2 * 3 != 6);`, []string{
+            "1:8: comparison is always false (constant-comparison)",
+            "1:22: comparison is always false (constant-comparison)",
+        }},
+        {"let a = [1]; puts(a[0] == a[0], a != a);", []string{
+            "1:24: comparison of an expression with itself is always true (constant-comparison)",
+            "1:35: comparison of an expression with itself is always false (constant-comparison)",
+        }},
+        {"let f = fn() { 1 }; puts(f() == f(), fn() { 1 } == fn() { 1 }, 1 / 0 == 1);", nil},
+    }
+
+    for _, tt := range tests {
+        got := lint(t, New(), tt.input)
+        if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+            t.Errorf("%q:\n got %q\nwant %q", tt.input, got, tt.expected)
+        }
+    }
+}
+
+func TestEnableDisable(t *testing.T) {
+    input := "let a = 1 == 1;"
+    l := New()
+    if err := l.Disable(UnusedLet); err != nil {
+        t.Fatal(err)
+    }
+    got := lint(t, l, input)
+    if len(got) != 1 || !strings.HasSuffix(got[0], "(constant-comparison)") {
+        t.Errorf("unused-let disabled: got %q", got)
+    }
+
+    if err := l.Enable(UnusedLet); err != nil {
+        t.Fatal(err)
+    }
+    if got := lint(t, l, input); len(got) != 2 {
+        t.Errorf("unused-let enabled again: got %q", got)
+    }
+
+    err := l.Disable("unused")
+    if err == nil || !strings.HasPrefix(err.Error(), `unknown rule "unused", the rules are unused-let, unused-param,`) {
+        t.Errorf("wrong error. got=%v", err)
+    }
+}
@@ -6,7 +6,26 @@ import("fmt"
 	"necronet.info/interpreter/repl"
 )
 
+const usage = `usage:
+  monkey                              start the REPL
+  monkey compile [-O] FILE [-o OUT]   compile FILE to bytecode, OUT defaults to FILE with a .mkc extension
+  monkey run [-O] [-trace] FILE       run a script or a compiled .mkc file, -trace runs it on
+                                      the VM and logs every instruction to stderr
+  monkey disasm [-O] FILE             list the bytecode of a script or a compiled .mkc file
+  monkey fmt [-w] [--check] FILE...   print the scripts formatted, -w rewrites them instead and
+                                      --check lists those that are not formatted
+  monkey lint [-enable IDS] [-disable IDS] FILE...
+                                      report likely mistakes in the scripts, -enable runs only
+                                      the comma-separated rules IDS and -disable skips them
+
+-O folds constant expressions and drops unreachable code before a script runs.
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	user, err := user.Current()
 
 	if err != nil {
@@ -18,3 +37,31 @@ func main() {
 	repl.Start(os.Stdin, os.Stdout)
 
 }
+
+// runCommand runs a subcommand and returns the exit status.
+func runCommand(name string, args []string) int {
+	var err error
+	switch name {
+	case "compile":
+		err = compileCommand(args)
+	case "run":
+		err = runFileCommand(args)
+	case "disasm":
+		err = disasmCommand(args)
+	case "fmt":
+		err = fmtCommand(args)
+	case "lint":
+		err = lintCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		err = fmt.Errorf("unknown command %q\n%s", name, usage)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
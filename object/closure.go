@@ -0,0 +1,62 @@
+package object
+
+import (
+    "fmt"
+
+    "necronet.info/interpreter/code"
+)
+
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+// CompiledFunction is a function literal compiled to bytecode. It lives in
+// the constant pool; at run time it is always wrapped in a Closure.
+type CompiledFunction struct {
+    Instructions code.Instructions
+    NumLocals int
+    NumParameters int
+    Name string
+    // LocalNames names the local slots, so that reading a local before it
+    // is set can be reported by name.
+    LocalNames []string
+    SourceMap code.SourceMap
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+    return fmt.Sprintf("CompiledFunction[%s/%d]", cf.displayName(), cf.NumParameters)
+}
+
+func (cf *CompiledFunction) displayName() string {
+    if cf.Name == "" {
+        return "anonymous"
+    }
+    return cf.Name
+}
+
+// Closure is a compiled function together with the free variables it
+// captured: cells, or the value itself for an enclosing function that
+// refers to itself by name. It has the same type as a Function, so Monkey
+// code cannot tell which engine created it.
+type Closure struct {
+    Fn *CompiledFunction
+    Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+    return fmt.Sprintf("fn %s/%d", c.Fn.displayName(), c.Fn.NumParameters)
+}
+
+const CELL_OBJ = "CELL"
+
+// Cell holds a variable captured by closures. The function declaring the
+// variable and the closures share the cell, so they all see the value it
+// has when they read it, like closures of the evaluator share the frames
+// of their environment. Cells are never Monkey values.
+type Cell struct {
+    Name string
+    Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string { return "cell " + c.Name }
@@ -0,0 +1,106 @@
+package object
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+)
+
+const (
+    CHANNEL_OBJ = "CHANNEL"
+    TASK_OBJ = "TASK"
+)
+
+// ErrClosedChannel is returned when sending on a closed Channel.
+var ErrClosedChannel = errors.New("send on closed channel")
+
+// Channel passes objects between tasks. C is exposed for select; sending
+// on it directly panics once the channel is closed.
+type Channel struct {
+    C chan Object
+    mu sync.Mutex
+    closed bool
+}
+
+// NewChannel returns a channel buffering up to size objects.
+func NewChannel(size int) *Channel {
+    return &Channel{C: make(chan Object, size)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string { return "channel" }
+
+// Send blocks until value is received or buffered, or ctx is done.
+func (c *Channel) Send(ctx context.Context, value Object) (err error) {
+    defer func() {
+        if recover() != nil {
+            err = ErrClosedChannel
+        }
+    }()
+    select {
+    case c.C <- value:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Recv blocks until a value arrives, or ctx is done. It reports false once
+// the channel is closed and drained.
+func (c *Channel) Recv(ctx context.Context) (Object, bool, error) {
+    select {
+    case value, ok := <-c.C:
+        return value, ok, nil
+    case <-ctx.Done():
+        return nil, false, ctx.Err()
+    }
+}
+
+// Close closes the channel and reports whether it was still open.
+func (c *Channel) Close() bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.closed {
+        return false
+    }
+    c.closed = true
+    close(c.C)
+    return true
+}
+
+// Task is the handle of a function running on its own goroutine.
+type Task struct {
+    done chan struct{}
+    result Object
+}
+
+// NewTask starts run on a new goroutine. Should run panic, the task ends
+// with an Error instead of taking the whole program down.
+func NewTask(run func() Object) *Task {
+    t := &Task{done: make(chan struct{})}
+    go func() {
+        defer close(t.done)
+        defer func() {
+            if r := recover(); r != nil {
+                t.result = &Error{Message: fmt.Sprintf("task panicked: %v", r)}
+            }
+        }()
+        t.result = run()
+    }()
+    return t
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string { return "task" }
+
+// Wait blocks until the task has finished and returns its result, or
+// until ctx is done.
+func (t *Task) Wait(ctx context.Context) (Object, error) {
+    select {
+    case <-t.done:
+        return t.result, nil
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
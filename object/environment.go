@@ -1,7 +1,18 @@
 package object
 
+import "sync"
+
+// Environment maps names to values. It is safe for concurrent use, so
+// tasks can share the environments their functions close over.
+//
+// The environment of a function call is a frame: its locals are kept in
+// slots, which code bound by package resolver reads by index instead of
+// by name.
 type Environment struct {
+    mu sync.RWMutex
     store map[string]Object
+    names []string
+    slots []Object
     outer *Environment
 }
 
@@ -16,8 +27,25 @@ func NewEnvironment() *Environment {
      return &Environment {store: s, outer: nil }
 }
 
+// NewFrame returns the environment of a call to a function whose locals
+// are named by names, enclosed by outer.
+func NewFrame(outer *Environment, names []string) *Environment {
+    return &Environment{names: names, slots: make([]Object, len(names)), outer: outer}
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
+    e.mu.RLock()
     obj, ok := e.store[name]
+    if !ok {
+        for i, n := range e.names {
+            if n == name {
+                obj = e.slots[i]
+                ok = obj != nil
+                break
+            }
+        }
+    }
+    e.mu.RUnlock()
 
     if !ok && e.outer != nil {
         obj, ok = e.outer.Get(name)
@@ -26,6 +54,37 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    for i, n := range e.names {
+        if n == name {
+            e.slots[i] = val
+            return val
+        }
+    }
+    if e.store == nil {
+        e.store = make(map[string]Object)
+    }
     e.store[name] = val
     return val
 }
+
+// Local returns the value in slot of the frame depth environments out,
+// or nil when it has not been set.
+func (e *Environment) Local(depth, slot int) Object {
+    for ; depth > 0; depth-- {
+        e = e.outer
+    }
+    e.mu.RLock()
+    obj := e.slots[slot]
+    e.mu.RUnlock()
+    return obj
+}
+
+// SetLocal sets slot of the frame.
+func (e *Environment) SetLocal(slot int, val Object) Object {
+    e.mu.Lock()
+    e.slots[slot] = val
+    e.mu.Unlock()
+    return val
+}
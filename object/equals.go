@@ -0,0 +1,73 @@
+package object
+
+// Equals reports whether two objects are structurally equal. Integers,
+// strings and booleans compare by value, arrays element by element and
+// hashes by having the same keys mapped to equal values, regardless of
+// insertion order. Sets are equal when they have the same members,
+// ranges when they yield the same integers and quotes when they quote the
+// same code. Any other objects are equal only to themselves.
+func Equals(a, b Object) bool {
+    if a == b {
+        return true
+    }
+    switch a := a.(type) {
+    case *Integer:
+        b, ok := b.(*Integer)
+        return ok && a.Value == b.Value
+    case *String:
+        b, ok := b.(*String)
+        return ok && a.Value == b.Value
+    case *Boolean:
+        b, ok := b.(*Boolean)
+        return ok && a.Value == b.Value
+    case *Null:
+        _, ok := b.(*Null)
+        return ok
+    case *Array:
+        b, ok := b.(*Array)
+        if !ok || len(a.Elements) != len(b.Elements) {
+            return false
+        }
+        for i := range a.Elements {
+            if !Equals(a.Elements[i], b.Elements[i]) {
+                return false
+            }
+        }
+        return true
+    case *Hash:
+        b, ok := b.(*Hash)
+        if !ok || a.Len() != b.Len() {
+            return false
+        }
+        for _, pair := range a.Pairs() {
+            value, ok := b.Get(pair.Key.(Hashable))
+            if !ok || !Equals(pair.Value, value) {
+                return false
+            }
+        }
+        return true
+    case *Set:
+        b, ok := b.(*Set)
+        if !ok || a.Len() != b.Len() {
+            return false
+        }
+        for _, member := range a.Members() {
+            if !b.Has(member.(Hashable)) {
+                return false
+            }
+        }
+        return true
+    case *Range:
+        b, ok := b.(*Range)
+        if !ok {
+            return false
+        }
+        aLast, aOk := a.last()
+        bLast, bOk := b.last()
+        return aOk == bOk && (!aOk || a.Start == b.Start && aLast == bLast)
+    case *Quote:
+        b, ok := b.(*Quote)
+        return ok && a.Node.String() == b.Node.String()
+    }
+    return false
+}
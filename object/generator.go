@@ -0,0 +1,135 @@
+package object
+
+import (
+    "context"
+    "runtime"
+    "sync"
+)
+
+const GENERATOR_OBJ = "GENERATOR"
+
+// YieldFunction hands a value to the consumer of a generator and blocks
+// until the next value is asked for. It returns false when the generator
+// was closed instead, after which the body must stop.
+type YieldFunction func(value Object) bool
+
+// Generator is the lazy sequence returned by calling a generator function.
+// The body runs on its own goroutine, but only while the consumer waits in
+// Next, so the two never run at the same time.
+//
+// A generator that is not exhausted keeps its goroutine until it is
+// closed, its context is done, or it becomes unreachable and is finalized.
+// Generators stored in an environment their own body can see stay
+// reachable, so those must be closed explicitly.
+type Generator struct {
+    state *generatorState
+}
+
+type generatorState struct {
+    ctx context.Context
+    body func(yield YieldFunction) Object
+    started bool
+    finished bool
+    result Object
+    values chan Object
+    resume chan struct{}
+    closed chan struct{}
+    closeOnce sync.Once
+    exited chan struct{}
+}
+
+// NewGenerator returns a generator that runs body on the first call to
+// Next. Whatever body returns ends the generator; an Error is passed on to
+// the consumer as the last value.
+func NewGenerator(ctx context.Context, body func(yield YieldFunction) Object) *Generator {
+    g := &Generator{state: &generatorState{
+        ctx: ctx,
+        body: body,
+        values: make(chan Object),
+        resume: make(chan struct{}),
+        closed: make(chan struct{}),
+        exited: make(chan struct{}),
+    }}
+    runtime.SetFinalizer(g, func(g *Generator) { g.state.close() })
+    return g
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string { return "generator" }
+
+// Iterate returns the generator itself, so it can only be walked once.
+func (g *Generator) Iterate() Iterator { return g }
+
+// Next resumes the body until it yields the next value. Generators are not
+// safe for use by several goroutines at once.
+func (g *Generator) Next() (Object, bool) {
+    s := g.state
+    if s.finished {
+        return nil, false
+    }
+    select {
+    case <-s.closed:
+        s.finished = true
+        return nil, false
+    default:
+    }
+    if !s.started {
+        s.started = true
+        go s.run()
+    } else {
+        select {
+        case s.resume <- struct{}{}:
+        case <-s.exited:
+            return s.finish()
+        }
+    }
+
+    select {
+    case value := <-s.values:
+        return value, true
+    case <-s.exited:
+        return s.finish()
+    }
+}
+
+// Close stops the generator. A body suspended in yield sees it return
+// false. Unlike Next, Close may be called from any goroutine: it only
+// closes a channel, which Next checks before resuming the body.
+func (g *Generator) Close() {
+    g.state.close()
+}
+
+func (s *generatorState) close() {
+    s.closeOnce.Do(func() { close(s.closed) })
+}
+
+func (s *generatorState) run() {
+    s.result = s.body(s.yield)
+    close(s.exited)
+}
+
+func (s *generatorState) finish() (Object, bool) {
+    s.finished = true
+    if s.result != nil && s.result.Type() == ERROR_OBJ {
+        return s.result, true
+    }
+    return nil, false
+}
+
+func (s *generatorState) yield(value Object) bool {
+    select {
+    case s.values <- value:
+    case <-s.closed:
+        return false
+    case <-s.ctx.Done():
+        return false
+    }
+    select {
+    case <-s.resume:
+        return true
+    case <-s.closed:
+        return false
+    case <-s.ctx.Done():
+        return false
+    }
+}
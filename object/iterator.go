@@ -0,0 +1,38 @@
+package object
+
+// Iterator yields the elements of an Iterable one at a time. Next returns
+// false once the elements are exhausted.
+type Iterator interface {
+    Next() (Object, bool)
+}
+
+// Iterable is implemented by objects that for loops and the sequence
+// builtins can walk without knowing their concrete type.
+type Iterable interface {
+    Object
+    Iterate() Iterator
+}
+
+type sliceIterator struct {
+    elements []Object
+    pos int
+}
+
+func (it *sliceIterator) Next() (Object, bool) {
+    if it.pos >= len(it.elements) {
+        return nil, false
+    }
+    el := it.elements[it.pos]
+    it.pos++
+    return el, true
+}
+
+func (ao *Array) Iterate() Iterator {
+    return &sliceIterator{elements: ao.Elements}
+}
+
+// Iterate walks a snapshot of the members, so the set can be changed while
+// it is being iterated.
+func (s *Set) Iterate() Iterator {
+    return &sliceIterator{elements: s.Members()}
+}
@@ -2,9 +2,13 @@ package object
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"hash"
 	"hash/fnv"
 	"strings"
+	"sync"
 
 	"necronet.info/interpreter/ast"
 )
@@ -20,6 +24,7 @@ const (
     BUILTIN_OBJ = "BUILTIN"
     ARRAY_OBJ = "ARRAY"
     HASH_OBJ = "HASH"
+    MODULE_OBJ = "MODULE"
 )
 
 type ObjectType string
@@ -34,16 +39,164 @@ type HashPair struct {
     Value Object
 }
 
+// Hash maps hashable keys to values and remembers the order keys were
+// first inserted in, which is the order it iterates and prints in.
+//
+// Keys are bucketed by their HashKey and compared by value within a
+// bucket, so different keys whose hashes collide do not overwrite each
+// other. A hash is safe for concurrent use, so tasks can share it.
+//
+// Delete leaves a pair with a nil Key behind in pairs, which is dropped
+// once such pairs make up half of them, so that deleting stays cheap.
 type Hash struct {
-    Pairs map[HashKey]HashPair
+    mu sync.RWMutex
+    buckets map[HashKey][]int
+    pairs []HashPair
+    deleted int
+    frozen bool
+}
+
+func NewHash() *Hash {
+    return &Hash{buckets: make(map[HashKey][]int)}
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
+// Len returns the number of pairs in the hash.
+func (h *Hash) Len() int {
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    return len(h.pairs) - h.deleted
+}
+
+// find returns the position in h.pairs of the pair stored under key.
+func (h *Hash) find(key Hashable, hashed HashKey) (int, bool) {
+    for _, i := range h.buckets[hashed] {
+        if Equals(h.pairs[i].Key, key) {
+            return i, true
+        }
+    }
+    return 0, false
+}
+
+// Get returns the value stored under key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    i, ok := h.find(key, key.HashKey())
+    if !ok {
+        return nil, false
+    }
+    return h.pairs[i].Value, true
+}
+
+// Set stores value under key. A key that is already present keeps its
+// position.
+func (h *Hash) Set(key Hashable, value Object) {
+    h.set(key, value, true)
+}
+
+// set stores value under key and reports whether key was missing. A key
+// that is present keeps its value unless replace is set.
+func (h *Hash) set(key Hashable, value Object, replace bool) bool {
+    hashed := key.HashKey()
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if h.buckets == nil {
+        h.buckets = make(map[HashKey][]int)
+    }
+    if i, ok := h.find(key, hashed); ok {
+        if replace {
+            h.pairs[i].Value = value
+        }
+        return false
+    }
+    h.buckets[hashed] = append(h.buckets[hashed], len(h.pairs))
+    h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+    return true
+}
+
+// Delete removes key from the hash and returns the value it had.
+func (h *Hash) Delete(key Hashable) (Object, bool) {
+    hashed := key.HashKey()
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    i, ok := h.find(key, hashed)
+    if !ok {
+        return nil, false
+    }
+    value := h.pairs[i].Value
+    h.pairs[i] = HashPair{}
+    h.deleted++
+
+    bucket := h.buckets[hashed]
+    for j, k := range bucket {
+        if k == i {
+            bucket = append(bucket[:j], bucket[j+1:]...)
+            break
+        }
+    }
+    if len(bucket) == 0 {
+        delete(h.buckets, hashed)
+    } else {
+        h.buckets[hashed] = bucket
+    }
+
+    if h.deleted > len(h.pairs)/2 {
+        h.compact()
+    }
+    return value, true
+}
+
+// compact drops the pairs Delete left behind and renumbers the buckets.
+func (h *Hash) compact() {
+    pairs := make([]HashPair, 0, len(h.pairs)-h.deleted)
+    for _, pair := range h.pairs {
+        if pair.Key != nil {
+            pairs = append(pairs, pair)
+        }
+    }
+    h.pairs = pairs
+    h.deleted = 0
+    h.buckets = make(map[HashKey][]int, len(pairs))
+    for i, pair := range pairs {
+        hashed := pair.Key.(Hashable).HashKey()
+        h.buckets[hashed] = append(h.buckets[hashed], i)
+    }
+}
+
+// Freeze makes the hash immutable, which allows it to be used as a hash
+// key. Set and Delete must not be called on a frozen hash.
+func (h *Hash) Freeze() {
+    h.mu.Lock()
+    h.frozen = true
+    h.mu.Unlock()
+}
+
+// Frozen reports whether the hash has been frozen.
+func (h *Hash) Frozen() bool {
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    return h.frozen
+}
+
+// Pairs returns the pairs of the hash in insertion order.
+func (h *Hash) Pairs() []HashPair {
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    pairs := make([]HashPair, 0, len(h.pairs)-h.deleted)
+    for _, pair := range h.pairs {
+        if pair.Key != nil {
+            pairs = append(pairs, pair)
+        }
+    }
+    return pairs
+}
+
 func (h *Hash) Inspect() string {
     var out bytes.Buffer
     pairs := []string{}
-    for _, pair := range h.Pairs {
+    for _, pair := range h.Pairs() {
         pairs = append(pairs, fmt.Sprintf("%s: %s",
         pair.Key.Inspect(), pair.Value.Inspect()))
     }
@@ -54,6 +207,7 @@ func (h *Hash) Inspect() string {
 }
 
 type Hashable interface {
+    Object
     HashKey() HashKey
 }
 
@@ -65,8 +219,23 @@ func (s *String) Inspect() string { return s.Value }
 
 type BuiltinFunction func(args... Object) Object
 
+// CallContext describes the call site of a builtin: the environment the
+// call was evaluated in and the context of the interpreter running it.
+// Apply calls a function object, Monkey or builtin, from within the
+// builtin.
+type CallContext struct {
+    Context context.Context
+    Env *Environment
+    Apply func(fn Object, args ...Object) Object
+}
+
+type ContextBuiltinFunction func(call *CallContext, args... Object) Object
+
+// Builtin wraps a native function. When ContextFn is set it is called
+// instead of Fn and receives the CallContext of the call.
 type Builtin struct {
     Fn BuiltinFunction
+    ContextFn ContextBuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -93,10 +262,39 @@ type Integer struct {
 func (i *Integer) Inspect() string {return fmt.Sprintf("%d", i.Value)}
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ } 
 
+// Integers in [MinCachedInteger, MaxCachedInteger] are allocated once and
+// shared, which is safe as an Integer is never modified.
+const (
+    MinCachedInteger = -128
+    MaxCachedInteger = 1023
+)
+
+var smallIntegers = func() []Integer {
+    integers := make([]Integer, MaxCachedInteger-MinCachedInteger+1)
+    for i := range integers {
+        integers[i].Value = int64(i + MinCachedInteger)
+    }
+    return integers
+}()
+
+// NewInteger returns an Integer holding value, without allocating when
+// value is small.
+func NewInteger(value int64) *Integer {
+    if value >= MinCachedInteger && value <= MaxCachedInteger {
+        return &smallIntegers[value-MinCachedInteger]
+    }
+    return &Integer{Value: value}
+}
+
 type Function struct {
     Parameters []*ast.Identifier
     Body *ast.BlockStatement
     Env *Environment
+    // IsGenerator is set when calling the function returns a Generator
+    // instead of running the body.
+    IsGenerator bool
+    // Locals names the slots of the frame of a call.
+    Locals []string
 }
 
 func (t *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -143,12 +341,88 @@ func (i *Integer) HashKey() HashKey {
     return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
-func (s *String) HashKey() HashKey {
+// hashString digests string keys. It is a variable so tests can force
+// collisions.
+var hashString = func(s string) uint64 {
     h := fnv.New64()
-    h.Write([]byte(s.Value))
-    return HashKey{Type: s.Type(), Value: h.Sum64()}
+    h.Write([]byte(s))
+    return h.Sum64()
+}
+
+func (s *String) HashKey() HashKey {
+    return HashKey{Type: s.Type(), Value: hashString(s.Value)}
+}
+
+// HashKey digests the keys of the elements. Arrays are immutable, so an
+// array is usable as a key as long as all of its elements are, see
+// AsHashable.
+func (ao *Array) HashKey() HashKey {
+    h := fnv.New64a()
+    for _, el := range ao.Elements {
+        writeHashKey(h, elementHashKey(el))
+    }
+    return HashKey{Type: ao.Type(), Value: h.Sum64()}
+}
+
+// HashKey digests the pairs of a frozen hash independently of their order,
+// matching Equals.
+func (h *Hash) HashKey() HashKey {
+    var sum uint64
+    for _, pair := range h.Pairs() {
+        digest := fnv.New64a()
+        writeHashKey(digest, elementHashKey(pair.Key))
+        writeHashKey(digest, elementHashKey(pair.Value))
+        sum += digest.Sum64()
+    }
+    return HashKey{Type: h.Type(), Value: sum}
+}
+
+// elementHashKey returns the hash key of an object held by a container.
+// AsHashable keeps containers holding other objects from being used as
+// keys; should one be hashed anyway, those objects hash by type alone,
+// which still agrees with Equals.
+func elementHashKey(obj Object) HashKey {
+    if key, ok := obj.(Hashable); ok {
+        return key.HashKey()
+    }
+    return HashKey{Type: obj.Type()}
+}
+
+func writeHashKey(h hash.Hash64, key HashKey) {
+    var buf [8]byte
+    h.Write([]byte(key.Type))
+    binary.LittleEndian.PutUint64(buf[:], key.Value)
+    h.Write(buf[:])
 }
 
+// AsHashable returns obj as a Hashable when it can be used as a hash key.
+// Hashes must be frozen and containers may only hold hashable objects.
+func AsHashable(obj Object) (Hashable, error) {
+    key, ok := obj.(Hashable)
+    if !ok {
+        return nil, fmt.Errorf("unusable as hash key: %s", obj.Type())
+    }
+    switch obj := obj.(type) {
+    case *Array:
+        for _, el := range obj.Elements {
+            if _, err := AsHashable(el); err != nil {
+                return nil, err
+            }
+        }
+    case *Hash:
+        if !obj.Frozen() {
+            return nil, fmt.Errorf("unusable as hash key: mutable HASH, freeze it first")
+        }
+        for _, pair := range obj.Pairs() {
+            if _, err := AsHashable(pair.Value); err != nil {
+                return nil, err
+            }
+        }
+    }
+    return key, nil
+}
+
+
 type Null struct {}
 
 func (n *Null) Inspect() string {return "null"}
@@ -177,3 +451,14 @@ func (ao *Array) Inspect() string {
 }
 
 
+
+// Module is the namespace produced by importing a file. Exports maps the
+// names of its public top-level bindings to their values.
+type Module struct {
+    Name string
+    Path string
+    Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string { return fmt.Sprintf("module(%s)", m.Name) }
@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+    "context"
+    "fmt"
+    "math"
+    "testing"
+)
 
 func TestStringHashKey(t *testing.T) {
     hello1 := &String{Value: "Hello World"}
@@ -17,3 +22,462 @@ func TestStringHashKey(t *testing.T) {
         t.Errorf("strings with different content have same hash keys")
     }
 }
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+    hash := NewHash()
+    hash.Set(&String{Value: "c"}, &Integer{Value: 1})
+    hash.Set(&String{Value: "a"}, &Integer{Value: 2})
+    hash.Set(&String{Value: "b"}, &Integer{Value: 3})
+    hash.Set(&String{Value: "a"}, &Integer{Value: 4})
+
+    if hash.Inspect() != "{c: 1, a: 4, b: 3}" {
+        t.Errorf("wrong order after set. got=%q", hash.Inspect())
+    }
+
+    value, ok := hash.Delete(&String{Value: "c"})
+    if !ok || value.Inspect() != "1" {
+        t.Errorf("Delete returned %v, %t", value, ok)
+    }
+    hash.Set(&String{Value: "c"}, &Integer{Value: 5})
+    if hash.Inspect() != "{a: 4, b: 3, c: 5}" {
+        t.Errorf("wrong order after delete. got=%q", hash.Inspect())
+    }
+
+    for _, key := range []string{"a", "b", "c"} {
+        if _, ok := hash.Get(&String{Value: key}); !ok {
+            t.Errorf("key %q missing after delete", key)
+        }
+    }
+    if _, ok := hash.Delete(&String{Value: "missing"}); ok {
+        t.Errorf("Delete of missing key reported success")
+    }
+    if hash.Len() != 3 {
+        t.Errorf("wrong length. got=%d", hash.Len())
+    }
+}
+
+func TestHashDeleteMany(t *testing.T) {
+    hash := NewHash()
+    for i := 0; i < 100; i++ {
+        hash.Set(NewInteger(int64(i)), NewInteger(int64(i)))
+    }
+    // Deleting the even keys drops the pairs left behind along the way.
+    for i := 0; i < 100; i += 2 {
+        if _, ok := hash.Delete(NewInteger(int64(i))); !ok {
+            t.Fatalf("Delete(%d) found nothing", i)
+        }
+    }
+    hash.Set(NewInteger(0), NewInteger(-1))
+
+    if hash.Len() != 51 {
+        t.Errorf("wrong length. got=%d", hash.Len())
+    }
+    pairs := hash.Pairs()
+    for i, pair := range pairs[:50] {
+        if key := pair.Key.(*Integer).Value; key != int64(2*i+1) {
+            t.Fatalf("pairs[%d] has key %d, want %d", i, key, 2*i+1)
+        }
+    }
+    if last := pairs[50]; last.Key.Inspect() != "0" || last.Value.Inspect() != "-1" {
+        t.Errorf("wrong last pair %s: %s", last.Key.Inspect(), last.Value.Inspect())
+    }
+    for i := 0; i < 100; i++ {
+        _, ok := hash.Get(NewInteger(int64(i)))
+        if want := i%2 == 1 || i == 0; ok != want {
+            t.Errorf("Get(%d) found=%t, want %t", i, ok, want)
+        }
+    }
+}
+
+func TestHashHandlesCollisions(t *testing.T) {
+    original := hashString
+    hashString = func(s string) uint64 { return 42 }
+    defer func() { hashString = original }()
+
+    foo := &String{Value: "foo"}
+    bar := &String{Value: "bar"}
+    if foo.HashKey() != bar.HashKey() {
+        t.Fatalf("hash function was not injected")
+    }
+
+    hash := NewHash()
+    hash.Set(foo, &Integer{Value: 1})
+    hash.Set(bar, &Integer{Value: 2})
+    hash.Set(&String{Value: "baz"}, &Integer{Value: 3})
+
+    if hash.Len() != 3 {
+        t.Fatalf("colliding keys overwrote each other. got=%s", hash.Inspect())
+    }
+    tests := map[string]string{"foo": "1", "bar": "2", "baz": "3"}
+    for key, expected := range tests {
+        value, ok := hash.Get(&String{Value: key})
+        if !ok || value.Inspect() != expected {
+            t.Errorf("Get(%q) = %v, %t. want %s", key, value, ok, expected)
+        }
+    }
+    if _, ok := hash.Get(&String{Value: "qux"}); ok {
+        t.Errorf("Get found a key that was never set")
+    }
+
+    hash.Delete(bar)
+    if _, ok := hash.Get(foo); !ok {
+        t.Errorf("deleting a colliding key removed its neighbour")
+    }
+    value, ok := hash.Get(&String{Value: "baz"})
+    if !ok || value.Inspect() != "3" {
+        t.Errorf("Get(baz) after delete = %v, %t", value, ok)
+    }
+    if hash.Inspect() != "{foo: 1, baz: 3}" {
+        t.Errorf("wrong hash after delete. got=%q", hash.Inspect())
+    }
+}
+
+func TestEquals(t *testing.T) {
+    array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+    hash := func(pairs ...Object) *Hash {
+        h := NewHash()
+        for i := 0; i < len(pairs); i += 2 {
+            h.Set(pairs[i].(Hashable), pairs[i+1])
+        }
+        return h
+    }
+    one, two := &Integer{Value: 1}, &Integer{Value: 2}
+    a, b := &String{Value: "a"}, &String{Value: "b"}
+    yes := &Boolean{Value: true}
+    null := &Null{}
+    fn := &Function{}
+    set := func(members ...Hashable) *Set {
+        s := NewSet()
+        for _, member := range members {
+            s.Add(member)
+        }
+        return s
+    }
+
+    tests := []struct {
+        left, right Object
+        expected bool
+    }{
+        {one, &Integer{Value: 1}, true},
+        {one, two, false},
+        {a, &String{Value: "a"}, true},
+        {a, b, false},
+        {one, &String{Value: "1"}, false},
+        {yes, &Boolean{Value: true}, true},
+        {yes, &Boolean{Value: false}, false},
+        {null, &Null{}, true},
+        {null, &Boolean{Value: false}, false},
+        {array(), array(), true},
+        {array(one, a), array(&Integer{Value: 1}, &String{Value: "a"}), true},
+        {array(one, a), array(a, one), false},
+        {array(one), array(one, one), false},
+        {array(array(one), array()), array(array(one), array()), true},
+        {array(array(one)), array(array(two)), false},
+        {hash(), hash(), true},
+        {hash(a, one, b, two), hash(b, two, a, one), true},
+        {hash(a, one), hash(a, two), false},
+        {hash(a, one), hash(b, one), false},
+        {hash(a, one), hash(a, one, b, two), false},
+        {hash(a, array(one)), hash(a, array(one)), true},
+        {array(one), hash(one, one), false},
+        {set(), set(), true},
+        {set(one, a), set(a, &Integer{Value: 1}), true},
+        {set(one), set(one, two), false},
+        {set(one), array(one), false},
+        {set(), hash(), false},
+        {fn, fn, true},
+        {fn, &Function{}, false},
+    }
+
+    for i, tt := range tests {
+        if got := Equals(tt.left, tt.right); got != tt.expected {
+            t.Errorf("tests[%d] Equals(%s, %s) = %t, want %t", i, tt.left.Inspect(), tt.right.Inspect(), got, tt.expected)
+        }
+        if got := Equals(tt.right, tt.left); got != tt.expected {
+            t.Errorf("tests[%d] Equals(%s, %s) = %t, want %t", i, tt.right.Inspect(), tt.left.Inspect(), got, tt.expected)
+        }
+    }
+}
+
+func TestContainerHashKeys(t *testing.T) {
+    array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+    frozen := func(pairs ...Object) *Hash {
+        h := NewHash()
+        for i := 0; i < len(pairs); i += 2 {
+            h.Set(pairs[i].(Hashable), pairs[i+1])
+        }
+        h.Freeze()
+        return h
+    }
+    one, two := &Integer{Value: 1}, &Integer{Value: 2}
+    a, b := &String{Value: "a"}, &String{Value: "b"}
+
+    if array(one, two).HashKey() != array(&Integer{Value: 1}, &Integer{Value: 2}).HashKey() {
+        t.Errorf("arrays with same content have different hash keys")
+    }
+    if array(one, two).HashKey() == array(two, one).HashKey() {
+        t.Errorf("arrays with different order have same hash keys")
+    }
+    if array(array(one), two).HashKey() == array(one, array(two)).HashKey() {
+        t.Errorf("arrays with different nesting have same hash keys")
+    }
+    if frozen(a, one, b, two).HashKey() != frozen(b, two, a, one).HashKey() {
+        t.Errorf("hashes with same pairs in different order have different hash keys")
+    }
+    if frozen(a, one).HashKey() == frozen(a, two).HashKey() {
+        t.Errorf("hashes with different values have same hash keys")
+    }
+
+    // Objects that are not hashable hash by their type instead of panicking.
+    if array(one, &Function{}).HashKey() != array(one, &Function{}).HashKey() {
+        t.Errorf("arrays holding functions have different hash keys")
+    }
+    if array(one, &Function{}).HashKey() == array(one, &Builtin{}).HashKey() {
+        t.Errorf("arrays holding a function and a builtin have same hash keys")
+    }
+    if frozen(a, &Function{}).HashKey() != frozen(a, &Function{}).HashKey() {
+        t.Errorf("hashes holding functions have different hash keys")
+    }
+
+    mutable := NewHash()
+    tests := []struct {
+        obj Object
+        err string
+    }{
+        {one, ""},
+        {array(one, a), ""},
+        {frozen(a, array(one)), ""},
+        {&Function{}, "unusable as hash key: FUNCTION"},
+        {mutable, "unusable as hash key: mutable HASH, freeze it first"},
+        {array(one, mutable), "unusable as hash key: mutable HASH, freeze it first"},
+        {frozen(a, &Function{}), "unusable as hash key: FUNCTION"},
+    }
+    for i, tt := range tests {
+        _, err := AsHashable(tt.obj)
+        switch {
+        case tt.err == "" && err != nil:
+            t.Errorf("tests[%d] unexpected error: %s", i, err)
+        case tt.err != "" && (err == nil || err.Error() != tt.err):
+            t.Errorf("tests[%d] wrong error. want=%q, got=%v", i, tt.err, err)
+        }
+    }
+}
+
+func TestSetOperations(t *testing.T) {
+    one, two, three := &Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}
+    left, right := NewSet(), NewSet()
+    if !left.Add(one) || !left.Add(two) || left.Add(&Integer{Value: 1}) {
+        t.Fatalf("Add did not report new members correctly")
+    }
+    right.Add(three)
+    right.Add(two)
+
+    tests := []struct {
+        set *Set
+        expected string
+    }{
+        {left, "{1, 2}"},
+        {left.Union(right), "{1, 2, 3}"},
+        {left.Intersection(right), "{2}"},
+        {left.Difference(right), "{1}"},
+        {right.Difference(right), "set()"},
+    }
+    for i, tt := range tests {
+        if got := tt.set.Inspect(); got != tt.expected {
+            t.Errorf("tests[%d] wrong Inspect. got=%q, want=%q", i, got, tt.expected)
+        }
+    }
+
+    if !left.Remove(one) || left.Remove(one) || left.Has(one) || left.Len() != 1 {
+        t.Errorf("Remove did not take the member out. got=%s", left.Inspect())
+    }
+}
+
+func TestRangeIteration(t *testing.T) {
+    tests := []struct {
+        r *Range
+        expected []int64
+    }{
+        {&Range{Start: 0, End: 3}, []int64{0, 1, 2}},
+        {&Range{Start: 0, End: 3, Inclusive: true}, []int64{0, 1, 2, 3}},
+        {&Range{Start: -2, End: 0}, []int64{-2, -1}},
+        {&Range{Start: 3, End: 3}, []int64{}},
+        {&Range{Start: 3, End: 3, Inclusive: true}, []int64{3}},
+        {&Range{Start: 3, End: 0}, []int64{}},
+        {&Range{Start: math.MaxInt64 - 1, End: math.MaxInt64, Inclusive: true}, []int64{math.MaxInt64 - 1, math.MaxInt64}},
+    }
+
+    for _, tt := range tests {
+        if tt.r.Len() != int64(len(tt.expected)) {
+            t.Errorf("%s: wrong Len. got=%d, want=%d", tt.r.Inspect(), tt.r.Len(), len(tt.expected))
+        }
+        got := []int64{}
+        it := tt.r.Iterate()
+        for el, ok := it.Next(); ok; el, ok = it.Next() {
+            got = append(got, el.(*Integer).Value)
+        }
+        if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+            t.Errorf("%s: wrong elements. got=%v, want=%v", tt.r.Inspect(), got, tt.expected)
+        }
+    }
+}
+
+func TestLargeRanges(t *testing.T) {
+    tests := []struct {
+        r *Range
+        length int64
+        first []int64
+    }{
+        {&Range{Start: -5000000000000000000, End: 5000000000000000000}, math.MaxInt64, []int64{-5000000000000000000, -4999999999999999999}},
+        {&Range{Start: math.MinInt64, End: math.MaxInt64, Inclusive: true}, math.MaxInt64, []int64{math.MinInt64, math.MinInt64 + 1}},
+        {&Range{Start: math.MinInt64, End: math.MaxInt64}, math.MaxInt64, []int64{math.MinInt64, math.MinInt64 + 1}},
+        {&Range{Start: -1, End: math.MaxInt64}, math.MaxInt64, []int64{-1, 0}},
+        {&Range{Start: 0, End: math.MaxInt64}, math.MaxInt64, []int64{0, 1}},
+        {&Range{Start: math.MinInt64, End: -1}, math.MaxInt64, []int64{math.MinInt64, math.MinInt64 + 1}},
+        {&Range{Start: math.MinInt64, End: math.MinInt64 + 1}, 1, []int64{math.MinInt64}},
+        {&Range{Start: math.MaxInt64, End: math.MinInt64, Inclusive: true}, 0, []int64{}},
+    }
+
+    for _, tt := range tests {
+        if tt.r.Len() != tt.length {
+            t.Errorf("%s: wrong Len. got=%d, want=%d", tt.r.Inspect(), tt.r.Len(), tt.length)
+        }
+        got := []int64{}
+        it := tt.r.Iterate()
+        for el, ok := it.Next(); ok && len(got) < len(tt.first); el, ok = it.Next() {
+            got = append(got, el.(*Integer).Value)
+        }
+        if fmt.Sprint(got) != fmt.Sprint(tt.first) {
+            t.Errorf("%s: wrong first elements. got=%v, want=%v", tt.r.Inspect(), got, tt.first)
+        }
+    }
+
+    a := &Range{Start: -5000000000000000000, End: 5000000000000000000}
+    b := &Range{Start: -5000000000000000000, End: 5000000000000000001}
+    if Equals(a, b) || !Equals(a, &Range{Start: a.Start, End: a.End - 1, Inclusive: true}) {
+        t.Errorf("large ranges compared by their saturated length")
+    }
+}
+
+func TestEnvironmentConcurrentAccess(t *testing.T) {
+    outer := NewEnvironment()
+    env := NewEnclosedEnviroment(outer)
+    done := make(chan struct{})
+    for i := 0; i < 4; i++ {
+        go func(i int) {
+            defer func() { done <- struct{}{} }()
+            name := fmt.Sprintf("v%d", i)
+            for j := 0; j < 100; j++ {
+                outer.Set("shared", &Integer{Value: int64(j)})
+                env.Set(name, &Integer{Value: int64(j)})
+                env.Get("shared")
+                env.Get(name)
+            }
+        }(i)
+    }
+    for i := 0; i < 4; i++ {
+        <-done
+    }
+    if _, ok := env.Get("v3"); !ok {
+        t.Errorf("v3 not set")
+    }
+}
+
+func TestFrame(t *testing.T) {
+    outer := NewEnvironment()
+    outer.Set("g", &Integer{Value: 1})
+    frame := NewFrame(outer, []string{"a", "b"})
+    inner := NewFrame(frame, []string{"c"})
+
+    frame.SetLocal(0, &Integer{Value: 2})
+    inner.Set("c", &Integer{Value: 3})
+    inner.Set("d", &Integer{Value: 4})
+
+    for name, expected := range map[string]int64{"a": 2, "c": 3, "d": 4, "g": 1} {
+        val, ok := inner.Get(name)
+        if !ok || val.(*Integer).Value != expected {
+            t.Errorf("Get(%q) = %v, %t, want %d", name, val, ok, expected)
+        }
+    }
+    if _, ok := inner.Get("b"); ok {
+        t.Errorf("unset slot b was found")
+    }
+    if val := inner.Local(1, 0); val == nil || val.(*Integer).Value != 2 {
+        t.Errorf("Local(1, 0) = %v, want 2", val)
+    }
+    if val := inner.Local(0, 0); val == nil || val.(*Integer).Value != 3 {
+        t.Errorf("Local(0, 0) = %v, want 3", val)
+    }
+    if val := inner.Local(1, 1); val != nil {
+        t.Errorf("Local(1, 1) = %v, want nil", val)
+    }
+}
+
+func TestNewIntegerCachesSmallValues(t *testing.T) {
+    for _, v := range []int64{MinCachedInteger, -1, 0, 1, 255, MaxCachedInteger} {
+        if NewInteger(v) != NewInteger(v) {
+            t.Errorf("NewInteger(%d) is not cached", v)
+        }
+        if got := NewInteger(v).Value; got != v {
+            t.Errorf("NewInteger(%d).Value = %d", v, got)
+        }
+    }
+    for _, v := range []int64{MinCachedInteger - 1, MaxCachedInteger + 1, 1 << 40} {
+        if NewInteger(v) == NewInteger(v) {
+            t.Errorf("NewInteger(%d) is cached", v)
+        }
+    }
+}
+
+func BenchmarkHashDelete(b *testing.B) {
+    keys := make([]Hashable, 10000)
+    for i := range keys {
+        keys[i] = &String{Value: fmt.Sprintf("key%d", i)}
+    }
+    b.ResetTimer()
+    for n := 0; n < b.N; n++ {
+        b.StopTimer()
+        hash := NewHash()
+        for _, key := range keys {
+            hash.Set(key, &Null{})
+        }
+        b.StartTimer()
+        for _, key := range keys {
+            hash.Delete(key)
+        }
+    }
+}
+
+func TestGeneratorClosedByAnotherGoroutine(t *testing.T) {
+    g := NewGenerator(context.Background(), func(yield YieldFunction) Object {
+        for i := int64(0); yield(NewInteger(i)); i++ {
+        }
+        return nil
+    })
+    if _, ok := g.Next(); !ok {
+        t.Fatalf("generator ended before it was closed")
+    }
+
+    // Close races with Next, which must see it and stop.
+    go g.Close()
+    for {
+        if _, ok := g.Next(); !ok {
+            break
+        }
+    }
+    if _, ok := g.Next(); ok {
+        t.Errorf("generator goes on after it was closed")
+    }
+}
+
+func TestTaskPanicBecomesError(t *testing.T) {
+    task := NewTask(func() Object { panic("boom") })
+    result, err := task.Wait(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    errObj, ok := result.(*Error)
+    if !ok || errObj.Message != "task panicked: boom" {
+        t.Errorf("wrong result. got=%T (%+v)", result, result)
+    }
+}
@@ -0,0 +1,51 @@
+package object
+
+import (
+    "bytes"
+    "strings"
+
+    "necronet.info/interpreter/ast"
+)
+
+const (
+    QUOTE_OBJ = "QUOTE"
+    MACRO_OBJ = "MACRO"
+)
+
+// Quote is code as a value: the unevaluated expression of a quote call,
+// or an argument of a macro.
+type Quote struct {
+    Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+    return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is a macro bound by a let. Locals names the slots of the frame
+// its body runs in.
+type Macro struct {
+    Parameters []*ast.Identifier
+    Body *ast.BlockStatement
+    Env *Environment
+    Locals []string
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+    var out bytes.Buffer
+
+    params := []string{}
+    for _, p := range m.Parameters {
+        params = append(params, p.String())
+    }
+
+    out.WriteString("macro(")
+    out.WriteString(strings.Join(params, ", "))
+    out.WriteString(") {\n")
+    out.WriteString(m.Body.String())
+    out.WriteString("\n}")
+
+    return out.String()
+}
@@ -0,0 +1,73 @@
+package object
+
+import (
+    "fmt"
+    "math"
+)
+
+const RANGE_OBJ = "RANGE"
+
+// Range is the lazy sequence of integers from Start up to End, including
+// End only when Inclusive is set. A range whose end lies before its start
+// is empty.
+type Range struct {
+    Start int64
+    End int64
+    Inclusive bool
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+func (r *Range) Inspect() string {
+    if r.Inclusive {
+        return fmt.Sprintf("%d..=%d", r.Start, r.End)
+    }
+    return fmt.Sprintf("%d..%d", r.Start, r.End)
+}
+
+// Len returns the number of integers in the range, or math.MaxInt64 for
+// the ranges holding more than that.
+func (r *Range) Len() int64 {
+    last, ok := r.last()
+    if !ok {
+        return 0
+    }
+    // Only the range of all integers wraps around to 0.
+    n := uint64(last) - uint64(r.Start) + 1
+    if n == 0 || n > math.MaxInt64 {
+        return math.MaxInt64
+    }
+    return int64(n)
+}
+
+// last returns the last integer of the range, unless it is empty.
+func (r *Range) last() (int64, bool) {
+    if r.Inclusive {
+        return r.End, r.End >= r.Start
+    }
+    return r.End - 1, r.End > r.Start
+}
+
+func (r *Range) Iterate() Iterator {
+    last, ok := r.last()
+    return &rangeIterator{next: r.Start, last: last, done: !ok}
+}
+
+type rangeIterator struct {
+    next int64
+    last int64
+    done bool
+}
+
+func (it *rangeIterator) Next() (Object, bool) {
+    if it.done {
+        return nil, false
+    }
+    value := NewInteger(it.next)
+    if it.next == it.last {
+        it.done = true
+    } else {
+        it.next++
+    }
+    return value, true
+}
@@ -0,0 +1,103 @@
+package object
+
+import (
+    "bytes"
+    "strings"
+)
+
+const SET_OBJ = "SET"
+
+// Set is an unordered collection of distinct hashable objects. Like Hash
+// it iterates and prints its members in insertion order, and is safe for
+// concurrent use.
+type Set struct {
+    members *Hash
+}
+
+func NewSet() *Set {
+    return &Set{members: NewHash()}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+
+func (s *Set) Inspect() string {
+    if s.Len() == 0 {
+        return "set()"
+    }
+    var out bytes.Buffer
+    members := []string{}
+    for _, member := range s.Members() {
+        members = append(members, member.Inspect())
+    }
+    out.WriteString("{")
+    out.WriteString(strings.Join(members, ", "))
+    out.WriteString("}")
+    return out.String()
+}
+
+// Len returns the number of members of the set.
+func (s *Set) Len() int { return s.members.Len() }
+
+// Has reports whether member is in the set.
+func (s *Set) Has(member Hashable) bool {
+    _, ok := s.members.Get(member)
+    return ok
+}
+
+// Add puts member in the set and reports whether it was missing.
+func (s *Set) Add(member Hashable) bool {
+    return s.members.set(member, member, false)
+}
+
+// Remove takes member out of the set and reports whether it was present.
+func (s *Set) Remove(member Hashable) bool {
+    _, ok := s.members.Delete(member)
+    return ok
+}
+
+// Members returns the members of the set in insertion order.
+func (s *Set) Members() []Object {
+    pairs := s.members.Pairs()
+    members := make([]Object, len(pairs))
+    for i, pair := range pairs {
+        members[i] = pair.Key
+    }
+    return members
+}
+
+// Union returns a new set with the members of s followed by those of
+// other.
+func (s *Set) Union(other *Set) *Set {
+    result := NewSet()
+    for _, member := range s.Members() {
+        result.Add(member.(Hashable))
+    }
+    for _, member := range other.Members() {
+        result.Add(member.(Hashable))
+    }
+    return result
+}
+
+// Intersection returns a new set with the members of s that are also in
+// other.
+func (s *Set) Intersection(other *Set) *Set {
+    result := NewSet()
+    for _, member := range s.Members() {
+        if other.Has(member.(Hashable)) {
+            result.Add(member.(Hashable))
+        }
+    }
+    return result
+}
+
+// Difference returns a new set with the members of s that are not in
+// other.
+func (s *Set) Difference(other *Set) *Set {
+    result := NewSet()
+    for _, member := range s.Members() {
+        if !other.Has(member.(Hashable)) {
+            result.Add(member.(Hashable))
+        }
+    }
+    return result
+}
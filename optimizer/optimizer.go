@@ -0,0 +1,197 @@
+// Package optimizer rewrites programs so that they do less work at run
+// time without changing what they do.
+package optimizer
+
+import (
+    "strconv"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/evaluator"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/token"
+)
+
+// Optimize returns an optimized copy of program, leaving program
+// unchanged. It
+//
+//   - folds prefix and infix operators applied to integer, string and
+//     boolean literals into a literal,
+//   - drops the branch of an if expression whose condition is a literal
+//     that cannot be taken,
+//   - drops the statements of a block that follow a return.
+//
+// Operators are folded with the evaluator's own semantics. An operation
+// that fails, like a division by zero, is left alone so that it still
+// fails at run time.
+//
+// The code quoted by calls to quote is data, and is left as written.
+func Optimize(program *ast.Program) *ast.Program {
+    quoted := map[token.Position][]ast.Expression{}
+    ast.Inspect(program, func(node ast.Node) bool {
+        if call, ok := node.(*ast.CallExpression); ok && call.Calls("quote") {
+            quoted[call.Pos()] = call.Arguments
+            return false
+        }
+        return true
+    })
+
+    return ast.Modify(program, func(node ast.Node) ast.Node {
+        if call, ok := node.(*ast.CallExpression); ok && call.Calls("quote") {
+            call.Arguments = copyExpressions(quoted[call.Pos()])
+            return call
+        }
+        return optimize(node)
+    }).(*ast.Program)
+}
+
+func copyExpressions(expressions []ast.Expression) []ast.Expression {
+    copied := make([]ast.Expression, len(expressions))
+    for i, e := range expressions {
+        copied[i] = ast.Copy(e).(ast.Expression)
+    }
+    return copied
+}
+
+// optimize rewrites a node whose children are already optimized.
+func optimize(node ast.Node) ast.Node {
+    switch node := node.(type) {
+    case *ast.Program:
+        node.Statements = optimizeStatements(node.Statements)
+    case *ast.BlockStatement:
+        node.Statements = optimizeStatements(node.Statements)
+    case *ast.PrefixExpression:
+        return foldPrefix(node)
+    case *ast.InfixExpression:
+        return foldInfix(node)
+    case *ast.IfExpression:
+        return pruneIf(node)
+    }
+    return node
+}
+
+func optimizeStatements(statements []ast.Statement) []ast.Statement {
+    optimized := make([]ast.Statement, 0, len(statements))
+    for i, s := range statements {
+        last := i == len(statements)-1
+
+        // The value of an if expression is only needed when it is the
+        // last statement of the block, otherwise the statements of the
+        // branch that is taken can replace it.
+        if es, ok := s.(*ast.ExpressionStatement); ok && !last {
+            if ie, ok := es.Expression.(*ast.IfExpression); ok && isLiteral(ie.Condition) {
+                if ie.Consequence != nil && truthy(ie.Condition) {
+                    optimized = append(optimized, ie.Consequence.Statements...)
+                }
+                if returns(optimized) {
+                    break
+                }
+                continue
+            }
+        }
+
+        optimized = append(optimized, s)
+        if returns(optimized) {
+            break
+        }
+    }
+    return optimized
+}
+
+// returns reports whether the last of statements is a return, making any
+// statement after it unreachable.
+func returns(statements []ast.Statement) bool {
+    if len(statements) == 0 {
+        return false
+    }
+    _, ok := statements[len(statements)-1].(*ast.ReturnStatement)
+    return ok
+}
+
+// pruneIf drops the branch that a literal condition rules out. The if
+// itself stays, as its value is still needed, with a condition that
+// leads straight to the remaining branch.
+func pruneIf(ie *ast.IfExpression) ast.Expression {
+    if !isLiteral(ie.Condition) {
+        return ie
+    }
+    if truthy(ie.Condition) {
+        ie.Alternative = nil
+        return ie
+    }
+    if ie.Alternative == nil {
+        // Without an alternative the if evaluates to NULL.
+        ie.Consequence = &ast.BlockStatement{Token: ie.Consequence.Token}
+        return ie
+    }
+    ie.Condition = &ast.Boolean{
+        Token: token.Token{Type: token.TRUE, Literal: "true", Pos: ie.Condition.Pos()},
+        Value: true,
+    }
+    ie.Consequence, ie.Alternative = ie.Alternative, nil
+    return ie
+}
+
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+    right, ok := literalObject(pe.Right)
+    if !ok {
+        return pe
+    }
+    return literalNode(evaluator.Prefix(pe.Operator, right), pe.Pos(), pe)
+}
+
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+    left, ok := literalObject(ie.Left)
+    if !ok {
+        return ie
+    }
+    right, ok := literalObject(ie.Right)
+    if !ok {
+        return ie
+    }
+    return literalNode(evaluator.Infix(ie.Operator, left, right), ie.Left.Pos(), ie)
+}
+
+func isLiteral(e ast.Expression) bool {
+    _, ok := literalObject(e)
+    return ok
+}
+
+// truthy reports whether a literal condition is taken.
+func truthy(e ast.Expression) bool {
+    obj, _ := literalObject(e)
+    return evaluator.IsTruthy(obj)
+}
+
+func literalObject(e ast.Expression) (object.Object, bool) {
+    switch e := e.(type) {
+    case *ast.IntegerLiteral:
+        return &object.Integer{Value: e.Value}, true
+    case *ast.StringLiteral:
+        return &object.String{Value: e.Value}, true
+    case *ast.Boolean:
+        if e.Value {
+            return evaluator.TRUE, true
+        }
+        return evaluator.FALSE, true
+    }
+    return nil, false
+}
+
+// literalNode turns the result of a folded operation back into a literal
+// at pos. Results without a literal form, and errors, keep the original
+// expression.
+func literalNode(obj object.Object, pos token.Position, original ast.Expression) ast.Expression {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        literal := strconv.FormatInt(obj.Value, 10)
+        return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Pos: pos}, Value: obj.Value}
+    case *object.String:
+        return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}, Value: obj.Value}
+    case *object.Boolean:
+        if obj.Value {
+            return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}
+        }
+        return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}, Value: false}
+    }
+    return original
+}
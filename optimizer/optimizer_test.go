@@ -0,0 +1,126 @@
+package optimizer
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    monkeyast "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/evaluator"
+    "necronet.info/interpreter/internal/monkeytest"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/resolver"
+)
+
+func TestOptimize(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {`1 + 2 * 3`, `7`},
+        {`-5 + 10`, `5`},
+        {`"foo" + "bar"`, `foobar`},
+        {`1 < 2`, `true`},
+        {`!false == true`, `true`},
+        {`"a" == "a"`, `true`},
+        {`let x = 2 * 21;`, `let x = 42`},
+        {`x + 1 * 2`, `(x + 2)`},
+        {`fn(x) { x + 2 * 3 }`, `fn(x) (x + 6)`},
+        {`[1 + 1, "a" + "b"]`, `[2,ab]`},
+        {`f(1 + 1)[2 - 1]`, `(f(2)[1])`},
+
+        // Operations that fail at run time are kept.
+        {`10 / 0`, `(10 / 0)`},
+        {`1 + "a"`, `(1 + a)`},
+        {`-"a"`, `(-a)`},
+        {`1..3`, `(1 .. 3)`},
+
+        // Dead branches.
+        {`if (1 < 2) { 10 } else { 20 }`, `iftrue 10`},
+        {`if (1 > 2) { 10 } else { 20 }`, `iftrue 20`},
+        {`if (false) { 10 }`, `iffalse `},
+        {`if (x) { 10 } else { 20 }`, `ifx 10else 20`},
+        {`if (true) { let a = 1; } 2`, `let a = 12`},
+        {`if (false) { let a = 1; } 2`, `2`},
+        {`if (false) { 1 } else { 2 }; 3`, `23`},
+        {`return 1; 2; 3`, `return 1;`},
+        {`fn() { 1; return 2; 3 }`, `fn() 1return 2;`},
+        {`fn() { if (true) { return 1; } 2 }`, `fn() return 1;`},
+
+        // Quoted code is data.
+        {`quote(1 + 2)`, `quote((1 + 2))`},
+        {`[quote(fn() { return 1; 2 }), 1 + 2]`, `[quote(fn() return 1;2),3]`},
+    }
+
+    for _, tt := range tests {
+        program := monkeytest.MustParse(t, tt.input)
+        if got := Optimize(program).String(); got != tt.expected {
+            t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+        }
+    }
+}
+
+func TestOptimizeKeepsPositions(t *testing.T) {
+    program, _ := monkeytest.Parse("let a = 1;\nlet b = 2 + 3;")
+    optimized := Optimize(program)
+
+    let := optimized.Statements[1].(*monkeyast.LetStatement)
+    if pos := let.Value.Pos(); pos.Line != 2 || pos.Column != 9 {
+        t.Errorf("folded literal at %s, expected 2:9", pos)
+    }
+}
+
+func TestOptimizeCopies(t *testing.T) {
+    input := `let f = fn() { if (1 < 2) { return 3 * 4; } 5 }; 6 + 7`
+    program, _ := monkeytest.Parse(input)
+    before := program.String()
+
+    if optimized := Optimize(program).String(); optimized == before {
+        t.Fatalf("%q was not optimized", input)
+    }
+    if after := program.String(); after != before {
+        t.Errorf("Optimize changed its input from %q to %q", before, after)
+    }
+}
+
+func eval(program *monkeyast.Program) object.Object {
+    ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+    defer cancel()
+    result := evaluator.New().WithContext(ctx).Eval(program, object.NewEnvironment())
+    if result == nil {
+        return evaluator.NULL
+    }
+    return result
+}
+
+// TestPreservesSemantics evaluates every program of monkeytest.Programs
+// before and after optimizing it. Programs referring to undeclared names
+// are skipped, as they are rejected before they are optimized.
+func TestPreservesSemantics(t *testing.T) {
+    in := evaluator.New()
+    defined := func(name string) bool {
+        _, ok := in.Builtin(name)
+        return ok
+    }
+    for _, input := range monkeytest.Programs {
+        program, _ := monkeytest.Parse(input)
+        if len(resolver.Resolve(program, defined)) != 0 {
+            continue
+        }
+        expected := eval(program)
+        program, _ = monkeytest.Parse(input)
+        result := eval(Optimize(program))
+
+        if expected.Type() != result.Type() {
+            t.Errorf("%q: expected %s, got %s", input, expected.Inspect(), result.Inspect())
+            continue
+        }
+        switch expected.Type() {
+        case object.FUNCTION_OBJ, object.BUILTIN_OBJ, object.CHANNEL_OBJ, object.TASK_OBJ:
+            continue
+        }
+        if expected.Inspect() != result.Inspect() {
+            t.Errorf("%q: expected %s, got %s", input, expected.Inspect(), result.Inspect())
+        }
+    }
+}
@@ -14,6 +14,7 @@ const (
 	LOWEST
 	EQUALS
 	LESSGREATER
+	RANGE
 	SUM
 	PRODUCT
 	PREFIX
@@ -26,14 +27,27 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+    token.DOTDOT:   RANGE,
+    token.DOTDOT_EQ: RANGE,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
+    token.PIPE:     SUM,
+    token.AMPERSAND: PRODUCT,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
     token.LBRACKET: INDEX,
 }
 
+// Precedence returns the precedence of the infix operator t, or LOWEST
+// when t is not one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 type Parser struct {
 	l              *lexer.Lexer
 	curToken       token.Token
@@ -41,6 +55,9 @@ type Parser struct {
 	errors         []string
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// functions are the function literals being parsed, innermost last.
+	functions []*ast.FunctionLiteral
 }
 
 type (
@@ -61,11 +78,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+    p.registerPrefix(token.FOR, p.parseForExpression)
+    p.registerPrefix(token.YIELD, p.parseYieldExpression)
+    p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
     p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
     p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+    p.registerPrefix(token.IMPORT, p.parseImportExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -76,17 +99,68 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+    p.registerInfix(token.PIPE, p.parseInfixExpression)
+    p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+    p.registerInfix(token.DOTDOT, p.parseInfixExpression)
+    p.registerInfix(token.DOTDOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
     p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	return p
 }
 
-func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-    exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+func (p *Parser) parseImportExpression() ast.Expression {
+    exp := &ast.ImportExpression{Token: p.curToken}
     p.nextToken()
 
-    exp.Index = p.parseExpression(LOWEST)
+    exp.Path = p.parseExpression(PREFIX)
+    if exp.Path == nil {
+        return nil
+    }
+
+    return exp
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+    stmt := &ast.ExportStatement{Token: p.curToken}
+
+    if !p.expectPeek(token.LET) {
+        return nil
+    }
+
+    let := p.parseLetStatement()
+    if let == nil {
+        return nil
+    }
+    stmt.Statement = let
+
+    return stmt
+}
+
+// parseIndexExpression parses left[index] as well as the slices
+// left[start:end] and left[start:end:step], where any part may be left out.
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+    tok := p.curToken
+
+    var start ast.Expression
+    if !p.peekTokenIs(token.COLON) {
+        p.nextToken()
+        start = p.parseExpression(LOWEST)
+        if !p.peekTokenIs(token.COLON) {
+            if !p.expectPeek(token.RBRACKET) {
+                return nil
+            }
+            return &ast.IndexExpression{Token: tok, Left: left, Index: start}
+        }
+    }
+
+    p.nextToken()
+    exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+    exp.End = p.parseSliceBound()
+    if p.peekTokenIs(token.COLON) {
+        p.nextToken()
+        exp.Step = p.parseSliceBound()
+    }
 
     if !p.expectPeek(token.RBRACKET) {
         return nil
@@ -95,19 +169,33 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
     return exp
 }
 
+// parseSliceBound parses the optional expression after a colon in a slice.
+func (p *Parser) parseSliceBound() ast.Expression {
+    if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.RBRACKET) {
+        return nil
+    }
+    p.nextToken()
+    return p.parseExpression(LOWEST)
+}
+
+// parseHashLiteral parses both hash and set literals: braces whose first
+// element is not followed by a colon hold a set.
 func (p *Parser) parseHashLiteral() ast.Expression {
     hash := &ast.HashLiteral{Token: p.curToken}
-    hash.Pairs = make(map[ast.Expression]ast.Expression)
+    hash.Pairs = []ast.HashPair{}
 
     for !p.peekTokenIs(token.RBRACE) {
         p.nextToken()
         key := p.parseExpression(LOWEST)
+        if len(hash.Pairs) == 0 && !p.peekTokenIs(token.COLON) {
+            return p.parseSetLiteral(hash.Token, key)
+        }
         if !p.expectPeek(token.COLON) {
             return nil
         }
         p.nextToken()
         value := p.parseExpression(LOWEST)
-        hash.Pairs[key] = value
+        hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
         if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
             return nil
         }
@@ -118,6 +206,23 @@ func (p *Parser) parseHashLiteral() ast.Expression {
     return hash
 }
 
+func (p *Parser) parseSetLiteral(tok token.Token, first ast.Expression) ast.Expression {
+    set := &ast.SetLiteral{Token: tok, Elements: []ast.Expression{first}}
+
+    for p.peekTokenIs(token.COMMA) {
+        p.nextToken()
+        if p.peekTokenIs(token.RBRACE) {
+            break
+        }
+        p.nextToken()
+        set.Elements = append(set.Elements, p.parseExpression(LOWEST))
+    }
+    if !p.expectPeek(token.RBRACE) {
+        return nil
+    }
+    return set
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
     array := &ast.ArrayLiteral{Token: p.curToken}
     array.Elements = p.parseExpressionList(token.RBRACKET)
@@ -189,10 +294,44 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	p.functions = append(p.functions, lit)
+	lit.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
+	return lit
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
 	lit.Body = p.parseBlockStatement()
 	return lit
 }
 
+// parseYieldExpression parses yield with an optional value and marks the
+// enclosing function literal as a generator.
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.curToken}
+	if len(p.functions) == 0 {
+		p.errors = append(p.errors, "yield outside of a function")
+		return nil
+	}
+	p.functions[len(p.functions)-1].IsGenerator = true
+
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) {
+		return expression
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -239,6 +378,52 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	expression.Consequence = p.parseBlockStatement()
 
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.curToken}
+	p.nextToken()
+	expression.Call = p.parseExpression(PREFIX)
+	if expression.Call == nil {
+		return nil
+	}
 	return expression
 }
 
@@ -257,9 +442,22 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken.Pos
 	return block
 }
 
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -319,6 +517,8 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -340,6 +540,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -354,7 +557,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -380,17 +583,11 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.curToken.Type)
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
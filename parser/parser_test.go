@@ -6,6 +6,7 @@ import (
 
 	"necronet.info/interpreter/ast"
 	"necronet.info/interpreter/lexer"
+	"necronet.info/interpreter/token"
 )
 
 func checkParserErrors(t *testing.T, p *Parser) {
@@ -122,6 +123,27 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestReturnStatementWithoutSemicolon(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"return x", "return x;"},
+        {"fn() { return x }", "fn() return x;"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -180,6 +202,31 @@ func TestParsingIndexExpressions(t *testing.T) {
     }
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"a[1:3]", "(a[1:3])"},
+        {"a[:2]", "(a[:2])"},
+        {"a[2:]", "(a[2:])"},
+        {"a[:]", "(a[:])"},
+        {"a[::2]", "(a[::2])"},
+        {"a[1:-1:2]", "(a[1:(-1):2])"},
+        {"a[::-1][0]", "((a[::(-1)])[0])"},
+        {"a[i + 1:len(a)]", "(a[(i + 1):len(a)])"},
+    }
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+        if got := program.String(); got != tt.expected {
+            t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, got)
+        }
+    }
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -467,6 +514,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a | b & c - d",
+			"((a | (b & c)) - d)",
+		},
+		{
+			"0..n - 1",
+			"(0 .. (n - 1))",
+		},
+		{
+			"a..=b == c",
+			"((a ..= b) == c)",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
@@ -506,6 +565,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
             "add(a * b[2], b[1], 2 * [1, 2][1])",
             "add((a * (b[2])), (b[1]), (2 * ([1,2][1])))",
         },
+        {
+            "1 + (2 + 3) + 4",
+            "((1 + (2 + 3)) + 4)",
+        },
+        {
+            "(5 + 5) * 2",
+            "((5 + 5) * 2)",
+        },
+        {
+            "2 / (5 + 5)",
+            "(2 / (5 + 5))",
+        },
+        {
+            "-(5 + 5)",
+            "(-(5 + 5))",
+        },
+        {
+            "!(true == true)",
+            "(!(true == true))",
+        },
+        {
+            "(f)(1)[0]",
+            "(f(1)[0])",
+        },
 	}
 
 	for _, tt := range tests {
@@ -540,13 +623,44 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
         "two": 2,
         "three": 3,
     }
-    for key, value := range hash.Pairs {
-        literal, ok := key.(*ast.StringLiteral)
+    for _, pair := range hash.Pairs {
+        literal, ok := pair.Key.(*ast.StringLiteral)
         if !ok {
-            t.Errorf("key is not ast.StringLiteral. got=%T", key)
+            t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
         }
         expectedValue := expected[literal.String()]
-        testIntegerLiteral(t, value, expectedValue)
+        testIntegerLiteral(t, pair.Value, expectedValue)
+    }
+}
+
+func TestParsingHashLiteralsKeepSourceOrder(t *testing.T) {
+    input := `{"c": 1, "a": 2, "b": 3, "a": 4}`
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+    stmt := program.Statements[0].(*ast.ExpressionStatement)
+    hash, ok := stmt.Expression.(*ast.HashLiteral)
+    if !ok {
+        t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+    }
+    expected := []struct {
+        key string
+        value int64
+    }{
+        {"c", 1}, {"a", 2}, {"b", 3}, {"a", 4},
+    }
+    if len(hash.Pairs) != len(expected) {
+        t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+    }
+    for i, pair := range hash.Pairs {
+        if pair.Key.String() != expected[i].key {
+            t.Errorf("pair %d has wrong key. expected=%q, got=%q", i, expected[i].key, pair.Key.String())
+        }
+        testIntegerLiteral(t, pair.Value, expected[i].value)
+    }
+    if hash.String() != "{c:1,a:2,b:3,a:4}" {
+        t.Errorf("hash.String() wrong. got=%q", hash.String())
     }
 }
 
@@ -566,6 +680,42 @@ func TestParsingEmptyHashLiteral(t *testing.T) {
     }
 }
 
+func TestParsingSetLiterals(t *testing.T) {
+    tests := []struct {
+        input string
+        expected []int64
+    }{
+        {"{1}", []int64{1}},
+        {"{1, 2, 3}", []int64{1, 2, 3}},
+        {"{1, 2,}", []int64{1, 2}},
+    }
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+        stmt := program.Statements[0].(*ast.ExpressionStatement)
+        set, ok := stmt.Expression.(*ast.SetLiteral)
+        if !ok {
+            t.Fatalf("exp is not ast.SetLiteral. got=%T", stmt.Expression)
+        }
+        if len(set.Elements) != len(tt.expected) {
+            t.Fatalf("set.Elements has wrong length. got=%d", len(set.Elements))
+        }
+        for i, el := range set.Elements {
+            testIntegerLiteral(t, el, tt.expected[i])
+        }
+    }
+}
+
+func TestParsingSetLiteralMixedWithPairs(t *testing.T) {
+    l := lexer.New(`{1, 2: 3}`)
+    p := New(l)
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+        t.Fatalf("expected parser errors for a set literal with a pair")
+    }
+}
 
 func TestParsingHashLiteralsWithExpressions(t *testing.T) {
     input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
@@ -592,10 +742,10 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
             testInfixExpression(t, e, 15, "/", 5)
         },
     }
-    for key, value := range hash.Pairs {
-        literal, ok := key.(*ast.StringLiteral)
+    for _, pair := range hash.Pairs {
+        literal, ok := pair.Key.(*ast.StringLiteral)
         if !ok {
-            t.Errorf("key is not ast.StringLiteral. got=%T", key)
+            t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
             continue
         }
         testFunc, ok := tests[literal.String()]
@@ -603,7 +753,7 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
             t.Errorf("No test function for key %q found", literal.String())
             continue
         }
-        testFunc(value)
+        testFunc(pair.Value)
     }
 }
 
@@ -653,6 +803,170 @@ func TestIfExpression(t *testing.T) {
 
 }
 
+func TestIfElseExpression(t *testing.T) {
+    input := `if (x < y) { x } else { y }`
+
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+    }
+    stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+    }
+    exp, ok := stmt.Expression.(*ast.IfExpression)
+    if !ok {
+        t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+    }
+    if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+        return
+    }
+    if len(exp.Consequence.Statements) != 1 {
+        t.Fatalf("consequence is not 1 statements. got=%d", len(exp.Consequence.Statements))
+    }
+    consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
+    }
+    if !testIdentifier(t, consequence.Expression, "x") {
+        return
+    }
+    if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+        t.Fatalf("alternative is not 1 statements. got=%+v", exp.Alternative)
+    }
+    alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
+    }
+    testIdentifier(t, alternative.Expression, "y")
+}
+
+func TestBlockClosingBrace(t *testing.T) {
+    p := New(lexer.New("if (x) {\n  y\n  }"))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    ie := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+    if expected := (token.Position{Line: 3, Column: 3}); ie.Consequence.Rbrace != expected {
+        t.Errorf("wrong closing brace position. expected=%s, got=%s", expected, ie.Consequence.Rbrace)
+    }
+}
+
+func TestForExpression(t *testing.T) {
+    input := `for (x in 0..10) { puts(x) }`
+
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+    }
+    stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+    }
+    exp, ok := stmt.Expression.(*ast.ForExpression)
+    if !ok {
+        t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+    }
+    if !testIdentifier(t, exp.Variable, "x") {
+        return
+    }
+    if !testInfixExpression(t, exp.Iterable, 0, "..", 10) {
+        return
+    }
+    if len(exp.Body.Statements) != 1 {
+        t.Errorf("body is not 1 statement. got=%d", len(exp.Body.Statements))
+    }
+}
+
+func TestForExpressionErrors(t *testing.T) {
+    inputs := []string{
+        `for x in xs { x }`,
+        `for (1 in xs) { x }`,
+        `for (x of xs) { x }`,
+    }
+    for _, input := range inputs {
+        p := New(lexer.New(input))
+        p.ParseProgram()
+        if len(p.Errors()) == 0 {
+            t.Errorf("%s: expected parser errors", input)
+        }
+    }
+}
+
+func TestYieldMarksGeneratorFunctions(t *testing.T) {
+    input := `fn() { yield 1; yield; let inner = fn() { 2 }; }`
+
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+    if !outer.IsGenerator {
+        t.Errorf("outer function is not a generator")
+    }
+    first := outer.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.YieldExpression)
+    testIntegerLiteral(t, first.Value, 1)
+    bare := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.YieldExpression)
+    if bare.Value != nil {
+        t.Errorf("bare yield has a value. got=%s", bare.Value)
+    }
+    inner := outer.Body.Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+    if inner.IsGenerator {
+        t.Errorf("inner function without yield is a generator")
+    }
+}
+
+func TestYieldOnlyMarksInnermostFunction(t *testing.T) {
+    input := `fn() { fn() { yield 1; } }`
+
+    p := New(lexer.New(input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+    inner := outer.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+    if outer.IsGenerator || !inner.IsGenerator {
+        t.Errorf("wrong generator flags. outer=%t, inner=%t", outer.IsGenerator, inner.IsGenerator)
+    }
+}
+
+func TestYieldOutsideFunction(t *testing.T) {
+    p := New(lexer.New(`yield 1;`))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 || p.Errors()[0] != "yield outside of a function" {
+        t.Errorf("wrong parser errors. got=%q", p.Errors())
+    }
+}
+
+func TestSpawnExpression(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"spawn f(1, 2)", "spawn f(1, 2)"},
+        {"spawn fn() { x }", "spawn fn() x"},
+        {"spawn fn(a) { a }(1)", "spawn fn(a) a(1)"},
+        {"spawn f + 1", "(spawn f + 1)"},
+    }
+    for _, tt := range tests {
+        p := New(lexer.New(tt.input))
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+        if got := program.String(); got != tt.expected {
+            t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, got)
+        }
+    }
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 	l := lexer.New(input)
@@ -694,6 +1008,75 @@ func TestFunctionLiteral(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionLiteralName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(x, y) { x + y };", "add"},
+		{"let add = fn(x, y) { x + y }(1, 2);", ""},
+		{"fn(x) { x };", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var expression ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			expression = stmt.Value
+		case *ast.ExpressionStatement:
+			expression = stmt.Expression
+		}
+		if call, ok := expression.(*ast.CallExpression); ok {
+			expression = call.Function
+		}
+		function, ok := expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("%s: expression is not ast.FunctionLiteral. got=%T", tt.input, expression)
+		}
+		if function.Name != tt.expected {
+			t.Errorf("%s: wrong name. expected=%q, got=%q", tt.input, tt.expected, function.Name)
+		}
+	}
+}
+
+func TestMacroLiteral(t *testing.T) {
+    input := `macro(x, y) { x + y; }`
+
+    p := New(lexer.New(input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+    }
+    stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+    }
+    macro, ok := stmt.Expression.(*ast.MacroLiteral)
+    if !ok {
+        t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+    }
+    if len(macro.Parameters) != 2 {
+        t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+    }
+    testLiteralExpression(t, macro.Parameters[0], "x")
+    testLiteralExpression(t, macro.Parameters[1], "y")
+
+    if len(macro.Body.Statements) != 1 {
+        t.Fatalf("macro.Body.Statements has not 1 statement. got=%d", len(macro.Body.Statements))
+    }
+    body, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+    }
+    testInfixExpression(t, body.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 
 	tests := []struct {
@@ -791,3 +1174,56 @@ func TestLetStatements(t *testing.T) {
 		}
 	}
 }
+
+func TestImportExpression(t *testing.T) {
+    input := `let m = import "path/to/mod";`
+
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt := program.Statements[0].(*ast.LetStatement)
+    exp, ok := stmt.Value.(*ast.ImportExpression)
+    if !ok {
+        t.Fatalf("stmt.Value is not ast.ImportExpression. got=%T", stmt.Value)
+    }
+    path, ok := exp.Path.(*ast.StringLiteral)
+    if !ok {
+        t.Fatalf("exp.Path is not ast.StringLiteral. got=%T", exp.Path)
+    }
+    if path.Value != "path/to/mod" {
+        t.Errorf("path.Value not %q. got=%q", "path/to/mod", path.Value)
+    }
+}
+
+func TestExportStatement(t *testing.T) {
+    input := `export let x = 5;`
+
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+    }
+    stmt, ok := program.Statements[0].(*ast.ExportStatement)
+    if !ok {
+        t.Fatalf("program.Statements[0] is not ast.ExportStatement. got=%T", program.Statements[0])
+    }
+    if !testLetStatement(t, stmt.Statement, "x") {
+        return
+    }
+    testIntegerLiteral(t, stmt.Statement.Value, 5)
+}
+
+func TestExportRequiresLet(t *testing.T) {
+    l := lexer.New("export 5;")
+    p := New(l)
+    p.ParseProgram()
+
+    if len(p.Errors()) == 0 {
+        t.Fatalf("expected parser errors for export without let")
+    }
+}
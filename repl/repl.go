@@ -4,11 +4,17 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"necronet.info/interpreter/ast"
+	"necronet.info/interpreter/compiler"
 	"necronet.info/interpreter/evaluator"
 	"necronet.info/interpreter/lexer"
 	"necronet.info/interpreter/object"
 	"necronet.info/interpreter/parser"
+	"necronet.info/interpreter/vm"
 )
 
 const PROMPT = "$"
@@ -21,9 +27,42 @@ const MONKEY_FACE = `
 '._ '-=-' _.' '-----'
 `
 
+const HELP = `commands:
+  :eval     evaluate input with the tree-walking evaluator (default)
+  :vm       compile input and run it on the virtual machine
+  :trace    toggle tracing every instruction the virtual machine runs
+  :disasm   toggle listing the bytecode of each input before running it
+  :help     show this help
+The evaluator and the virtual machine keep separate variables.
+`
+
+// session is the state of a REPL. Each engine keeps its own variables.
+type session struct {
+	out         io.Writer
+	interpreter *evaluator.Interpreter
+	env         *object.Environment
+
+	useVM       bool
+	trace       bool
+	disasm      bool
+	macros      *object.Environment
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-    env := object.NewEnvironment()
+    s := &session{
+        out: out,
+        interpreter: evaluator.New(),
+        env: object.NewEnvironment(),
+        macros: object.NewEnvironment(),
+        symbolTable: compiler.NewSymbolTable(),
+        globals: make([]object.Object, vm.GlobalsSize),
+    }
+    s.interpreter.SetSearchPath(filepath.SplitList(os.Getenv("MONKEYPATH")))
+    s.interpreter.SetStrict(os.Getenv("MONKEYSTRICT") != "")
 	for {
 		fmt.Print(PROMPT)
 		scanned := scanner.Scan()
@@ -33,6 +72,11 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			s.command(strings.TrimSpace(line))
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -43,7 +87,12 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-        evaluated := evaluator.Eval(program, env)
+        var evaluated object.Object
+        if s.useVM {
+            evaluated = s.run(program)
+        } else {
+            evaluated = s.interpreter.Eval(program, s.env)
+        }
         if evaluated != nil {
             io.WriteString(out, evaluated.Inspect())
             io.WriteString(out, "\n")
@@ -51,6 +100,65 @@ func Start(in io.Reader, out io.Writer) {
     }
 }
 
+func (s *session) command(line string) {
+    switch line {
+    case ":eval":
+        s.useVM = false
+    case ":vm":
+        s.useVM = true
+    case ":trace":
+        s.trace = !s.trace
+        fmt.Fprintf(s.out, "trace %s\n", onOff(s.trace))
+    case ":disasm":
+        s.disasm = !s.disasm
+        fmt.Fprintf(s.out, "disasm %s\n", onOff(s.disasm))
+    case ":help":
+        io.WriteString(s.out, HELP)
+        return
+    default:
+        fmt.Fprintf(s.out, "unknown command %s\n%s", line, HELP)
+        return
+    }
+    if (s.trace || s.disasm) && !s.useVM {
+        io.WriteString(s.out, "note: tracing and listings only apply to :vm\n")
+    }
+}
+
+// run compiles program on top of the earlier inputs and runs it on the
+// virtual machine, once its macros are expanded. Failures are returned as
+// errors, like Eval does.
+func (s *session) run(program *ast.Program) object.Object {
+    program, err := s.interpreter.ExpandMacros(program, s.macros)
+    if err != nil {
+        return &object.Error{Message: err.Error()}
+    }
+    comp := compiler.NewWithState(s.symbolTable, s.constants)
+    if err := comp.Compile(program); err != nil {
+        return &object.Error{Message: err.Error()}
+    }
+    bytecode := comp.Bytecode()
+    s.constants = bytecode.Constants
+
+    if s.disasm {
+        bytecode.Disassemble(s.out)
+    }
+    machine := vm.NewWithGlobalsStore(bytecode, s.interpreter, s.globals)
+    if s.trace {
+        machine.SetTrace(s.out)
+    }
+    if err := machine.Run(); err != nil {
+        return &object.Error{Message: err.Error()}
+    }
+    return machine.Result()
+}
+
+func onOff(on bool) string {
+    if on {
+        return "on"
+    }
+    return "off"
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
@@ -0,0 +1,225 @@
+// Package resolver binds the identifiers of a program to the variables
+// they refer to, so that they can be found without looking up their names.
+package resolver
+
+import (
+    "sort"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/token"
+)
+
+// Error reports an identifier that is declared nowhere.
+type Error struct {
+    Pos  token.Position
+    Name string
+}
+
+// Message returns the error without its position, as the evaluator
+// reports it.
+func (e *Error) Message() string {
+    return "identifier not found: " + e.Name
+}
+
+func (e *Error) Error() string {
+    return e.Pos.String() + ": " + e.Message()
+}
+
+// Resolve binds every identifier of program, and returns the ones that
+// are declared nowhere, sorted by position. defined reports whether a name
+// the program does not declare is defined anyway, like the builtins or
+// the globals of earlier REPL inputs.
+//
+// Blocks share the scope of the function, or program, they are in, so a
+// let in an if or for body declares a variable of the whole function.
+// Identifiers declared by a function are bound to slots of its frame,
+// whatever their position in the body. Those read before they are set
+// still fall back to a lookup by name, like an outer variable they shadow.
+func Resolve(program *ast.Program, defined func(name string) bool) []*Error {
+    r := &resolver{scope: &scope{slots: map[string]int{}}}
+    r.statements(program.Statements)
+
+    var errs []*Error
+    for _, ref := range r.scope.refs {
+        _, declared := r.scope.slots[ref.ident.Value]
+        if declared || defined != nil && defined(ref.ident.Value) {
+            bind(ref.ident, ast.Global, 0, 0)
+            continue
+        }
+        errs = append(errs, &Error{Pos: ref.ident.Pos(), Name: ref.ident.Value})
+    }
+    sort.SliceStable(errs, func(i, j int) bool { return errs[i].Pos.Before(errs[j].Pos) })
+    return errs
+}
+
+// scope is the scope of a function, or of the program at the outermost
+// level. Identifiers are only bound once the whole scope has been seen,
+// as they may refer to variables declared after them.
+type scope struct {
+    outer *scope
+    slots map[string]int
+    names []string
+    refs  []reference
+}
+
+type reference struct {
+    ident *ast.Identifier
+    // depth counts the functions between the identifier and the scope.
+    depth int
+}
+
+func (s *scope) declare(name string) int {
+    if slot, ok := s.slots[name]; ok {
+        return slot
+    }
+    slot := len(s.names)
+    s.slots[name] = slot
+    s.names = append(s.names, name)
+    return slot
+}
+
+type resolver struct {
+    scope *scope
+}
+
+func bind(ident *ast.Identifier, binding ast.Binding, depth, slot int) {
+    ident.Binding = binding
+    ident.Depth = depth
+    ident.Slot = slot
+}
+
+// declare binds the identifier of a let or a loop variable.
+func (r *resolver) declare(ident *ast.Identifier) {
+    slot := r.scope.declare(ident.Value)
+    if r.scope.outer == nil {
+        bind(ident, ast.Global, 0, 0)
+        return
+    }
+    bind(ident, ast.Local, 0, slot)
+}
+
+func (r *resolver) statements(statements []ast.Statement) {
+    for _, s := range statements {
+        r.statement(s)
+    }
+}
+
+func (r *resolver) statement(s ast.Statement) {
+    switch s := s.(type) {
+    case *ast.LetStatement:
+        r.expression(s.Value)
+        r.declare(s.Name)
+    case *ast.ReturnStatement:
+        r.expression(s.ReturnValue)
+    case *ast.ExpressionStatement:
+        r.expression(s.Expression)
+    case *ast.ExportStatement:
+        r.statement(s.Statement)
+    case *ast.BlockStatement:
+        r.block(s)
+    }
+}
+
+func (r *resolver) block(block *ast.BlockStatement) {
+    if block != nil {
+        r.statements(block.Statements)
+    }
+}
+
+func (r *resolver) expressions(expressions []ast.Expression) {
+    for _, e := range expressions {
+        r.expression(e)
+    }
+}
+
+func (r *resolver) expression(e ast.Expression) {
+    switch e := e.(type) {
+    case *ast.Identifier:
+        r.scope.refs = append(r.scope.refs, reference{ident: e})
+    case *ast.PrefixExpression:
+        r.expression(e.Right)
+    case *ast.InfixExpression:
+        r.expression(e.Left)
+        r.expression(e.Right)
+    case *ast.IfExpression:
+        r.expression(e.Condition)
+        r.block(e.Consequence)
+        r.block(e.Alternative)
+    case *ast.ForExpression:
+        r.expression(e.Iterable)
+        r.declare(e.Variable)
+        r.block(e.Body)
+    case *ast.FunctionLiteral:
+        e.Locals = r.function(e.Parameters, e.Body)
+    case *ast.MacroLiteral:
+        e.Locals = r.function(e.Parameters, e.Body)
+    case *ast.CallExpression:
+        if e.Calls("quote") {
+            r.quoted(e.Arguments)
+            return
+        }
+        r.expression(e.Function)
+        r.expressions(e.Arguments)
+    case *ast.ArrayLiteral:
+        r.expressions(e.Elements)
+    case *ast.SetLiteral:
+        r.expressions(e.Elements)
+    case *ast.HashLiteral:
+        for _, pair := range e.Pairs {
+            r.expression(pair.Key)
+            r.expression(pair.Value)
+        }
+    case *ast.IndexExpression:
+        r.expression(e.Left)
+        r.expression(e.Index)
+    case *ast.SliceExpression:
+        r.expression(e.Left)
+        r.expression(e.Start)
+        r.expression(e.End)
+        r.expression(e.Step)
+    case *ast.YieldExpression:
+        r.expression(e.Value)
+    case *ast.SpawnExpression:
+        r.expression(e.Call)
+    case *ast.ImportExpression:
+        r.expression(e.Path)
+    }
+}
+
+// quoted resolves the code quoted by a call to quote. Only the arguments
+// of the calls to unquote in it are evaluated, in the current scope.
+func (r *resolver) quoted(arguments []ast.Expression) {
+    for _, argument := range arguments {
+        ast.Inspect(argument, func(node ast.Node) bool {
+            call, ok := node.(*ast.CallExpression)
+            if ok && call.Calls("unquote") {
+                r.expressions(call.Arguments)
+                return false
+            }
+            return true
+        })
+    }
+}
+
+// function resolves the body of a function, or macro, in a scope of its
+// own, and returns the names of its locals. The references its scope does
+// not declare are handed to the enclosing scope, one function further out.
+func (r *resolver) function(params []*ast.Identifier, body *ast.BlockStatement) []string {
+    outer := r.scope
+    r.scope = &scope{outer: outer, slots: map[string]int{}}
+    for _, param := range params {
+        r.declare(param)
+    }
+    r.block(body)
+
+    for _, ref := range r.scope.refs {
+        if slot, ok := r.scope.slots[ref.ident.Value]; ok {
+            bind(ref.ident, ast.Local, ref.depth, slot)
+            continue
+        }
+        outer.refs = append(outer.refs, reference{ident: ref.ident, depth: ref.depth + 1})
+    }
+    names := r.scope.names
+    r.scope = outer
+    return names
+}
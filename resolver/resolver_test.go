@@ -0,0 +1,170 @@
+package resolver
+
+import (
+    "reflect"
+    "testing"
+
+    "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/lexer"
+    "necronet.info/interpreter/parser"
+)
+
+func resolve(t *testing.T, input string, defined ...string) (*ast.Program, []*Error) {
+    t.Helper()
+    p := parser.New(lexer.New(input))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        t.Fatalf("%q: parser errors: %v", input, p.Errors())
+    }
+    errs := Resolve(program, func(name string) bool {
+        for _, d := range defined {
+            if d == name {
+                return true
+            }
+        }
+        return false
+    })
+    return program, errs
+}
+
+// identifiers lists the identifiers of node in source order. It walks
+// the fields by reflection to stay independent of the resolver's own
+// traversal.
+func identifiers(node ast.Node) []*ast.Identifier {
+    var idents []*ast.Identifier
+    var visit func(v reflect.Value)
+    identType := reflect.TypeOf(&ast.Identifier{})
+    visit = func(v reflect.Value) {
+        switch v.Kind() {
+        case reflect.Interface:
+            if !v.IsNil() {
+                visit(v.Elem())
+            }
+        case reflect.Ptr:
+            if v.IsNil() {
+                return
+            }
+            if v.Type() == identType {
+                idents = append(idents, v.Interface().(*ast.Identifier))
+                return
+            }
+            visit(v.Elem())
+        case reflect.Struct:
+            for i := 0; i < v.NumField(); i++ {
+                visit(v.Field(i))
+            }
+        case reflect.Slice:
+            for i := 0; i < v.Len(); i++ {
+                visit(v.Index(i))
+            }
+        }
+    }
+    visit(reflect.ValueOf(node))
+    return idents
+}
+
+type binding struct {
+    name    string
+    binding ast.Binding
+    depth   int
+    slot    int
+}
+
+func TestResolve(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected []binding
+    }{
+        {`let a = 1; a`, []binding{
+            {"a", ast.Global, 0, 0}, {"a", ast.Global, 0, 0},
+        }},
+        {`fn(a, b) { let c = a; b }`, []binding{
+            {"a", ast.Local, 0, 0}, {"b", ast.Local, 0, 1},
+            {"c", ast.Local, 0, 2}, {"a", ast.Local, 0, 0}, {"b", ast.Local, 0, 1},
+        }},
+        {`fn(a) { fn(b) { fn() { a + b } } }`, []binding{
+            {"a", ast.Local, 0, 0}, {"b", ast.Local, 0, 0},
+            {"a", ast.Local, 2, 0}, {"b", ast.Local, 1, 0},
+        }},
+        // Blocks share the scope of their function, and a let of a
+        // parameter reuses its slot.
+        {`fn(x) { if (x) { let y = 1 }; for (i in x) { let x = i }; y }`, []binding{
+            {"x", ast.Local, 0, 0}, {"x", ast.Local, 0, 0},
+            {"y", ast.Local, 0, 1},
+            {"i", ast.Local, 0, 2}, {"x", ast.Local, 0, 0}, {"x", ast.Local, 0, 0}, {"i", ast.Local, 0, 2},
+            {"y", ast.Local, 0, 1},
+        }},
+        // Variables declared later in the scope are still bound to it.
+        {`let f = fn() { g() }; let g = fn() { h }; let h = 1`, []binding{
+            {"f", ast.Global, 0, 0}, {"g", ast.Global, 0, 0},
+            {"g", ast.Global, 0, 0}, {"h", ast.Global, 0, 0},
+            {"h", ast.Global, 0, 0},
+        }},
+        {`fn() { let r = fn() { r() }; r }`, []binding{
+            {"r", ast.Local, 0, 0}, {"r", ast.Local, 1, 0}, {"r", ast.Local, 0, 0},
+        }},
+        {`fn(len) { puts(len) }`, []binding{
+            {"len", ast.Local, 0, 0}, {"puts", ast.Global, 0, 0}, {"len", ast.Local, 0, 0},
+        }},
+    }
+
+    for _, tt := range tests {
+        program, errs := resolve(t, tt.input, "puts", "len")
+        if len(errs) != 0 {
+            t.Errorf("%q: unexpected errors %v", tt.input, errs)
+            continue
+        }
+        var got []binding
+        for _, ident := range identifiers(program) {
+            got = append(got, binding{ident.Value, ident.Binding, ident.Depth, ident.Slot})
+        }
+        if !reflect.DeepEqual(got, tt.expected) {
+            t.Errorf("%q:\n got %v\nwant %v", tt.input, got, tt.expected)
+        }
+    }
+}
+
+func TestLocals(t *testing.T) {
+    program, _ := resolve(t, `fn(a, b) { let c = fn(d) { d }; for (e in a) { let a = e } }`)
+    fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+    if expected := []string{"a", "b", "c", "e"}; !reflect.DeepEqual(fn.Locals, expected) {
+        t.Errorf("wrong locals. got=%v, want=%v", fn.Locals, expected)
+    }
+
+    program, _ = resolve(t, `macro(a) { let b = a; quote(unquote(b)) }`)
+    macro := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MacroLiteral)
+    if expected := []string{"a", "b"}; !reflect.DeepEqual(macro.Locals, expected) {
+        t.Errorf("wrong macro locals. got=%v, want=%v", macro.Locals, expected)
+    }
+}
+
+func TestErrors(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected []string
+    }{
+        {`foobar`, []string{"1:1: identifier not found: foobar"}},
+        {`if (false) { x }`, []string{"1:14: identifier not found: x"}},
+        {"let f = fn() {\n  g(y)\n}; z", []string{
+            "2:3: identifier not found: g",
+            "2:5: identifier not found: y",
+            "3:4: identifier not found: z",
+        }},
+        // A variable of a function is not visible to its caller.
+        {`let f = fn() { let x = 1 }; x`, []string{"1:29: identifier not found: x"}},
+        {`len(x)`, []string{"1:5: identifier not found: x"}},
+        // Quoted code is only checked where it is unquoted.
+        {`quote(a + unquote(b))`, []string{"1:19: identifier not found: b"}},
+    }
+
+    for _, tt := range tests {
+        _, errs := resolve(t, tt.input, "len")
+        var got []string
+        for _, err := range errs {
+            got = append(got, err.Error())
+        }
+        if !reflect.DeepEqual(got, tt.expected) {
+            t.Errorf("%q:\n got %q\nwant %q", tt.input, got, tt.expected)
+        }
+    }
+}
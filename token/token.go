@@ -1,10 +1,29 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type TokenType
 	Literal string
+	Pos Position
+}
+
+// Position is a place in the source. Lines and columns start at 1;
+// columns count bytes. The zero Position is unknown.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Before reports whether p comes before q in the source.
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
 }
 
 // Defining literals
@@ -12,6 +31,9 @@ type Token struct {
 const(
 	ILLEGAL	= "ILLEGAL"
 	EOF = "EOF"
+	// COMMENT is a // comment. The lexer skips comments, see
+	// lexer.Lexer.Comments.
+	COMMENT = "COMMENT"
 
 	IDENT = "IDENT"
 	INT = "INT"
@@ -28,6 +50,10 @@ const(
         SLASH    = "/"
         LT = "<"
         GT = ">"
+    PIPE = "|"
+    AMPERSAND = "&"
+    DOTDOT = ".."
+    DOTDOT_EQ = "..="
 
 	COMMA = ","
 	SEMICOLON = ";"
@@ -49,6 +75,13 @@ const(
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	FOR      = "FOR"
+	IN       = "IN"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
+	MACRO    = "MACRO"
 )
 
 var keywords = map[string]TokenType {
@@ -59,6 +92,13 @@ var keywords = map[string]TokenType {
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"export": EXPORT,
+	"for":    FOR,
+	"in":     IN,
+	"yield":  YIELD,
+	"spawn":  SPAWN,
+	"macro":  MACRO,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,753 @@
+package vm
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/compiler"
+    "necronet.info/interpreter/evaluator"
+    "necronet.info/interpreter/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+// traceDepth is how many values from the top of the stack a trace shows.
+const traceDepth = 3
+
+var errStackOverflow = errors.New("stack overflow")
+
+// binaryOperators maps the opcodes whose semantics are shared with the
+// evaluator to the operator they stand for.
+var binaryOperators = map[code.Opcode]string{
+    code.OpAdd: "+",
+    code.OpSub: "-",
+    code.OpMul: "*",
+    code.OpDiv: "/",
+    code.OpEqual: "==",
+    code.OpNotEqual: "!=",
+    code.OpGreaterThan: ">",
+    code.OpLessThan: "<",
+    code.OpUnion: "|",
+    code.OpIntersection: "&",
+    code.OpRange: "..",
+    code.OpRangeInclusive: "..=",
+}
+
+// VM runs compiled bytecode. Values, operators and builtins are those of
+// an evaluator.Interpreter, so a program gives the same result in both.
+// Errors that Eval returns as *object.Error are returned by Run instead.
+type VM struct {
+    in *evaluator.Interpreter
+    call *object.CallContext
+
+    bytecode *compiler.Bytecode
+    constants []object.Object
+
+    stack []object.Object
+    sp int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+    globals []object.Object
+    globalNames []string
+
+    frames []*Frame
+    framesIndex int
+
+    result object.Object
+
+    trace io.Writer
+}
+
+// New returns a VM with the standard builtins.
+func New(bytecode *compiler.Bytecode) *VM {
+    return NewWithInterpreter(bytecode, evaluator.New())
+}
+
+// NewWithInterpreter returns a VM that uses the builtins, context and
+// strict mode of in.
+func NewWithInterpreter(bytecode *compiler.Bytecode, in *evaluator.Interpreter) *VM {
+    return NewWithGlobalsStore(bytecode, in, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore returns a VM that keeps its globals in s, so that a
+// later program compiled with the same symbol table can see them.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, in *evaluator.Interpreter, s []object.Object) *VM {
+    mainFn := bytecode.MainFunction()
+    mainClosure := &object.Closure{Fn: mainFn}
+
+    frames := make([]*Frame, MaxFrames)
+    frames[0] = NewFrame(mainClosure, 1)
+
+    vm := &VM{
+        in: in,
+        bytecode: bytecode,
+        constants: bytecode.Constants,
+
+        stack: make([]object.Object, StackSize),
+        sp: 1,
+
+        globals: s,
+        globalNames: bytecode.Globals,
+
+        frames: frames,
+        framesIndex: 1,
+    }
+    vm.stack[0] = mainClosure
+    vm.call = &object.CallContext{
+        Context: in.Context(),
+        Env: object.NewEnvironment(),
+        Apply: vm.apply,
+    }
+
+    for i, name := range bytecode.Globals {
+        if i < len(s) && s[i] == nil {
+            if builtin, ok := in.Builtin(name); ok {
+                s[i] = builtin
+            }
+        }
+    }
+    return vm
+}
+
+// SetTrace makes the VM write a line to w for each instruction it
+// executes, showing the top of the stack before it runs. A nil w turns
+// tracing off.
+func (vm *VM) SetTrace(w io.Writer) {
+    vm.trace = w
+}
+
+// Result returns the value of the program after Run, like Eval would.
+func (vm *VM) Result() object.Object {
+    return vm.result
+}
+
+// RuntimeError is returned by Run. Its message is the one Eval would give;
+// Line is the source line of the failing instruction, or 0 if unknown.
+type RuntimeError struct {
+    Err error
+    Line int
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// Run executes the program until it returns.
+func (vm *VM) Run() error {
+    if len(vm.globalNames) > len(vm.globals) {
+        return fmt.Errorf("too many globals: %d", len(vm.globalNames))
+    }
+    if err := vm.run(0); err != nil {
+        frame := vm.frames[vm.framesIndex-1]
+        return &RuntimeError{Err: err, Line: frame.cl.Fn.SourceMap.Line(frame.ip)}
+    }
+    vm.result = vm.pop()
+    return nil
+}
+
+// run executes instructions until the frame at stopAt returns. The value
+// it returned is left on top of the stack.
+func (vm *VM) run(stopAt int) error {
+    for {
+        frame := vm.frames[vm.framesIndex-1]
+        frame.ip++
+
+        ip := frame.ip
+        ins := frame.Instructions()
+        op := code.Opcode(ins[ip])
+
+        if vm.trace != nil {
+            vm.traceInstruction(frame)
+        }
+
+        switch op {
+        case code.OpConstant:
+            constIndex := code.ReadUint16(ins[ip+1:])
+            frame.ip += 2
+
+            if err := vm.push(vm.constants[constIndex]); err != nil {
+                return err
+            }
+
+        case code.OpPop:
+            vm.pop()
+
+        case code.OpTrue:
+            if err := vm.push(evaluator.TRUE); err != nil {
+                return err
+            }
+
+        case code.OpFalse:
+            if err := vm.push(evaluator.FALSE); err != nil {
+                return err
+            }
+
+        case code.OpNull:
+            if err := vm.push(evaluator.NULL); err != nil {
+                return err
+            }
+
+        case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+            code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+            code.OpUnion, code.OpIntersection, code.OpRange, code.OpRangeInclusive:
+            if err := vm.executeBinaryOperation(op); err != nil {
+                return err
+            }
+
+        case code.OpBang:
+            if err := vm.pushResult(evaluator.Prefix("!", vm.pop())); err != nil {
+                return err
+            }
+
+        case code.OpMinus:
+            operand := vm.pop()
+            if integer, ok := operand.(*object.Integer); ok {
+                if err := vm.push(object.NewInteger(-integer.Value)); err != nil {
+                    return err
+                }
+                break
+            }
+            if err := vm.pushResult(evaluator.Prefix("-", operand)); err != nil {
+                return err
+            }
+
+        case code.OpJump:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            frame.ip = pos - 1
+
+        case code.OpJumpNotTruthy:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            frame.ip += 2
+
+            condition := vm.pop()
+            if !evaluator.IsTruthy(condition) {
+                frame.ip = pos - 1
+            }
+
+        case code.OpSetGlobal:
+            globalIndex := code.ReadUint16(ins[ip+1:])
+            frame.ip += 2
+
+            vm.globals[globalIndex] = vm.pop()
+
+        case code.OpGetGlobal:
+            globalIndex := code.ReadUint16(ins[ip+1:])
+            frame.ip += 2
+
+            global := vm.globals[globalIndex]
+            if global == nil {
+                return fmt.Errorf("identifier not found: %s", vm.globalNames[globalIndex])
+            }
+            if err := vm.push(global); err != nil {
+                return err
+            }
+
+        case code.OpSetLocal:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            slot := &vm.stack[frame.basePointer+int(localIndex)]
+            if cell, ok := (*slot).(*object.Cell); ok {
+                cell.Value = vm.pop()
+            } else {
+                *slot = vm.pop()
+            }
+
+        case code.OpGetLocal:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            local := vm.local(frame, int(localIndex))
+            if local == nil {
+                builtin, err := vm.unset(frame.cl.Fn.LocalNames[localIndex])
+                if err != nil {
+                    return err
+                }
+                local = builtin
+            }
+            if err := vm.push(local); err != nil {
+                return err
+            }
+
+        case code.OpGetLocalElse:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 3
+
+            if local := vm.local(frame, int(localIndex)); local != nil {
+                if err := vm.push(local); err != nil {
+                    return err
+                }
+                frame.ip = int(code.ReadUint16(ins[ip+2:])) - 1
+            }
+
+        case code.OpGetLocalCell:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            slot := &vm.stack[frame.basePointer+int(localIndex)]
+            if _, ok := (*slot).(*object.Cell); !ok {
+                *slot = &object.Cell{Name: frame.cl.Fn.LocalNames[localIndex], Value: *slot}
+            }
+            if err := vm.push(*slot); err != nil {
+                return err
+            }
+
+        case code.OpGetFree:
+            freeIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            free := frame.cl.Free[freeIndex]
+            if cell, ok := free.(*object.Cell); ok {
+                free = cell.Value
+                if free == nil {
+                    builtin, err := vm.unset(cell.Name)
+                    if err != nil {
+                        return err
+                    }
+                    free = builtin
+                }
+            }
+            if err := vm.push(free); err != nil {
+                return err
+            }
+
+        case code.OpGetFreeElse:
+            freeIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 3
+
+            free := frame.cl.Free[freeIndex]
+            if cell, ok := free.(*object.Cell); ok {
+                free = cell.Value
+            }
+            if free != nil {
+                if err := vm.push(free); err != nil {
+                    return err
+                }
+                frame.ip = int(code.ReadUint16(ins[ip+2:])) - 1
+            }
+
+        case code.OpGetFreeCell:
+            freeIndex := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            if err := vm.push(frame.cl.Free[freeIndex]); err != nil {
+                return err
+            }
+
+        case code.OpCurrentClosure:
+            if err := vm.push(frame.cl); err != nil {
+                return err
+            }
+
+        case code.OpArray:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            frame.ip += 2
+
+            elements := make([]object.Object, numElements)
+            copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+            vm.sp = vm.sp - numElements
+
+            if err := vm.push(&object.Array{Elements: elements}); err != nil {
+                return err
+            }
+
+        case code.OpHash:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            frame.ip += 2
+
+            hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+            if err != nil {
+                return err
+            }
+            vm.sp = vm.sp - numElements
+
+            if err := vm.push(hash); err != nil {
+                return err
+            }
+
+        case code.OpSet:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            frame.ip += 2
+
+            set, err := vm.buildSet(vm.sp-numElements, vm.sp)
+            if err != nil {
+                return err
+            }
+            vm.sp = vm.sp - numElements
+
+            if err := vm.push(set); err != nil {
+                return err
+            }
+
+        case code.OpIndex:
+            index := vm.pop()
+            left := vm.pop()
+
+            if err := vm.pushResult(vm.in.Index(left, index)); err != nil {
+                return err
+            }
+
+        case code.OpSlice:
+            flags := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            bounds := make([]object.Object, 3)
+            for i := len(bounds) - 1; i >= 0; i-- {
+                if flags&(1<<i) != 0 {
+                    bounds[i] = vm.pop()
+                }
+            }
+            left := vm.pop()
+
+            if err := vm.pushResult(evaluator.Slice(left, bounds[0], bounds[1], bounds[2])); err != nil {
+                return err
+            }
+
+        case code.OpIter:
+            iterable := vm.pop()
+            it, ok := iterable.(object.Iterable)
+            if !ok {
+                return fmt.Errorf("cannot iterate over %s", iterable.Type())
+            }
+            if err := vm.push(&iterator{it: it.Iterate()}); err != nil {
+                return err
+            }
+
+        case code.OpIterNext:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            frame.ip += 2
+
+            it, ok := vm.stack[vm.sp-1].(*iterator)
+            if !ok {
+                return fmt.Errorf("cannot iterate over %s", vm.stack[vm.sp-1].Type())
+            }
+            el, ok := it.it.Next()
+            if !ok {
+                vm.pop()
+                frame.ip = pos - 1
+                break
+            }
+            if err, ok := el.(*object.Error); ok {
+                return errors.New(err.Message)
+            }
+            if err := vm.in.Context().Err(); err != nil {
+                return err
+            }
+            if err := vm.push(el); err != nil {
+                return err
+            }
+
+        case code.OpCall:
+            numArgs := code.ReadUint8(ins[ip+1:])
+            frame.ip += 1
+
+            if err := vm.executeCall(int(numArgs)); err != nil {
+                return err
+            }
+
+        case code.OpReturnValue:
+            returnValue := vm.pop()
+
+            frame := vm.popFrame()
+            vm.sp = frame.basePointer - 1
+
+            vm.stack[vm.sp] = returnValue
+            vm.sp++
+
+            if vm.framesIndex == stopAt {
+                return nil
+            }
+
+        case code.OpClosure:
+            constIndex := code.ReadUint16(ins[ip+1:])
+            numFree := code.ReadUint8(ins[ip+3:])
+            frame.ip += 3
+
+            if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+                return err
+            }
+
+        default:
+            return fmt.Errorf("unknown opcode %d", op)
+        }
+    }
+}
+
+func (vm *VM) traceInstruction(frame *Frame) {
+    fn := frame.cl.Fn
+    text, _ := vm.bytecode.FormatInstruction(fn, frame.ip)
+
+    top := []string{}
+    for i := vm.sp - 1; i >= 0 && i >= vm.sp-traceDepth; i-- {
+        top = append([]string{traceValue(vm.stack[i])}, top...)
+    }
+    if vm.sp > traceDepth {
+        top = append([]string{"..."}, top...)
+    }
+
+    fmt.Fprintf(vm.trace, "%-12s %04d %4d  %-32s [%s]\n",
+        frame.cl.Inspect(), frame.ip, fn.SourceMap.Line(frame.ip), text, strings.Join(top, ", "))
+}
+
+func traceValue(obj object.Object) string {
+    switch obj := obj.(type) {
+    case nil:
+        return "nil"
+    case *object.String:
+        return fmt.Sprintf("%q", obj.Value)
+    default:
+        return obj.Inspect()
+    }
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+    right := vm.pop()
+    left := vm.pop()
+
+    if leftVal, ok := left.(*object.Integer); ok {
+        if rightVal, ok := right.(*object.Integer); ok {
+            return vm.executeBinaryIntegerOperation(op, leftVal.Value, rightVal.Value)
+        }
+    }
+    return vm.pushResult(evaluator.Infix(binaryOperators[op], left, right))
+}
+
+// executeBinaryIntegerOperation is the fast path for the common case,
+// skipping the evaluator's dispatch on types.
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right int64) error {
+    switch op {
+    case code.OpAdd:
+        return vm.push(object.NewInteger(left + right))
+    case code.OpSub:
+        return vm.push(object.NewInteger(left - right))
+    case code.OpMul:
+        return vm.push(object.NewInteger(left * right))
+    case code.OpDiv:
+        if right == 0 {
+            return errors.New("division by zero")
+        }
+        return vm.push(object.NewInteger(left / right))
+    case code.OpEqual:
+        return vm.push(nativeBoolToBooleanObject(left == right))
+    case code.OpNotEqual:
+        return vm.push(nativeBoolToBooleanObject(left != right))
+    case code.OpGreaterThan:
+        return vm.push(nativeBoolToBooleanObject(left > right))
+    case code.OpLessThan:
+        return vm.push(nativeBoolToBooleanObject(left < right))
+    default:
+        return vm.pushResult(evaluator.Infix(binaryOperators[op],
+            object.NewInteger(left), object.NewInteger(right)))
+    }
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+    hash := object.NewHash()
+
+    for i := startIndex; i < endIndex; i += 2 {
+        key, err := object.AsHashable(vm.stack[i])
+        if err != nil {
+            return nil, err
+        }
+        hash.Set(key, vm.stack[i+1])
+    }
+
+    return hash, nil
+}
+
+func (vm *VM) buildSet(startIndex, endIndex int) (object.Object, error) {
+    set := object.NewSet()
+
+    for i := startIndex; i < endIndex; i++ {
+        member, err := object.AsHashable(vm.stack[i])
+        if err != nil {
+            return nil, err
+        }
+        set.Add(member)
+    }
+
+    return set, nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+    callee := vm.stack[vm.sp-1-numArgs]
+    switch callee := callee.(type) {
+    case *object.Closure:
+        return vm.callClosure(callee, numArgs)
+    case *object.Builtin:
+        return vm.callBuiltin(callee, numArgs)
+    default:
+        return fmt.Errorf("not a function: %s", callee.Type())
+    }
+}
+
+// callClosure pushes a frame for cl, whose arguments are on top of the
+// stack. Like in the evaluator, missing arguments are an error and extra
+// ones are ignored.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+    if err := vm.in.Context().Err(); err != nil {
+        return err
+    }
+    if numArgs < cl.Fn.NumParameters {
+        return fmt.Errorf("wrong number of arguments. got=%d, want=%d",
+            numArgs, cl.Fn.NumParameters)
+    }
+    if vm.framesIndex >= MaxFrames {
+        return errStackOverflow
+    }
+
+    basePointer := vm.sp - numArgs
+    sp := basePointer + cl.Fn.NumLocals
+    if sp >= StackSize {
+        return errStackOverflow
+    }
+    for i := basePointer + cl.Fn.NumParameters; i < sp; i++ {
+        vm.stack[i] = nil
+    }
+
+    vm.pushFrame(NewFrame(cl, basePointer))
+    vm.sp = sp
+    return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+    args := make([]object.Object, numArgs)
+    copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+    result := vm.applyBuiltin(builtin, args)
+    vm.sp = vm.sp - numArgs - 1
+
+    return vm.pushResult(result)
+}
+
+func (vm *VM) applyBuiltin(builtin *object.Builtin, args []object.Object) object.Object {
+    var result object.Object
+    if builtin.ContextFn != nil {
+        result = builtin.ContextFn(vm.call, args...)
+    } else {
+        result = builtin.Fn(args...)
+    }
+    if result == nil {
+        return evaluator.NULL
+    }
+    return result
+}
+
+// apply calls fn on behalf of a builtin, such as the callback of map. A
+// closure runs on top of the current stack until it returns.
+func (vm *VM) apply(fn object.Object, args ...object.Object) object.Object {
+    switch fn := fn.(type) {
+    case *object.Closure:
+        sp, framesIndex := vm.sp, vm.framesIndex
+        err := vm.push(fn)
+        for i := 0; err == nil && i < len(args); i++ {
+            err = vm.push(args[i])
+        }
+        if err == nil {
+            err = vm.callClosure(fn, len(args))
+        }
+        if err == nil {
+            err = vm.run(framesIndex)
+        }
+        if err != nil {
+            vm.sp, vm.framesIndex = sp, framesIndex
+            return &object.Error{Message: err.Error()}
+        }
+        result := vm.pop()
+        vm.sp = sp
+        return result
+    case *object.Builtin:
+        return vm.applyBuiltin(fn, args)
+    default:
+        return &object.Error{Message: fmt.Sprintf("not a function: %s", fn.Type())}
+    }
+}
+
+// local returns the value of a local of frame, reading through the cell
+// holding it once a closure has captured it. It is nil while the local is
+// not set.
+func (vm *VM) local(frame *Frame, index int) object.Object {
+    local := vm.stack[frame.basePointer+index]
+    if cell, ok := local.(*object.Cell); ok {
+        return cell.Value
+    }
+    return local
+}
+
+// unset handles reading a variable called name before it is set, when no
+// variable of that name further out is set either. Like in the evaluator,
+// the builtin of that name is used, if any.
+func (vm *VM) unset(name string) (object.Object, error) {
+    if builtin, ok := vm.in.Builtin(name); ok {
+        return builtin, nil
+    }
+    return nil, fmt.Errorf("identifier not found: %s", name)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+    constant := vm.constants[constIndex]
+    function, ok := constant.(*object.CompiledFunction)
+    if !ok {
+        return fmt.Errorf("not a function: %+v", constant)
+    }
+
+    free := make([]object.Object, numFree)
+    copy(free, vm.stack[vm.sp-numFree:vm.sp])
+    vm.sp = vm.sp - numFree
+
+    return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+    vm.frames[vm.framesIndex] = f
+    vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+    vm.framesIndex--
+    return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) error {
+    if vm.sp >= StackSize {
+        return errStackOverflow
+    }
+
+    vm.stack[vm.sp] = o
+    vm.sp++
+
+    return nil
+}
+
+// pushResult pushes the result of an evaluator operation, turning an
+// *object.Error into a Go error.
+func (vm *VM) pushResult(o object.Object) error {
+    if err, ok := o.(*object.Error); ok {
+        return errors.New(err.Message)
+    }
+    return vm.push(o)
+}
+
+func (vm *VM) pop() object.Object {
+    o := vm.stack[vm.sp-1]
+    vm.sp--
+    return o
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+    if input {
+        return evaluator.TRUE
+    }
+    return evaluator.FALSE
+}
+
+// iterator holds the state of a for loop on the stack.
+type iterator struct {
+    it object.Iterator
+}
+
+func (i *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (i *iterator) Inspect() string { return "iterator" }
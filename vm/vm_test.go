@@ -0,0 +1,446 @@
+package vm
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    monkeyast "necronet.info/interpreter/ast"
+    "necronet.info/interpreter/code"
+    "necronet.info/interpreter/compiler"
+    "necronet.info/interpreter/evaluator"
+    "necronet.info/interpreter/internal/monkeytest"
+    "necronet.info/interpreter/object"
+    "necronet.info/interpreter/resolver"
+)
+
+func runVM(in *evaluator.Interpreter, program *monkeyast.Program) (object.Object, error) {
+    program, err := in.ExpandMacros(program, object.NewEnvironment())
+    if err != nil {
+        return nil, err
+    }
+    comp := compiler.New()
+    if err := comp.Compile(program); err != nil {
+        return nil, err
+    }
+    machine := NewWithInterpreter(comp.Bytecode(), in)
+    if err := machine.Run(); err != nil {
+        return nil, err
+    }
+    return machine.Result(), nil
+}
+
+func testRun(t *testing.T, input string) (object.Object, error) {
+    t.Helper()
+    program := monkeytest.MustParse(t, input)
+    return runVM(evaluator.New(), program)
+}
+
+// TestAgreesWithEval runs every program of monkeytest.Programs on both
+// engines. Programs using features the compiler does not support are
+// skipped, and so are those referring to undeclared names, which the
+// evaluator rejects before running them. Programs that block forever,
+// such as receiving from a channel nobody sends on, must time out on both.
+func TestAgreesWithEval(t *testing.T) {
+    compared := 0
+    for _, input := range monkeytest.Programs {
+        program, _ := monkeytest.Parse(input)
+        if !resolves(program) {
+            continue
+        }
+        if agreesWithEval(t, input, program) {
+            compared++
+        }
+    }
+
+    if compared < 200 {
+        t.Errorf("only %d programs compared", compared)
+    }
+}
+
+// TestScopingAgreesWithEval checks that variables are scoped by function
+// on both engines: closures see the lets of the enclosing function that
+// come after them and the values it sets later, and a local read before
+// it is set is the variable of the same name further out.
+func TestScopingAgreesWithEval(t *testing.T) {
+    inputs := []string{
+        `fn() { let g = fn() { y }; let y = 5; g() }()`,
+        `fn() {
+            let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+            let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+            even(10)
+        }()`,
+        `fn() { let x = 1; let f = fn() { x }; let x = 2; f() }()`,
+        `fn(x) { let f = fn() { x }; let x = 5; f() }(1)`,
+        `let f = fn() { let x = x; x }; let x = 1; f()`,
+        `let n = 5; let f = fn() { let n = n * 2; n }; f()`,
+        `fn() { let n = 3; fn() { let n = n * 2; n }() }()`,
+        `fn() { let n = 3; fn() { fn() { let n = n + 1; n }() }() }()`,
+        `fn() { let len = len([1, 2]); len }()`,
+        `fn() { let f = fn() { len }; let len = 1; f() }()`,
+        `fn() { let f = fn() { z }; f() }()`,
+        `fn() { let fs = []; for (i in 0..3) { let fs = push(fs, fn() { i }) }; map(fs, fn(f) { f() }) }()`,
+        `let counter = fn() { let n = 0; let next = fn() { n + 1 }; let n = next(); let n = next(); n }; counter()`,
+    }
+
+    for _, input := range inputs {
+        program := monkeytest.MustParse(t, input)
+        if !agreesWithEval(t, input, program) {
+            t.Errorf("%q: not compared", input)
+        }
+    }
+}
+
+// agreesWithEval runs program on both engines and reports a difference
+// as an error. It returns false if the compiler does not support it.
+func agreesWithEval(t *testing.T, input string, program *monkeyast.Program) bool {
+    t.Helper()
+    ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+    result, err := runVM(evaluator.New().WithContext(ctx), program)
+    cancel()
+    if err != nil && strings.Contains(err.Error(), "not supported by the compiler") {
+        return false
+    }
+
+    // The evaluator is slower, notably under the race detector, so it gets
+    // more time unless the VM ran out of time too. Errors of builtins only
+    // keep their message, so the deadline is matched by text.
+    timeout := 30 * time.Second
+    if err != nil && err.Error() == context.DeadlineExceeded.Error() {
+        timeout = 500 * time.Millisecond
+    }
+    ctx, cancel = context.WithTimeout(context.Background(), timeout)
+    expected := evaluator.New().WithContext(ctx).Eval(program, object.NewEnvironment())
+    cancel()
+
+    if expectedErr, ok := expected.(*object.Error); ok {
+        if err == nil || err.Error() != expectedErr.Message {
+            t.Errorf("%q: expected error %q, got result=%v err=%v",
+                input, expectedErr.Message, result, err)
+        }
+        return true
+    }
+    if err != nil {
+        t.Errorf("%q: vm error: %s", input, err)
+        return true
+    }
+    if !sameResult(expected, result) {
+        t.Errorf("%q: eval gave %s, vm gave %s", input, inspect(expected), inspect(result))
+    }
+    return true
+}
+
+func resolves(program *monkeyast.Program) bool {
+    in := evaluator.New()
+    errs := resolver.Resolve(program, func(name string) bool {
+        _, ok := in.Builtin(name)
+        return ok
+    })
+    return len(errs) == 0
+}
+
+func sameResult(expected, actual object.Object) bool {
+    if expected == nil {
+        expected = evaluator.NULL
+    }
+    switch expected.Type() {
+    case object.FUNCTION_OBJ, object.BUILTIN_OBJ, object.CHANNEL_OBJ, object.TASK_OBJ:
+        // Compared by identity, so only the types can agree.
+        return actual.Type() == expected.Type()
+    }
+    return object.Equals(expected, actual)
+}
+
+func inspect(obj object.Object) string {
+    if obj == nil {
+        return "nil"
+    }
+    return string(obj.Type()) + " " + obj.Inspect()
+}
+
+func TestClosures(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    }{
+        {`let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)`, 5},
+        {`let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d } }; newAdder(1, 2)(8)`, 11},
+        {`
+        let newAdderOuter = fn(a, b) {
+            let c = a + b;
+            fn(d) {
+                let e = d + c;
+                fn(f) { e + f; };
+            };
+        };
+        let newAdderInner = newAdderOuter(1, 2);
+        let adder = newAdderInner(3);
+        adder(8);`, 14},
+        {`let a = 1; let f = fn(b) { fn(c) { a + b + c } }; f(2)(3)`, 6},
+        {`
+        let countDown = fn(x) {
+            if (x == 0) { return 0; }
+            countDown(x - 1);
+        };
+        countDown(1);`, 0},
+        {`
+        let wrapper = fn() {
+            let countDown = fn(x) {
+                if (x == 0) { return 0; }
+                countDown(x - 1);
+            };
+            countDown(10);
+        };
+        wrapper();`, 0},
+        {`
+        let fib = fn(n) {
+            if (n < 2) { return n; }
+            fib(n - 1) + fib(n - 2)
+        };
+        fib(15);`, 610},
+        {`let total = fn(xs) { let t = 0; for (x in xs) { let t = t + x }; t }; total(1..=10)`, 55},
+        {`let xs = map([1, 2, 3], fn(x) { x * 10 }); reduce(xs, fn(acc, x) { acc + x }, 0)`, 60},
+        {`let f = fn(a) { a }; f(1, 2, 3)`, 1},
+        {`let f = fn(x) { x }; len(map([1, 2], f)) + f(3)`, 5},
+    }
+
+    for _, tt := range tests {
+        result, err := testRun(t, tt.input)
+        if err != nil {
+            t.Errorf("%q: vm error: %s", tt.input, err)
+            continue
+        }
+        integer, ok := result.(*object.Integer)
+        if !ok || integer.Value != tt.expected {
+            t.Errorf("%q: expected %d, got %s", tt.input, tt.expected, inspect(result))
+        }
+    }
+}
+
+func TestRuntimeErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`fn(a, b) { a }(1)`, "wrong number of arguments. got=1, want=2"},
+        {`1(2)`, "not a function: INTEGER"},
+        {`let f = fn() { if (false) { let x = 1; }; x }; f()`, "identifier not found: x"},
+        {`let f = fn(n) { f(n + 1) }; f(0)`, "stack overflow"},
+        {`map([1, 2], fn(x) { x / 0 })`, "division by zero"},
+        {`map([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+    }
+
+    for _, tt := range tests {
+        _, err := testRun(t, tt.input)
+        if err == nil || err.Error() != tt.expected {
+            t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+        }
+    }
+}
+
+func TestUnsupportedFeatures(t *testing.T) {
+    tests := []string{
+        `import "foo"`,
+        `let g = fn() { yield 1 }`,
+        `spawn f()`,
+    }
+
+    for _, input := range tests {
+        program, _ := monkeytest.Parse(input)
+        err := compiler.New().Compile(program)
+        if err == nil || !strings.Contains(err.Error(), "not supported by the compiler") {
+            t.Errorf("%q: expected an unsupported feature error, got %v", input, err)
+        }
+    }
+}
+
+func TestRegisteredBuiltins(t *testing.T) {
+    in := evaluator.New()
+    var traced []string
+    in.Register("trace", func(args ...object.Object) object.Object {
+        traced = append(traced, args[0].Inspect())
+        return args[0]
+    })
+
+    program, _ := monkeytest.Parse(`{trace("b"): trace(1), trace("a"): trace(2)}["a"]`)
+    result, err := runVM(in, program)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !object.Equals(result, &object.Integer{Value: 2}) {
+        t.Errorf("expected 2, got %s", inspect(result))
+    }
+    if strings.Join(traced, " ") != "b 1 a 2" {
+        t.Errorf("expected hash literal to be evaluated in source order, got %v", traced)
+    }
+}
+
+func TestGlobalsPersistAcrossPrograms(t *testing.T) {
+    in := evaluator.New()
+    globals := make([]object.Object, GlobalsSize)
+    symbolTable := compiler.NewSymbolTable()
+    var constants []object.Object
+
+    var result object.Object
+    for _, input := range []string{`let x = 40;`, `let f = fn() { x + 2 };`, `f()`} {
+        program, _ := monkeytest.Parse(input)
+        comp := compiler.NewWithState(symbolTable, constants)
+        if err := comp.Compile(program); err != nil {
+            t.Fatal(err)
+        }
+        bytecode := comp.Bytecode()
+        constants = bytecode.Constants
+
+        machine := NewWithGlobalsStore(bytecode, in, globals)
+        if err := machine.Run(); err != nil {
+            t.Fatal(err)
+        }
+        result = machine.Result()
+    }
+    if !object.Equals(result, &object.Integer{Value: 42}) {
+        t.Errorf("expected 42, got %s", inspect(result))
+    }
+}
+
+func TestRunStopsWhenContextIsDone(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    in := evaluator.New().WithContext(ctx)
+
+    program, _ := monkeytest.Parse(`for (x in 0..10) { x }`)
+    _, err := runVM(in, program)
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("expected context.Canceled, got %v", err)
+    }
+}
+
+const fibProgram = `
+let fib = fn(n) {
+    if (n < 2) { return n; }
+    fib(n - 1) + fib(n - 2)
+};
+fib(25);`
+
+func BenchmarkFibEval(b *testing.B) {
+    program, _ := monkeytest.Parse(fibProgram)
+    for i := 0; i < b.N; i++ {
+        evaluator.New().Eval(program, object.NewEnvironment())
+    }
+}
+
+func BenchmarkFibVM(b *testing.B) {
+    program, _ := monkeytest.Parse(fibProgram)
+    comp := compiler.New()
+    if err := comp.Compile(program); err != nil {
+        b.Fatal(err)
+    }
+    bytecode := comp.Bytecode()
+    for i := 0; i < b.N; i++ {
+        if err := New(bytecode).Run(); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func TestRunDeserializedBytecode(t *testing.T) {
+    program, _ := monkeytest.Parse(fibProgram)
+    comp := compiler.New()
+    if err := comp.Compile(program); err != nil {
+        t.Fatal(err)
+    }
+    data, err := comp.Bytecode().MarshalBinary()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    bytecode := &compiler.Bytecode{}
+    if err := bytecode.UnmarshalBinary(data); err != nil {
+        t.Fatal(err)
+    }
+    machine := New(bytecode)
+    if err := machine.Run(); err != nil {
+        t.Fatal(err)
+    }
+    if !object.Equals(machine.Result(), &object.Integer{Value: 75025}) {
+        t.Errorf("expected 75025, got %s", inspect(machine.Result()))
+    }
+}
+
+func TestRuntimeErrorLine(t *testing.T) {
+    _, err := testRun(t, "let f = fn(x) {\n  x / 0\n};\nf(1)")
+
+    var runtimeErr *RuntimeError
+    if !errors.As(err, &runtimeErr) {
+        t.Fatalf("expected a RuntimeError, got %v", err)
+    }
+    if runtimeErr.Line != 2 || runtimeErr.Error() != "division by zero" {
+        t.Errorf("expected division by zero on line 2, got %q on line %d", runtimeErr.Error(), runtimeErr.Line)
+    }
+}
+
+func TestTrace(t *testing.T) {
+    program, _ := monkeytest.Parse("let add = fn(a, b) { a + b };\nadd(1, 2)")
+    comp := compiler.New()
+    if err := comp.Compile(program); err != nil {
+        t.Fatal(err)
+    }
+
+    var trace strings.Builder
+    machine := New(comp.Bytecode())
+    machine.SetTrace(&trace)
+    if err := machine.Run(); err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []string{
+        "fn main/0    0000    1  OpClosure 0 0 (fn add/2)         [fn main/0]",
+        "fn main/0    0004    1  OpSetGlobal 0 (add)              [fn main/0, fn add/2]",
+        "fn main/0    0007    2  OpGetGlobal 0 (add)              [fn main/0]",
+        "fn main/0    0010    2  OpConstant 1 (1)                 [fn main/0, fn add/2]",
+        "fn main/0    0013    2  OpConstant 2 (2)                 [fn main/0, fn add/2, 1]",
+        "fn main/0    0016    2  OpCall 2                         [..., fn add/2, 1, 2]",
+        "fn add/2     0000    1  OpGetLocal 0 (a)                 [..., fn add/2, 1, 2]",
+        "fn add/2     0002    1  OpGetLocal 1 (b)                 [..., 1, 2, 1]",
+        "fn add/2     0004    1  OpAdd                            [..., 2, 1, 2]",
+        "fn add/2     0005    1  OpReturnValue                    [..., 1, 2, 3]",
+        "fn main/0    0018    1  OpReturnValue                    [fn main/0, 3]",
+    }
+    lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+    if len(lines) != len(expected) {
+        t.Fatalf("expected %d lines, got %d:\n%s", len(expected), len(lines), trace.String())
+    }
+    for i, line := range lines {
+        if line != expected[i] {
+            t.Errorf("line %d wrong.\nwant=%q\ngot= %q", i, expected[i], line)
+        }
+    }
+}
+
+func TestRunCraftedBytecode(t *testing.T) {
+    // The stack depth is right, but the value OpIterNext finds is not an
+    // iterator.
+    crafted := &compiler.Bytecode{Instructions: code.Instructions(bytes.Join([][]byte{
+        code.Make(code.OpNull),
+        code.Make(code.OpIterNext, 6),
+        code.Make(code.OpPop),
+        code.Make(code.OpPop),
+        code.Make(code.OpNull),
+        code.Make(code.OpReturnValue),
+    }, nil))}
+    data, err := crafted.MarshalBinary()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    bytecode := &compiler.Bytecode{}
+    if err := bytecode.UnmarshalBinary(data); err != nil {
+        t.Fatal(err)
+    }
+    err = New(bytecode).Run()
+    if err == nil || err.Error() != "cannot iterate over NULL" {
+        t.Errorf("expected cannot iterate over NULL, got %v", err)
+    }
+}